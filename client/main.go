@@ -2,32 +2,76 @@ package main
 
 import (
 	"bufio"
+	"cmp"
 	"context"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"strings"
+	"text/tabwriter"
 	"time"
 
-	pb "grpc-example/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"grpc-example/config"
+	"grpc-example/logging"
+	pb "grpc-example/proto"
 )
 
+var log = logging.For("client")
+
+// apiKey is sent with every call when client.api_key is set
+var apiKey string
+
+// newCallContext - Creates a call context with a fresh request ID that is
+// sent to the server so client and server log lines can be correlated
+func newCallContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	requestID := logging.NewRequestID()
+	ctx := logging.WithRequestID(context.Background(), requestID)
+	ctx = metadata.AppendToOutgoingContext(ctx, logging.RequestIDHeader, requestID)
+	if apiKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", apiKey)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := logging.Setup(cfg.LoggingOptions()); err != nil {
+		logging.Fatal(log, "invalid logging configuration", "error", err)
+	}
+
 	// Connect to server
-	conn, err := grpc.Dial("localhost:8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(cfg.Client.Target, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
-		log.Fatalf("Failed to connect: %v", err)
+		logging.Fatal(log, "failed to connect", "target", cfg.Client.Target, "error", err)
 	}
 	defer conn.Close()
-	
+
+	apiKey = cfg.Client.APIKey
+
+	// Admin commands: client drain [grace period], export <name>,
+	// erase <name> [reason], audit [method]
+	if len(cfg.Args) > 0 {
+		if err := runAdminCommand(pb.NewAdminClient(conn), cfg.Args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	client := pb.NewGreeterClient(conn)
-	
+
 	// Interactive menu
 	scanner := bufio.NewScanner(os.Stdin)
-	
+
 	for {
 		fmt.Println("\n========================================")
 		fmt.Println("  gRPC Communication Patterns Demo")
@@ -38,10 +82,10 @@ func main() {
 		fmt.Println("4. Bidirectional Streaming RPC")
 		fmt.Println("5. Exit")
 		fmt.Print("\nSelect option (1-5): ")
-		
+
 		scanner.Scan()
 		choice := strings.TrimSpace(scanner.Text())
-		
+
 		switch choice {
 		case "1":
 			testUnaryRPC(client)
@@ -64,20 +108,20 @@ func main() {
 func testUnaryRPC(client pb.GreeterClient) {
 	fmt.Println("\n--- Testing Unary RPC ---")
 	fmt.Print("Enter your name: ")
-	
+
 	scanner := bufio.NewScanner(os.Stdin)
 	scanner.Scan()
 	name := scanner.Text()
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	ctx, cancel := newCallContext(5 * time.Second)
 	defer cancel()
-	
+
 	response, err := client.SayHello(ctx, &pb.HelloRequest{Name: name})
 	if err != nil {
-		log.Printf("Error: %v", err)
+		log.ErrorContext(ctx, "call failed", "error", err)
 		return
 	}
-	
+
 	fmt.Printf("✓ Response: %s\n", response.Message)
 }
 
@@ -85,22 +129,22 @@ func testUnaryRPC(client pb.GreeterClient) {
 func testServerStreamingRPC(client pb.GreeterClient) {
 	fmt.Println("\n--- Testing Server Streaming RPC ---")
 	fmt.Print("Enter your name: ")
-	
+
 	scanner := bufio.NewScanner(os.Stdin)
 	scanner.Scan()
 	name := scanner.Text()
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	ctx, cancel := newCallContext(30 * time.Second)
 	defer cancel()
-	
+
 	stream, err := client.SayHelloServerStream(ctx, &pb.HelloRequest{Name: name})
 	if err != nil {
-		log.Printf("Error: %v", err)
+		log.ErrorContext(ctx, "call failed", "error", err)
 		return
 	}
-	
+
 	fmt.Println("Receiving messages from server...")
-	
+
 	for {
 		response, err := stream.Recv()
 		if err == io.EOF {
@@ -108,11 +152,14 @@ func testServerStreamingRPC(client pb.GreeterClient) {
 			break
 		}
 		if err != nil {
-			log.Printf("Error receiving: %v", err)
+			log.ErrorContext(ctx, "receive failed", "error", err)
 			return
 		}
-		
+
 		fmt.Printf("✓ Received: %s\n", response.Message)
+		if response.GoingAway {
+			fmt.Println("⚠ Server is shutting down, reconnect to continue")
+		}
 	}
 }
 
@@ -120,47 +167,47 @@ func testServerStreamingRPC(client pb.GreeterClient) {
 func testClientStreamingRPC(client pb.GreeterClient) {
 	fmt.Println("\n--- Testing Client Streaming RPC ---")
 	fmt.Println("Enter names (type 'done' to finish):")
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	ctx, cancel := newCallContext(30 * time.Second)
 	defer cancel()
-	
+
 	stream, err := client.SayHelloClientStream(ctx)
 	if err != nil {
-		log.Printf("Error: %v", err)
+		log.ErrorContext(ctx, "call failed", "error", err)
 		return
 	}
-	
+
 	scanner := bufio.NewScanner(os.Stdin)
 	count := 0
-	
+
 	for {
 		fmt.Print("Name: ")
 		scanner.Scan()
 		name := strings.TrimSpace(scanner.Text())
-		
+
 		if name == "done" {
 			break
 		}
-		
+
 		if name == "" {
 			continue
 		}
-		
+
 		if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil {
-			log.Printf("Error sending: %v", err)
+			log.ErrorContext(ctx, "send failed", "error", err)
 			return
 		}
-		
+
 		count++
 		fmt.Printf("✓ Sent: %s (%d)\n", name, count)
 	}
-	
+
 	response, err := stream.CloseAndRecv()
 	if err != nil {
-		log.Printf("Error receiving response: %v", err)
+		log.ErrorContext(ctx, "receive response failed", "error", err)
 		return
 	}
-	
+
 	fmt.Printf("\n✓ Server Response: %s\n", response.Message)
 }
 
@@ -168,16 +215,16 @@ func testClientStreamingRPC(client pb.GreeterClient) {
 func testBidirectionalStreamingRPC(client pb.GreeterClient) {
 	fmt.Println("\n--- Testing Bidirectional Streaming RPC ---")
 	fmt.Println("Chat mode activated! Type messages (type 'exit' to quit)")
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+
+	ctx, cancel := newCallContext(60 * time.Second)
 	defer cancel()
-	
+
 	stream, err := client.SayHelloBidirectional(ctx)
 	if err != nil {
-		log.Printf("Error: %v", err)
+		log.ErrorContext(ctx, "call failed", "error", err)
 		return
 	}
-	
+
 	// Goroutine to receive messages from server
 	waitc := make(chan struct{})
 	go func() {
@@ -188,38 +235,187 @@ func testBidirectionalStreamingRPC(client pb.GreeterClient) {
 				return
 			}
 			if err != nil {
-				log.Printf("Error receiving: %v", err)
+				log.ErrorContext(ctx, "receive failed", "error", err)
 				close(waitc)
 				return
 			}
-			
+
 			fmt.Printf("\n✓ Server: %s\n", response.Message)
+			if response.GoingAway {
+				fmt.Println("⚠ Server is shutting down, type 'exit' and reconnect")
+			}
 			fmt.Print("You: ")
 		}
 	}()
-	
+
 	// Send messages to server
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
 		fmt.Print("You: ")
 		scanner.Scan()
 		message := strings.TrimSpace(scanner.Text())
-		
+
 		if message == "exit" {
 			stream.CloseSend()
 			break
 		}
-		
+
 		if message == "" {
 			continue
 		}
-		
+
 		if err := stream.Send(&pb.HelloRequest{Name: message}); err != nil {
-			log.Printf("Error sending: %v", err)
+			log.ErrorContext(ctx, "send failed", "error", err)
 			return
 		}
 	}
-	
+
 	<-waitc
 	fmt.Println("✓ Chat session ended")
 }
+
+// runAdminCommand - Runs an Admin service call given on the command line;
+// needs client.api_key set to a key with the admin scope
+func runAdminCommand(admin pb.AdminClient, args []string) error {
+	switch args[0] {
+	case "drain":
+		req := &pb.DrainRequest{}
+		if len(args) > 1 {
+			grace, err := time.ParseDuration(args[1])
+			if err != nil {
+				return fmt.Errorf("drain: invalid grace period: %w", err)
+			}
+			req.GracePeriod = durationpb.New(grace)
+		}
+
+		ctx, cancel := newCallContext(10 * time.Second)
+		defer cancel()
+
+		resp, err := admin.Drain(ctx, req)
+		if err != nil {
+			return fmt.Errorf("drain: %w", err)
+		}
+		fmt.Printf("✓ Server draining: %d open streams asked to reconnect, shutting down in %s\n",
+			resp.ActiveStreams, resp.GracePeriod.AsDuration())
+		return nil
+	case "export":
+		// The JSON document goes to stdout, e.g. client export alice > alice.json
+		if len(args) != 2 {
+			return fmt.Errorf("usage: export <name>")
+		}
+		ctx, cancel := newCallContext(5 * time.Minute)
+		defer cancel()
+
+		stream, err := admin.ExportUserData(ctx, &pb.ExportUserDataRequest{Name: args[1]})
+		if err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("export: %w", err)
+			}
+			if _, err := os.Stdout.Write(chunk.Data); err != nil {
+				return fmt.Errorf("export: %w", err)
+			}
+		}
+	case "erase":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("usage: erase <name> [reason]")
+		}
+		req := &pb.EraseUserRequest{Name: args[1]}
+		if len(args) == 3 {
+			req.Reason = args[2]
+		}
+
+		ctx, cancel := newCallContext(30 * time.Second)
+		defer cancel()
+
+		resp, err := admin.EraseUser(ctx, req)
+		if err != nil {
+			return fmt.Errorf("erase: %w", err)
+		}
+		fmt.Printf("✓ User %s erased with %d greetings (%d more from retention archives), tombstone %s\n",
+			resp.UserId, resp.GreetingsDeleted, resp.ArchivedGreetingsRedacted, resp.TombstoneId)
+		return nil
+	case "audit":
+		// The last 50 events of the past hour, optionally of one method
+		req := &pb.QueryAuditEventsRequest{Since: timestamppb.New(time.Now().Add(-time.Hour)), Limit: 1000}
+		if len(args) > 1 {
+			req.Method = args[1]
+		}
+		ctx, cancel := newCallContext(30 * time.Second)
+		defer cancel()
+
+		var events []*pb.AuditEvent
+		for {
+			resp, err := admin.QueryAuditEvents(ctx, req)
+			if err != nil {
+				return fmt.Errorf("audit: %w", err)
+			}
+			events = append(events, resp.Events...)
+			if len(events) > 50 {
+				events = events[len(events)-50:]
+			}
+			if resp.NextAfterSeq == 0 {
+				break
+			}
+			req.AfterSeq = resp.NextAfterSeq
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SEQ\tAT\tMETHOD\tCALLER\tPEER\tCODE\tDURATION")
+		for _, e := range events {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%dms\n", e.Seq, e.At.AsTime().Format(time.DateTime),
+				e.Method, e.Caller, e.Peer, e.Code, e.DurationMs)
+		}
+		return w.Flush()
+	case "stats":
+		// The last 24 hours, non-empty buckets only
+		if len(args) > 3 {
+			return fmt.Errorf("usage: stats [minute|hour|day] [user]")
+		}
+		req := &pb.GreetingStatsRequest{}
+		if len(args) > 1 {
+			unit, ok := pb.StatsUnit_value["STATS_UNIT_"+strings.ToUpper(args[1])]
+			if !ok {
+				return fmt.Errorf("stats: unit must be minute, hour or day")
+			}
+			req.Unit = pb.StatsUnit(unit)
+		}
+		if len(args) > 2 {
+			req.User = args[2]
+		}
+		ctx, cancel := newCallContext(30 * time.Second)
+		defer cancel()
+
+		resp, err := admin.GetGreetingStats(ctx, req)
+		if err != nil {
+			return fmt.Errorf("stats: %w", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FROM\tGREETINGS")
+		for _, b := range resp.Buckets {
+			if b.Greetings > 0 {
+				fmt.Fprintf(w, "%s\t%d\n", b.Start.AsTime().Format(time.DateTime), b.Greetings)
+			}
+		}
+		fmt.Fprintf(w, "total\t%d\n\nUSER\tGREETINGS\n", resp.Total)
+		for _, u := range resp.TopUsers {
+			fmt.Fprintf(w, "%s\t%d\n", cmp.Or(u.Name, u.UserId), u.Greetings)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		b := resp.Batches
+		fmt.Printf("\nclient-stream batches: %d, mean size %.1f, max %d\n", b.Batches, b.MeanSize, b.MaxSize)
+		if resp.RolledUpThrough != nil {
+			fmt.Printf("counted up to %s\n", resp.RolledUpThrough.AsTime().Local().Format(time.DateTime))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q (available: drain [grace period], export <name>, erase <name> [reason], audit [method], stats [unit] [user])", args[0])
+	}
+}
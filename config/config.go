@@ -0,0 +1,512 @@
+// Package config is the typed configuration shared by the server, gateway,
+// client and migrate binaries.
+//
+// Values are resolved in this order, later sources winning:
+//
+//  1. built-in defaults for the active profile (dev or prod)
+//  2. a YAML file (-config, APP_CONFIG, or config.yaml in the working or parent directory)
+//  3. environment variables, including .env from the project root
+//  4. command line flags
+//
+// Every setting has a dotted key such as server.listen_addr. The same key is
+// used in the YAML file, as a flag (-server.listen_addr) and, upper-cased with
+// dots replaced by underscores, as an environment variable prefixed with APP_
+// (APP_SERVER_LISTEN_ADDR).
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// Profiles understood by Defaults.
+const (
+	ProfileDev  = "dev"
+	ProfileProd = "prod"
+)
+
+// Config is the complete configuration of all binaries.
+type Config struct {
+	Profile  string         `yaml:"profile"`
+	Server   ServerConfig   `yaml:"server"`
+	Gateway  GatewayConfig  `yaml:"gateway"`
+	Client   ClientConfig   `yaml:"client"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Log      LogConfig      `yaml:"log"`
+
+	// File is the config file in use, "" if there is none.
+	File string `yaml:"-"`
+	// Sources lists where values came from, for startup logging.
+	Sources []string `yaml:"-"`
+	// Args holds the command line arguments left after flags, such as
+	// the subcommand of the client.
+	Args []string `yaml:"-"`
+	// Warnings collects non-fatal problems found while loading, such as
+	// an unreadable .env file. They are reported once logging is set up.
+	Warnings []string `yaml:"-"`
+}
+
+// ServerConfig configures the gRPC + gRPC-Web server.
+type ServerConfig struct {
+	ListenAddr string `yaml:"listen_addr"`
+	// DebugAddr serves /debug/vars (expvar counters); keep it private.
+	// Empty disables it.
+	DebugAddr       string        `yaml:"debug_addr"`
+	AllowedOrigins  []string      `yaml:"allowed_origins"`
+	DisabledMethods []string      `yaml:"disabled_methods"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// DrainGracePeriod is how long open streams get to disconnect after
+	// SIGTERM or an Admin.Drain call before they are closed.
+	DrainGracePeriod     time.Duration   `yaml:"drain_grace_period"`
+	MaxRecvMsgSize       int             `yaml:"max_recv_msg_size"`
+	MaxSendMsgSize       int             `yaml:"max_send_msg_size"`
+	MaxConcurrentStreams uint32          `yaml:"max_concurrent_streams"`
+	Keepalive            ServerKeepalive `yaml:"keepalive"`
+	RateLimit            ServerRateLimit `yaml:"rate_limit"`
+	Deadlines            ServerDeadlines `yaml:"deadlines"`
+	LoadShedding         LoadShedding    `yaml:"load_shedding"`
+	Audit                AuditConfig     `yaml:"audit"`
+	Webhooks             WebhooksConfig  `yaml:"webhooks"`
+}
+
+// AuditConfig configures the audit log: every Greeter and Admin call is
+// recorded in the audit_events table, chained with HMACs so that deleted or
+// altered rows are detected by "audit-verify".
+type AuditConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// KeyEnv names the environment variable holding the HMAC key; without
+	// the key, rows can be rewritten and their hashes recomputed. The dev
+	// profile falls back to a public key when it is unset, prod refuses
+	// to start.
+	KeyEnv string `yaml:"key_env"`
+	// BufferSize events wait in memory for the writer; when it is full,
+	// calls are not held up but their events are dropped (and counted in
+	// the chain).
+	BufferSize int `yaml:"buffer_size"`
+	// Events are written BatchSize at a time, at least every FlushInterval.
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+// WebhooksConfig configures the delivery of greeting events: each batch of
+// greetings stored queues a greetings.created event per endpoint in the
+// outbox table, in the same transaction, and a dispatcher POSTs them.
+type WebhooksConfig struct {
+	Endpoints []WebhookEndpoint `yaml:"endpoints"`
+	// Timeout bounds each delivery attempt.
+	Timeout time.Duration `yaml:"timeout"`
+	// The outbox is polled every PollInterval for up to BatchSize due events.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`
+	// Failed deliveries are retried after InitialBackoff, doubling up to
+	// MaxBackoff; after MaxAttempts the event is dead-lettered until it is
+	// replayed with "outbox replay".
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	// Delivered events are deleted after KeepDelivered (0 keeps them).
+	KeepDelivered time.Duration `yaml:"keep_delivered"`
+}
+
+// WebhookEndpoint is a receiver of greeting events. Requests are signed with
+// HMAC-SHA256 using the secret in the environment variable SecretEnv.
+type WebhookEndpoint struct {
+	Name      string `yaml:"name"`
+	URL       string `yaml:"url"`
+	SecretEnv string `yaml:"secret_env"`
+}
+
+// LoadShedding configures the server's admission controller, which turns
+// away new calls while the database pool or the server is overloaded. Calls
+// and streams already in progress are never shed.
+type LoadShedding struct {
+	Enabled bool `yaml:"enabled"`
+	// SampleInterval is how often pressure is re-evaluated.
+	SampleInterval time.Duration `yaml:"sample_interval"`
+	// MaxPoolWait is the highest acceptable average wait for a database
+	// connection over one sample.
+	MaxPoolWait time.Duration `yaml:"max_pool_wait"`
+	// MaxInFlight caps the calls and streams being served at once.
+	MaxInFlight int64 `yaml:"max_in_flight"`
+	// MaxLatency is the highest acceptable moving average of unary and
+	// client streaming call latency.
+	MaxLatency time.Duration `yaml:"max_latency"`
+	// RetryAfter is the retry delay suggested to rejected callers.
+	RetryAfter time.Duration `yaml:"retry_after"`
+}
+
+// ServerDeadlines bounds how long RPCs may run.
+type ServerDeadlines struct {
+	// Default applies to every method without an entry in Methods.
+	Default DeadlinePolicy `yaml:"default"`
+	// Methods overrides Default by full gRPC method name.
+	Methods map[string]DeadlinePolicy `yaml:"methods"`
+}
+
+// DeadlinePolicy is applied to an incoming call: Default is imposed when the
+// caller sent no deadline, and any deadline further out than Max is cut
+// down to Max. Zero disables either bound.
+type DeadlinePolicy struct {
+	Default time.Duration `yaml:"default"`
+	Max     time.Duration `yaml:"max"`
+}
+
+// ServerRateLimit configures the server-side limiter. Budgets apply per
+// caller (authenticated user, API key or peer address) and per method.
+type ServerRateLimit struct {
+	Enabled bool `yaml:"enabled"`
+	// Default is the per-caller budget of every method without an entry in Methods.
+	Default RateLimitConfig `yaml:"default"`
+	// Methods overrides Default by full gRPC method name.
+	Methods map[string]RateLimitConfig `yaml:"methods"`
+	// DailyQuotas caps units per caller per UTC day, persisted in the
+	// database. Keys are full method names (one unit per call) or
+	// "greetings" (one unit per greeting created).
+	DailyQuotas map[string]int64 `yaml:"daily_quotas"`
+	// TrustedProxies are CIDRs (such as the gateway) whose x-forwarded-for
+	// metadata is believed when keying anonymous callers by address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// ServerKeepalive mirrors keepalive.EnforcementPolicy and keepalive.ServerParameters.
+type ServerKeepalive struct {
+	MinTime               time.Duration `yaml:"min_time"`
+	PermitWithoutStream   bool          `yaml:"permit_without_stream"`
+	MaxConnectionIdle     time.Duration `yaml:"max_connection_idle"`
+	MaxConnectionAge      time.Duration `yaml:"max_connection_age"`
+	MaxConnectionAgeGrace time.Duration `yaml:"max_connection_age_grace"`
+	Time                  time.Duration `yaml:"time"`
+	Timeout               time.Duration `yaml:"timeout"`
+}
+
+// GatewayConfig configures the HTTP/JSON gateway.
+type GatewayConfig struct {
+	ListenAddr      string        `yaml:"listen_addr"`
+	Upstream        string        `yaml:"upstream"`
+	AllowedOrigins  []string      `yaml:"allowed_origins"`
+	DisabledMethods []string      `yaml:"disabled_methods"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	MaxHeaderBytes  int           `yaml:"max_header_bytes"`
+	RequestTimeout  time.Duration `yaml:"request_timeout"`
+	// MaxRequestTimeout caps timeouts requested by clients through the
+	// grpc-timeout or X-Request-Timeout headers.
+	MaxRequestTimeout time.Duration   `yaml:"max_request_timeout"`
+	RateLimit         RateLimitConfig `yaml:"rate_limit"`
+	Keepalive         ClientKeepalive `yaml:"keepalive"`
+	MaxRecvMsgSize    int             `yaml:"max_recv_msg_size"`
+	MaxSendMsgSize    int             `yaml:"max_send_msg_size"`
+	WindowSize        int32           `yaml:"window_size"`
+}
+
+// RateLimitConfig is a token bucket: RPS tokens per second, Burst capacity.
+type RateLimitConfig struct {
+	RPS   float64 `yaml:"rps"`
+	Burst int     `yaml:"burst"`
+}
+
+// ClientKeepalive mirrors keepalive.ClientParameters.
+type ClientKeepalive struct {
+	Time                time.Duration `yaml:"time"`
+	Timeout             time.Duration `yaml:"timeout"`
+	PermitWithoutStream bool          `yaml:"permit_without_stream"`
+}
+
+// ClientConfig configures the interactive CLI client.
+type ClientConfig struct {
+	Target string `yaml:"target"`
+	// APIKey is sent as x-api-key; admin commands need a key with the
+	// admin scope.
+	APIKey string `yaml:"api_key"`
+}
+
+// DatabaseConfig configures the connection pool.
+type DatabaseConfig struct {
+	URL string `yaml:"url" env:"DATABASE_URL"`
+	// ListenURL is the Postgres connection used to LISTEN for user cache
+	// invalidations; it needs a session, so point it past transaction
+	// poolers such as Supabase's port 6543. Defaults to URL.
+	ListenURL string `yaml:"listen_url" env:"DATABASE_LISTEN_URL"`
+	Debug     bool   `yaml:"debug" env:"DB_DEBUG"`
+	// AutoMigrate applies pending schema migrations at startup; otherwise
+	// the server refuses to start until "migrate up" has been run.
+	AutoMigrate bool `yaml:"auto_migrate"`
+	// StartupTimeout is how long the server keeps retrying, with backoff,
+	// to reach the database at startup before giving up; 0 tries once.
+	StartupTimeout time.Duration `yaml:"startup_timeout"`
+	// HealthInterval is how often the database is pinged once serving;
+	// while it is unreachable the server runs degraded.
+	HealthInterval  time.Duration   `yaml:"health_interval"`
+	MaxIdleConns    int             `yaml:"max_idle_conns"`
+	MaxOpenConns    int             `yaml:"max_open_conns"`
+	ConnMaxLifetime time.Duration   `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration   `yaml:"conn_max_idle_time"`
+	UserCache       UserCacheConfig `yaml:"user_cache"`
+	Replicas        ReplicaConfig   `yaml:"replicas"`
+	Retention       RetentionConfig `yaml:"retention"`
+	Rollups         RollupConfig    `yaml:"rollups"`
+}
+
+// RollupConfig configures the job that maintains the greeting_rollups and
+// greeting_batch_rollups tables behind Admin.GetGreetingStats: per-minute
+// counts are aggregated from new greetings, and hours and days from those.
+type RollupConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Interval is how often the job runs, so how far behind stats may be.
+	Interval time.Duration `yaml:"interval"`
+	// Settle is how far back each run aggregates again, for greetings
+	// stored late; client streams store theirs up to 30s after their
+	// timestamp.
+	Settle time.Duration `yaml:"settle"`
+}
+
+// RetentionConfig limits how many greetings are kept. A background job
+// deletes the ones over MaxAge or beyond the newest MaxPerUser of each user,
+// in batches, optionally archiving them first. Both limits 0 keeps
+// everything and disables the job.
+type RetentionConfig struct {
+	MaxAge     time.Duration `yaml:"max_age"`
+	MaxPerUser int           `yaml:"max_per_user"`
+	// Interval is how often the job runs.
+	Interval time.Duration `yaml:"interval"`
+	// BatchSize rows are deleted per statement, with BatchPause between
+	// statements so the table is never locked for long.
+	BatchSize  int           `yaml:"batch_size"`
+	BatchPause time.Duration `yaml:"batch_pause"`
+	// ArchiveDir receives the purged rows as gzipped NDJSON, one file per
+	// run, before they are deleted; "" deletes without archiving.
+	ArchiveDir string `yaml:"archive_dir"`
+}
+
+// Enabled reports whether any retention limit is set.
+func (r RetentionConfig) Enabled() bool {
+	return r.MaxAge > 0 || r.MaxPerUser > 0
+}
+
+// ReplicaConfig lists read-only Postgres replicas of the primary. Reads are
+// spread over the healthy ones; writes always go to the primary.
+type ReplicaConfig struct {
+	// URLs is comma-separated in DATABASE_REPLICA_URLS; none by default.
+	URLs []string `yaml:"urls" env:"DATABASE_REPLICA_URLS"`
+	// ReadYourWrites keeps a caller's reads on the primary for this long
+	// after it wrote, so replication lag does not hide its own changes.
+	ReadYourWrites time.Duration `yaml:"read_your_writes"`
+	// HealthInterval is how often replicas are pinged; a failing one gets
+	// no reads until it answers again.
+	HealthInterval time.Duration `yaml:"health_interval"`
+}
+
+// UserCacheConfig sizes the LRU cache of users in front of the database.
+type UserCacheConfig struct {
+	// Size is the maximum number of cached names; 0 disables the cache.
+	Size int           `yaml:"size"`
+	TTL  time.Duration `yaml:"ttl"`
+	// NegativeTTL is how long a name is remembered as missing; 0 disables
+	// negative caching.
+	NegativeTTL time.Duration `yaml:"negative_ttl"`
+	// Warmup preloads up to this many users, those with the most greetings
+	// in the last WarmupWindow, at startup; 0 disables it.
+	Warmup       int           `yaml:"warmup"`
+	WarmupWindow time.Duration `yaml:"warmup_window"`
+	// Invalidation is how writes evict the user from the caches of other
+	// replicas: "postgres" (LISTEN/NOTIFY), "local" (this process only) or
+	// "auto", which is postgres on Postgres and local otherwise.
+	Invalidation string `yaml:"invalidation"`
+}
+
+// AuthConfig lists the API keys the server accepts. Calls without a key are
+// anonymous; calls with an unknown key are rejected.
+type AuthConfig struct {
+	APIKeys []APIKey `yaml:"api_keys"`
+}
+
+// APIKey identifies a caller. Only the SHA-256 of the key is stored
+// (echo -n "$KEY" | sha256sum).
+type APIKey struct {
+	Name   string   `yaml:"name"`
+	SHA256 string   `yaml:"sha256"`
+	User   string   `yaml:"user"`
+	Scopes []string `yaml:"scopes"`
+}
+
+// LogConfig configures the shared slog sink, see package logging.
+type LogConfig struct {
+	Format string            `yaml:"format" env:"LOG_FORMAT"`
+	Level  string            `yaml:"level" env:"LOG_LEVEL"`
+	Levels map[string]string `yaml:"levels" env:"LOG_LEVELS"`
+}
+
+// Defaults returns the built-in configuration for a profile.
+func Defaults(profile string) *Config {
+	cfg := &Config{
+		Profile: profile,
+		Server: ServerConfig{
+			ListenAddr:           ":8080",
+			DebugAddr:            "127.0.0.1:6060",
+			AllowedOrigins:       []string{"http://localhost:3000", "http://localhost:3001"},
+			DisabledMethods:      []string{"/helloworld.Greeter/SayHello"},
+			ReadTimeout:          15 * time.Second,
+			WriteTimeout:         15 * time.Second,
+			IdleTimeout:          60 * time.Second,
+			ShutdownTimeout:      10 * time.Second,
+			DrainGracePeriod:     30 * time.Second,
+			MaxRecvMsgSize:       4 * 1024 * 1024,
+			MaxSendMsgSize:       4 * 1024 * 1024,
+			MaxConcurrentStreams: 1000,
+			Keepalive: ServerKeepalive{
+				MinTime:               5 * time.Second,
+				PermitWithoutStream:   true,
+				MaxConnectionIdle:     15 * time.Minute,
+				MaxConnectionAge:      30 * time.Minute,
+				MaxConnectionAgeGrace: 5 * time.Second,
+				Time:                  5 * time.Second,
+				Timeout:               1 * time.Second,
+			},
+			RateLimit: ServerRateLimit{
+				Enabled:        true,
+				Default:        RateLimitConfig{RPS: 50, Burst: 100},
+				Methods:        map[string]RateLimitConfig{},
+				DailyQuotas:    map[string]int64{"greetings": 10000},
+				TrustedProxies: []string{"127.0.0.1/32", "::1/128"},
+			},
+			Deadlines: ServerDeadlines{
+				Default: DeadlinePolicy{Default: 30 * time.Second, Max: 2 * time.Minute},
+				Methods: map[string]DeadlinePolicy{
+					// Server streams run for a few seconds per message
+					"/helloworld.Greeter/SayHelloServerStream": {Default: time.Minute, Max: 10 * time.Minute},
+					// Chat sessions stay open as long as the client wants
+					"/helloworld.Greeter/SayHelloBidirectional": {},
+				},
+			},
+			LoadShedding: LoadShedding{
+				Enabled:        true,
+				SampleInterval: 250 * time.Millisecond,
+				MaxPoolWait:    50 * time.Millisecond,
+				MaxInFlight:    900,
+				MaxLatency:     2 * time.Second,
+				RetryAfter:     time.Second,
+			},
+			Audit: AuditConfig{
+				Enabled:       true,
+				KeyEnv:        "AUDIT_HMAC_KEY",
+				BufferSize:    10000,
+				BatchSize:     500,
+				FlushInterval: time.Second,
+			},
+			Webhooks: WebhooksConfig{
+				Timeout:        10 * time.Second,
+				PollInterval:   time.Second,
+				BatchSize:      100,
+				MaxAttempts:    12,
+				InitialBackoff: 5 * time.Second,
+				MaxBackoff:     time.Hour,
+				KeepDelivered:  7 * 24 * time.Hour,
+			},
+		},
+		Gateway: GatewayConfig{
+			ListenAddr:        ":8081",
+			Upstream:          "localhost:8080",
+			AllowedOrigins:    []string{"http://localhost:*", "http://127.0.0.1:*"},
+			DisabledMethods:   []string{"/helloworld.Greeter/SayHello"},
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      15 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   10 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			RequestTimeout:    30 * time.Second,
+			MaxRequestTimeout: 5 * time.Minute,
+			RateLimit:         RateLimitConfig{RPS: 100, Burst: 200},
+			Keepalive: ClientKeepalive{
+				Time:                30 * time.Second,
+				Timeout:             5 * time.Second,
+				PermitWithoutStream: true,
+			},
+			MaxRecvMsgSize: 4 * 1024 * 1024,
+			MaxSendMsgSize: 4 * 1024 * 1024,
+			WindowSize:     1 << 20,
+		},
+		Client: ClientConfig{
+			Target: "localhost:8080",
+		},
+		Database: DatabaseConfig{
+			AutoMigrate:     true,
+			StartupTimeout:  time.Minute,
+			HealthInterval:  5 * time.Second,
+			MaxIdleConns:    25,
+			MaxOpenConns:    100,
+			ConnMaxLifetime: 10 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			UserCache: UserCacheConfig{
+				Size:         10000,
+				TTL:          10 * time.Minute,
+				NegativeTTL:  30 * time.Second,
+				Warmup:       1000,
+				WarmupWindow: 7 * 24 * time.Hour,
+				Invalidation: "auto",
+			},
+			Replicas: ReplicaConfig{
+				ReadYourWrites: 5 * time.Second,
+				HealthInterval: 5 * time.Second,
+			},
+			Rollups: RollupConfig{
+				Enabled:  true,
+				Interval: time.Minute,
+				Settle:   2 * time.Minute,
+			},
+			Retention: RetentionConfig{
+				Interval:   time.Hour,
+				BatchSize:  1000,
+				BatchPause: 100 * time.Millisecond,
+			},
+		},
+		Log: LogConfig{
+			Format: "text",
+			Level:  "info",
+			Levels: map[string]string{},
+		},
+	}
+
+	if profile == ProfileProd {
+		// Production only talks to explicitly configured origins and logs
+		// machine-readable output.
+		cfg.Server.AllowedOrigins = nil
+		cfg.Gateway.AllowedOrigins = nil
+		cfg.Log.Format = "json"
+		// Schema changes are rolled out deliberately with "migrate up"
+		cfg.Database.AutoMigrate = false
+	}
+	return cfg
+}
+
+// OriginAllowed reports whether origin matches one of the patterns. A
+// pattern ending in "*" matches any origin with that prefix, so
+// "http://localhost:*" allows every local port.
+func OriginAllowed(patterns []string, origin string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(origin, prefix) {
+				return true
+			}
+		} else if p == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// MethodDisabled reports whether a full gRPC method name
+// ("/helloworld.Greeter/SayHello") is switched off in list.
+func MethodDisabled(list []string, method string) bool {
+	for _, m := range list {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variable of every setting.
+const EnvPrefix = "APP_"
+
+// fileConfig is the on-disk layout: a base Config plus optional
+// per-profile overlays under "profiles".
+type fileConfig struct {
+	Config   `yaml:",inline"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+
+	raw []byte
+}
+
+// Load resolves the configuration from defaults, the config file, the
+// environment and args (usually os.Args[1:]), then validates it.
+func Load(args []string) (*Config, error) {
+	var sources, warnings []string
+
+	// Load .env from the project root (parent directory), falling back to
+	// the current directory. Variables already set in the environment win.
+	envPath := filepath.Join("..", ".env")
+	if _, err := os.Stat(envPath); err != nil {
+		envPath = ".env"
+	}
+	if err := godotenv.Load(envPath); err == nil {
+		sources = append(sources, "env file "+envPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		warnings = append(warnings, fmt.Sprintf("could not load %s: %v", envPath, err))
+	}
+
+	// Flags are parsed first so -config and -profile can steer the file and
+	// defaults, but their values are applied last.
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "path to a YAML config file")
+	profile := fs.String("profile", os.Getenv(EnvPrefix+"PROFILE"), "configuration profile (dev or prod)")
+	type override struct{ key, value string }
+	var overrides []override
+	for _, f := range fields(Defaults(ProfileDev)) {
+		if !settable(f.value.Type()) {
+			continue
+		}
+		key := f.key
+		fs.Func(key, fmt.Sprintf("%s (env %s)", key, f.envName()), func(v string) error {
+			overrides = append(overrides, override{key, v})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var file *fileConfig
+	path, err := findConfigFile(*configPath)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		if file, err = readConfigFile(path); err != nil {
+			return nil, err
+		}
+		sources = append(sources, "config file "+path)
+		if *profile == "" {
+			*profile = file.Profile
+		}
+	}
+	if *profile == "" {
+		*profile = ProfileDev
+	}
+
+	cfg := Defaults(*profile)
+	sources = append([]string{"defaults (" + *profile + ")"}, sources...)
+	if file != nil {
+		if err := applyFile(cfg, file); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	cfg.Profile = *profile
+
+	envCount := 0
+	for _, f := range fields(cfg) {
+		if !settable(f.value.Type()) {
+			continue
+		}
+		for _, name := range []string{f.alias, f.envName()} {
+			v, ok := os.LookupEnv(name)
+			if name == "" || !ok {
+				continue
+			}
+			if err := setValue(f.value, v); err != nil {
+				return nil, fmt.Errorf("environment %s: %w", name, err)
+			}
+			envCount++
+		}
+	}
+	if envCount > 0 {
+		sources = append(sources, fmt.Sprintf("environment (%d settings)", envCount))
+	}
+
+	byKey := make(map[string]reflect.Value)
+	for _, f := range fields(cfg) {
+		byKey[f.key] = f.value
+	}
+	for _, o := range overrides {
+		if err := setValue(byKey[o.key], o.value); err != nil {
+			return nil, fmt.Errorf("flag -%s: %w", o.key, err)
+		}
+	}
+	if len(overrides) > 0 {
+		sources = append(sources, fmt.Sprintf("flags (%d settings)", len(overrides)))
+	}
+
+	// DB_DEBUG traces SQL at debug level, so make sure it is visible.
+	if cfg.Database.Debug {
+		if cfg.Log.Levels == nil {
+			cfg.Log.Levels = make(map[string]string)
+		}
+		if _, ok := cfg.Log.Levels["gorm"]; !ok {
+			cfg.Log.Levels["gorm"] = "debug"
+		}
+	}
+
+	cfg.File = path
+	cfg.Args = fs.Args()
+	cfg.Sources = sources
+	cfg.Warnings = warnings
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// findConfigFile returns explicit if set, otherwise the first config.yaml
+// found in the working or parent directory, or "" if there is none.
+func findConfigFile(explicit string) (string, error) {
+	if explicit != "" {
+		if _, err := os.Stat(explicit); err != nil {
+			return "", fmt.Errorf("config file: %w", err)
+		}
+		return explicit, nil
+	}
+	for _, candidate := range []string{"config.yaml", filepath.Join("..", "config.yaml")} {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", nil
+}
+
+func readConfigFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	// Decode once to learn the profile; applyFile decodes again on top of
+	// the profile's defaults.
+	file := &fileConfig{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	file.raw = data
+	return file, nil
+}
+
+// applyFile decodes the file on top of cfg, then the overlay of the active
+// profile if the file has one. The active profile is cfg's, even if the
+// file names another one (-profile overrides it).
+func applyFile(cfg *Config, file *fileConfig) error {
+	layered := &fileConfig{Config: *cfg}
+	dec := yaml.NewDecoder(bytes.NewReader(file.raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(layered); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	layered.Profile = cfg.Profile
+	*cfg = layered.Config
+	if overlay, ok := file.Profiles[cfg.Profile]; ok {
+		if err := overlay.Decode(cfg); err != nil {
+			return fmt.Errorf("profiles.%s: %w", cfg.Profile, err)
+		}
+	}
+	return nil
+}
+
+// field is one leaf setting of Config.
+type field struct {
+	key   string // dotted YAML path, e.g. server.listen_addr
+	alias string // legacy environment variable, e.g. DATABASE_URL
+	value reflect.Value
+}
+
+func (f field) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(f.key, ".", "_"))
+}
+
+// fields lists every leaf setting of cfg in declaration order.
+func fields(cfg *Config) []field {
+	var out []field
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+			if name == "-" || name == "" || name == "profile" {
+				continue
+			}
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Struct {
+				walk(prefix+name+".", fv)
+				continue
+			}
+			out = append(out, field{key: prefix + name, alias: sf.Tag.Get("env"), value: fv})
+		}
+	}
+	walk("", reflect.ValueOf(cfg).Elem())
+	return out
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// settable reports whether setValue can parse a value of type t from a
+// string. Settings of other types (lists of structs and the like) can only
+// be set in the config file.
+func settable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && t.Elem().Kind() != reflect.Struct && settable(t.Elem())
+	}
+	return false
+}
+
+// setValue parses s into v. Lists are comma separated and maps are
+// comma separated key=value pairs.
+func setValue(v reflect.Value, s string) error {
+	s = strings.TrimSpace(s)
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.CanInt():
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.CanUint():
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case v.CanFloat():
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	case v.Kind() == reflect.Map && settable(v.Type()):
+		m := reflect.MakeMap(v.Type())
+		for _, pair := range strings.Split(s, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			k, val, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("%q is not key=value", pair)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(elem, val); err != nil {
+				return fmt.Errorf("%s: %w", strings.TrimSpace(k), err)
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(k)), elem)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
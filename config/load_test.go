@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config.yaml into a fresh working directory, so Load
+// does not pick up the repository's own config or .env.
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	writeConfig(t, `
+server:
+  listen_addr: ":9000"
+gateway:
+  listen_addr: ":9001"
+  upstream: "file:8080"
+database:
+  url: "postgres://file/db"
+log:
+  level: warn
+  format: json
+`)
+	// Each setting is set in one more layer than the one before it.
+	t.Setenv("APP_GATEWAY_LISTEN_ADDR", ":9002")
+	t.Setenv("APP_GATEWAY_UPSTREAM", "env:8080")
+	t.Setenv("DATABASE_URL", "postgres://legacy/db")
+	t.Setenv("DATABASE_REPLICA_URLS", "postgres://replica1/db, postgres://replica2/db,")
+	t.Setenv("LOG_LEVEL", "info")
+	t.Setenv("APP_LOG_LEVEL", "error")
+	t.Setenv("LOG_FORMAT", "text")
+
+	cfg, err := Load([]string{"-gateway.upstream", "flag:8080", "-log.format=json", "rest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := Defaults(ProfileDev)
+	tests := []struct {
+		setting string
+		got     any
+		want    any
+	}{
+		{"server.debug_addr (default)", cfg.Server.DebugAddr, defaults.Server.DebugAddr},
+		{"server.listen_addr (file over default)", cfg.Server.ListenAddr, ":9000"},
+		{"gateway.listen_addr (APP_ env over file)", cfg.Gateway.ListenAddr, ":9002"},
+		{"database.url (legacy env over file)", cfg.Database.URL, "postgres://legacy/db"},
+		{"database.replicas.urls (comma-separated env)", cfg.Database.Replicas.URLs, []string{"postgres://replica1/db", "postgres://replica2/db"}},
+		{"log.level (APP_ env over legacy env)", cfg.Log.Level, "error"},
+		{"gateway.upstream (flag over env)", cfg.Gateway.Upstream, "flag:8080"},
+		{"log.format (flag over legacy env)", cfg.Log.Format, "json"},
+		{"args", cfg.Args, []string{"rest"}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.setting, tt.got, tt.want)
+		}
+	}
+	if got := strings.Join(cfg.Sources, "; "); got != "defaults (dev); config file config.yaml; environment (7 settings); flags (2 settings)" {
+		t.Errorf("sources = %q", got)
+	}
+}
+
+func TestLoadProfileOverlay(t *testing.T) {
+	writeConfig(t, `
+profile: prod
+server:
+  listen_addr: ":9000"
+profiles:
+  prod:
+    server:
+      listen_addr: ":9443"
+  dev:
+    server:
+      listen_addr: ":9999"
+`)
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Profile != ProfileProd || cfg.Server.ListenAddr != ":9443" {
+		t.Errorf("profile %s listens on %s, want prod on :9443", cfg.Profile, cfg.Server.ListenAddr)
+	}
+
+	// -profile picks the overlay and the defaults it is applied to.
+	cfg, err = Load([]string{"-profile", ProfileDev})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Profile != ProfileDev || cfg.Server.ListenAddr != ":9999" {
+		t.Errorf("profile %s listens on %s, want dev on :9999", cfg.Profile, cfg.Server.ListenAddr)
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "unknown file key", yaml: "server:\n  listen_adr: \":9000\"\n", want: "listen_adr"},
+		{name: "unparsable env", env: map[string]string{"APP_SERVER_MAX_CONCURRENT_STREAMS": "many"}, want: "APP_SERVER_MAX_CONCURRENT_STREAMS"},
+		{name: "unparsable flag", args: []string{"-database.max_open_conns", "lots"}, want: "-database.max_open_conns"},
+		{name: "invalid replica URL", env: map[string]string{"DATABASE_URL": "postgres://primary/db", "DATABASE_REPLICA_URLS": "postgres://ok/db,mysql://bad/db"}, want: "database.replicas.urls[1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfig(t, tt.yaml)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
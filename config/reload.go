@@ -0,0 +1,170 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// reloadable lists the settings that can change while the process runs;
+// entries ending in "." cover a whole section. Everything else (listen
+// addresses, pool sizes, keepalive, ...) is fixed at startup; changes to
+// those keys are ignored on reload with a warning.
+var reloadable = []string{
+	"server.allowed_origins",
+	"server.disabled_methods",
+	"server.rate_limit.",
+	"server.deadlines.",
+	"server.load_shedding.",
+	"server.drain_grace_period",
+	"gateway.allowed_origins",
+	"gateway.disabled_methods",
+	"gateway.rate_limit.",
+	"gateway.request_timeout",
+	"gateway.max_request_timeout",
+	"auth.api_keys",
+	"log.level",
+	"log.levels",
+}
+
+func isReloadable(key string) bool {
+	for _, r := range reloadable {
+		if key == r || (strings.HasSuffix(r, ".") && strings.HasPrefix(key, r)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reloader holds the live configuration and swaps in a new one on SIGHUP or
+// when the config file changes. A configuration that fails to load or
+// validate is rejected and the previous one stays active.
+type Reloader struct {
+	args    []string
+	log     *slog.Logger
+	current atomic.Pointer[Config]
+
+	mu        sync.Mutex
+	listeners []func(old, cur *Config)
+}
+
+// NewReloader starts from cfg, which must have been loaded from args.
+func NewReloader(cfg *Config, args []string, l *slog.Logger) *Reloader {
+	r := &Reloader{args: args, log: l}
+	r.current.Store(cfg)
+	return r
+}
+
+// Current returns the active configuration. Callers must treat it as
+// read-only and should not hold on to it across requests.
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// OnReload registers fn to run after every successful reload.
+func (r *Reloader) OnReload(fn func(old, cur *Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// Reload loads the configuration again and activates its reloadable
+// settings. On error the active configuration is left untouched.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.current.Load()
+	cur, err := Load(r.args)
+	if err != nil {
+		return err
+	}
+
+	// Keep structural settings from the running configuration.
+	oldFields := fields(old)
+	var changed, ignored []string
+	for i, f := range fields(cur) {
+		prev := oldFields[i].value
+		if reflect.DeepEqual(f.value.Interface(), prev.Interface()) {
+			continue
+		}
+		if isReloadable(f.key) {
+			changed = append(changed, f.key)
+			continue
+		}
+		ignored = append(ignored, f.key)
+		f.value.Set(prev)
+	}
+	if cur.Profile != old.Profile {
+		ignored = append(ignored, "profile")
+		cur.Profile = old.Profile
+	}
+
+	if len(ignored) > 0 {
+		r.log.Warn("settings changed that require a restart, keeping current values", "keys", ignored)
+	}
+	if len(changed) == 0 {
+		r.log.Info("configuration reloaded, nothing to apply")
+		return nil
+	}
+
+	r.current.Store(cur)
+	for _, fn := range r.listeners {
+		fn(old, cur)
+	}
+	r.log.Info("configuration reloaded", "changed", changed)
+	return nil
+}
+
+// Run reloads on SIGHUP and whenever the config file's size or
+// modification time changes, until ctx is done. The file is polled rather
+// than watched with inotify so that editors that replace the file and
+// Kubernetes ConfigMap symlink swaps are picked up reliably.
+func (r *Reloader) Run(ctx context.Context, pollInterval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	last := fileStamp(r.Current().File)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.log.Info("SIGHUP received, reloading configuration")
+		case <-ticker.C:
+			stamp := fileStamp(r.Current().File)
+			if stamp == last {
+				continue
+			}
+			last = stamp
+			r.log.Info("config file changed, reloading configuration", "path", r.Current().File)
+		}
+		if err := r.Reload(); err != nil {
+			r.log.Error("configuration reload rejected, keeping current configuration", "error", err)
+		}
+	}
+}
+
+// fileStamp identifies a version of the file at path; "" if there is none.
+func fileStamp(path string) string {
+	if path == "" {
+		return ""
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano())
+}
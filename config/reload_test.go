@@ -0,0 +1,124 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+)
+
+// testReloader loads the config file at path and returns a Reloader over
+// it, along with a count of OnReload calls.
+func testReloader(t *testing.T, path string) (*Reloader, *int) {
+	t.Helper()
+	args := []string{"-config", path}
+	cfg, err := Load(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReloader(cfg, args, slog.New(slog.DiscardHandler))
+	calls := new(int)
+	r.OnReload(func(old, cur *Config) { *calls++ })
+	return r, calls
+}
+
+func rewrite(t *testing.T, path, yaml string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const reloadBase = `
+server:
+  listen_addr: ":9000"
+  disabled_methods: ["/helloworld.Greeter/SayHello"]
+log:
+  level: info
+`
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{name: "malformed YAML", yaml: "server: [\n"},
+		{name: "unknown key", yaml: reloadBase + "  levle: debug\n"},
+		{name: "failed validation", yaml: `
+server:
+  listen_addr: ":9000"
+  disabled_methods: []
+log:
+  level: loud
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, reloadBase)
+			r, calls := testReloader(t, path)
+			before := r.Current()
+
+			rewrite(t, path, tt.yaml)
+			if err := r.Reload(); err == nil {
+				t.Fatal("Reload accepted an invalid config")
+			}
+			if r.Current() != before {
+				t.Error("Current() changed after a rejected reload")
+			}
+			if len(before.Server.DisabledMethods) != 1 || before.Log.Level != "info" {
+				t.Errorf("active config was modified: disabled_methods %v, log.level %q", before.Server.DisabledMethods, before.Log.Level)
+			}
+			if *calls != 0 {
+				t.Errorf("OnReload fired %d times after a rejected reload", *calls)
+			}
+		})
+	}
+}
+
+func TestReloadIgnoresStructuralSettings(t *testing.T) {
+	path := writeConfig(t, reloadBase)
+	r, calls := testReloader(t, path)
+	before := r.Current()
+
+	// Only a structural setting changed: nothing to apply.
+	rewrite(t, path, `
+server:
+  listen_addr: ":9999"
+  disabled_methods: ["/helloworld.Greeter/SayHello"]
+log:
+  level: info
+`)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Current() != before || *calls != 0 {
+		t.Fatalf("structural change was applied: listen_addr %s, %d OnReload calls", r.Current().Server.ListenAddr, *calls)
+	}
+
+	// Alongside a reloadable one, the structural setting keeps its value.
+	rewrite(t, path, `
+profile: prod
+server:
+  listen_addr: ":9999"
+  disabled_methods: []
+log:
+  level: debug
+`)
+	var gotOld, gotCur *Config
+	r.OnReload(func(old, cur *Config) { gotOld, gotCur = old, cur })
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	cur := r.Current()
+	if *calls != 1 || gotOld != before || gotCur != cur {
+		t.Fatalf("OnReload called %d times with (%p, %p), want once with (%p, %p)", *calls, gotOld, gotCur, before, cur)
+	}
+	if cur.Log.Level != "debug" || len(cur.Server.DisabledMethods) != 0 {
+		t.Errorf("reloadable settings not applied: log.level %q, disabled_methods %v", cur.Log.Level, cur.Server.DisabledMethods)
+	}
+	if cur.Server.ListenAddr != ":9000" {
+		t.Errorf("server.listen_addr = %s, want :9000 kept until restart", cur.Server.ListenAddr)
+	}
+	if cur.Profile != ProfileDev || cur.Database.MaxOpenConns != before.Database.MaxOpenConns {
+		t.Errorf("profile switched to %s (max_open_conns %d), want dev kept", cur.Profile, cur.Database.MaxOpenConns)
+	}
+}
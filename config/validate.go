@@ -0,0 +1,313 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"grpc-example/logging"
+)
+
+// Validate checks every setting and reports all problems at once.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	addr := func(key, v string) {
+		if _, _, err := net.SplitHostPort(v); err != nil {
+			fail(key, "%q is not a host:port address", v)
+		}
+	}
+	positive := func(key string, d time.Duration) {
+		if d <= 0 {
+			fail(key, "must be positive, got %s", d)
+		}
+	}
+	nonNegative := func(key string, d time.Duration) {
+		if d < 0 {
+			fail(key, "must not be negative, got %s", d)
+		}
+	}
+	origins := func(key string, list []string) {
+		for _, o := range list {
+			if strings.Contains(strings.TrimSuffix(o, "*"), "*") {
+				fail(key, "%q: '*' is only allowed at the end of an origin", o)
+			}
+		}
+	}
+
+	methods := func(key string, list []string) {
+		for _, m := range list {
+			if !strings.HasPrefix(m, "/") || strings.Count(m, "/") != 2 {
+				fail(key, "%q is not a full gRPC method name like /helloworld.Greeter/SayHello", m)
+			}
+		}
+	}
+
+	if c.Profile != ProfileDev && c.Profile != ProfileProd {
+		fail("profile", "unknown profile %q (want %s or %s)", c.Profile, ProfileDev, ProfileProd)
+	}
+
+	s := c.Server
+	addr("server.listen_addr", s.ListenAddr)
+	if s.DebugAddr != "" {
+		addr("server.debug_addr", s.DebugAddr)
+	}
+	origins("server.allowed_origins", s.AllowedOrigins)
+	methods("server.disabled_methods", s.DisabledMethods)
+	nonNegative("server.read_timeout", s.ReadTimeout)
+	nonNegative("server.write_timeout", s.WriteTimeout)
+	nonNegative("server.idle_timeout", s.IdleTimeout)
+	positive("server.shutdown_timeout", s.ShutdownTimeout)
+	nonNegative("server.drain_grace_period", s.DrainGracePeriod)
+	if s.MaxRecvMsgSize <= 0 {
+		fail("server.max_recv_msg_size", "must be positive")
+	}
+	if s.MaxSendMsgSize <= 0 {
+		fail("server.max_send_msg_size", "must be positive")
+	}
+	if s.MaxConcurrentStreams == 0 {
+		fail("server.max_concurrent_streams", "must be positive")
+	}
+	positive("server.keepalive.min_time", s.Keepalive.MinTime)
+	positive("server.keepalive.time", s.Keepalive.Time)
+	positive("server.keepalive.timeout", s.Keepalive.Timeout)
+	nonNegative("server.keepalive.max_connection_idle", s.Keepalive.MaxConnectionIdle)
+	nonNegative("server.keepalive.max_connection_age", s.Keepalive.MaxConnectionAge)
+	nonNegative("server.keepalive.max_connection_age_grace", s.Keepalive.MaxConnectionAgeGrace)
+	rateLimit := func(key string, rl RateLimitConfig) {
+		if rl.RPS <= 0 {
+			fail(key+".rps", "must be positive, got %v", rl.RPS)
+		}
+		if rl.Burst < 1 {
+			fail(key+".burst", "must be at least 1, got %d", rl.Burst)
+		}
+	}
+	rateLimit("server.rate_limit.default", s.RateLimit.Default)
+	for method, rl := range s.RateLimit.Methods {
+		methods("server.rate_limit.methods", []string{method})
+		rateLimit("server.rate_limit.methods."+method, rl)
+	}
+	for bucket, limit := range s.RateLimit.DailyQuotas {
+		if bucket != "greetings" {
+			methods("server.rate_limit.daily_quotas", []string{bucket})
+		}
+		if limit < 0 {
+			fail("server.rate_limit.daily_quotas."+bucket, "must not be negative, got %d", limit)
+		}
+	}
+	deadline := func(key string, p DeadlinePolicy) {
+		nonNegative(key+".default", p.Default)
+		nonNegative(key+".max", p.Max)
+		if p.Max > 0 && p.Default > p.Max {
+			fail(key+".default", "must not exceed max (%s), got %s", p.Max, p.Default)
+		}
+	}
+	deadline("server.deadlines.default", s.Deadlines.Default)
+	for method, p := range s.Deadlines.Methods {
+		methods("server.deadlines.methods", []string{method})
+		deadline("server.deadlines.methods."+method, p)
+	}
+	if ls := s.LoadShedding; ls.Enabled {
+		positive("server.load_shedding.sample_interval", ls.SampleInterval)
+		positive("server.load_shedding.max_pool_wait", ls.MaxPoolWait)
+		positive("server.load_shedding.max_latency", ls.MaxLatency)
+		positive("server.load_shedding.retry_after", ls.RetryAfter)
+		if ls.MaxInFlight <= 0 {
+			fail("server.load_shedding.max_in_flight", "must be positive, got %d", ls.MaxInFlight)
+		}
+	}
+	if a := s.Audit; a.Enabled {
+		if a.KeyEnv == "" {
+			fail("server.audit.key_env", "must name the environment variable with the HMAC key")
+		}
+		if a.BatchSize <= 0 || a.BufferSize < a.BatchSize {
+			fail("server.audit", "batch_size must be positive and at most buffer_size, got %d and %d", a.BatchSize, a.BufferSize)
+		}
+		positive("server.audit.flush_interval", a.FlushInterval)
+	}
+	if w := s.Webhooks; len(w.Endpoints) > 0 {
+		names := make(map[string]bool)
+		for i, e := range w.Endpoints {
+			key := fmt.Sprintf("server.webhooks.endpoints[%d]", i)
+			if e.Name == "" || names[e.Name] {
+				fail(key+".name", "must be set and unique, got %q", e.Name)
+			}
+			names[e.Name] = true
+			if u, err := url.Parse(e.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				fail(key+".url", "%q is not an http(s) URL", e.URL)
+			}
+			if e.SecretEnv == "" {
+				fail(key+".secret_env", "must name the environment variable holding the signing secret")
+			}
+		}
+		positive("server.webhooks.timeout", w.Timeout)
+		positive("server.webhooks.poll_interval", w.PollInterval)
+		positive("server.webhooks.initial_backoff", w.InitialBackoff)
+		nonNegative("server.webhooks.keep_delivered", w.KeepDelivered)
+		if w.MaxBackoff < w.InitialBackoff {
+			fail("server.webhooks.max_backoff", "must be at least initial_backoff (%s), got %s", w.InitialBackoff, w.MaxBackoff)
+		}
+		if w.BatchSize <= 0 {
+			fail("server.webhooks.batch_size", "must be positive, got %d", w.BatchSize)
+		}
+		if w.MaxAttempts <= 0 {
+			fail("server.webhooks.max_attempts", "must be positive, got %d", w.MaxAttempts)
+		}
+	}
+	for _, cidr := range s.RateLimit.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			fail("server.rate_limit.trusted_proxies", "%q is not a CIDR", cidr)
+		}
+	}
+
+	g := c.Gateway
+	addr("gateway.listen_addr", g.ListenAddr)
+	addr("gateway.upstream", g.Upstream)
+	origins("gateway.allowed_origins", g.AllowedOrigins)
+	methods("gateway.disabled_methods", g.DisabledMethods)
+	nonNegative("gateway.read_timeout", g.ReadTimeout)
+	nonNegative("gateway.write_timeout", g.WriteTimeout)
+	nonNegative("gateway.idle_timeout", g.IdleTimeout)
+	positive("gateway.shutdown_timeout", g.ShutdownTimeout)
+	positive("gateway.request_timeout", g.RequestTimeout)
+	positive("gateway.max_request_timeout", g.MaxRequestTimeout)
+	if g.MaxHeaderBytes <= 0 {
+		fail("gateway.max_header_bytes", "must be positive")
+	}
+	rateLimit("gateway.rate_limit", g.RateLimit)
+	positive("gateway.keepalive.time", g.Keepalive.Time)
+	positive("gateway.keepalive.timeout", g.Keepalive.Timeout)
+	if g.MaxRecvMsgSize <= 0 {
+		fail("gateway.max_recv_msg_size", "must be positive")
+	}
+	if g.MaxSendMsgSize <= 0 {
+		fail("gateway.max_send_msg_size", "must be positive")
+	}
+	// grpc ignores windows below 64KiB
+	if g.WindowSize < 64*1024 {
+		fail("gateway.window_size", "must be at least 65536, got %d", g.WindowSize)
+	}
+
+	addr("client.target", c.Client.Target)
+
+	d := c.Database
+	if d.URL != "" && d.URL != "memory://" && !strings.HasPrefix(d.URL, "postgres://") && !strings.HasPrefix(d.URL, "postgresql://") && !strings.HasPrefix(d.URL, "sqlite://") {
+		fail("database.url", "must be a postgres://, postgresql:// or sqlite:// URL, or memory://")
+	}
+	if d.MaxOpenConns <= 0 {
+		fail("database.max_open_conns", "must be positive, got %d", d.MaxOpenConns)
+	}
+	if d.MaxIdleConns < 0 || d.MaxIdleConns > d.MaxOpenConns {
+		fail("database.max_idle_conns", "must be between 0 and max_open_conns (%d), got %d", d.MaxOpenConns, d.MaxIdleConns)
+	}
+	if d.ListenURL != "" && !strings.HasPrefix(d.ListenURL, "postgres://") && !strings.HasPrefix(d.ListenURL, "postgresql://") {
+		fail("database.listen_url", "must be a postgres:// or postgresql:// URL")
+	}
+	nonNegative("database.startup_timeout", d.StartupTimeout)
+	positive("database.health_interval", d.HealthInterval)
+	nonNegative("database.conn_max_lifetime", d.ConnMaxLifetime)
+	nonNegative("database.conn_max_idle_time", d.ConnMaxIdleTime)
+	if len(d.Replicas.URLs) > 0 {
+		if !strings.HasPrefix(d.URL, "postgres://") && !strings.HasPrefix(d.URL, "postgresql://") {
+			fail("database.replicas.urls", "replicas need a postgres:// database.url")
+		}
+		for i, u := range d.Replicas.URLs {
+			if !strings.HasPrefix(u, "postgres://") && !strings.HasPrefix(u, "postgresql://") {
+				fail(fmt.Sprintf("database.replicas.urls[%d]", i), "must be a postgres:// or postgresql:// URL")
+			}
+		}
+		nonNegative("database.replicas.read_your_writes", d.Replicas.ReadYourWrites)
+		positive("database.replicas.health_interval", d.Replicas.HealthInterval)
+	}
+	if rt := d.Retention; rt.MaxAge < 0 || rt.MaxPerUser < 0 {
+		fail("database.retention", "max_age and max_per_user must not be negative")
+	} else if rt.Enabled() {
+		positive("database.retention.interval", rt.Interval)
+		if rt.BatchSize <= 0 {
+			fail("database.retention.batch_size", "must be positive, got %d", rt.BatchSize)
+		}
+		nonNegative("database.retention.batch_pause", rt.BatchPause)
+	}
+	if ru := d.Rollups; ru.Enabled {
+		positive("database.rollups.interval", ru.Interval)
+		nonNegative("database.rollups.settle", ru.Settle)
+	}
+	if uc := d.UserCache; uc.Size < 0 {
+		fail("database.user_cache.size", "must not be negative, got %d", uc.Size)
+	} else if uc.Size > 0 {
+		positive("database.user_cache.ttl", uc.TTL)
+		nonNegative("database.user_cache.negative_ttl", uc.NegativeTTL)
+		if uc.Warmup < 0 || uc.Warmup > uc.Size {
+			fail("database.user_cache.warmup", "must be between 0 and size (%d), got %d", uc.Size, uc.Warmup)
+		}
+		if uc.Warmup > 0 {
+			positive("database.user_cache.warmup_window", uc.WarmupWindow)
+		}
+		switch uc.Invalidation {
+		case "auto", "local":
+		case "postgres":
+			if u := cmp.Or(d.ListenURL, d.URL); !strings.HasPrefix(u, "postgres://") && !strings.HasPrefix(u, "postgresql://") {
+				fail("database.user_cache.invalidation", "postgres needs a postgres:// database.url or database.listen_url")
+			}
+		default:
+			fail("database.user_cache.invalidation", "must be auto, postgres or local, got %q", uc.Invalidation)
+		}
+	}
+
+	seenKeys := make(map[string]bool)
+	for i, k := range c.Auth.APIKeys {
+		key := fmt.Sprintf("auth.api_keys[%d]", i)
+		if len(k.SHA256) != 64 || strings.Trim(strings.ToLower(k.SHA256), "0123456789abcdef") != "" {
+			fail(key+".sha256", "must be the 64 hex digit SHA-256 of the key")
+		}
+		if seenKeys[strings.ToLower(k.SHA256)] {
+			fail(key+".sha256", "duplicate key")
+		}
+		seenKeys[strings.ToLower(k.SHA256)] = true
+		if k.Name == "" {
+			fail(key+".name", "must not be empty")
+		}
+	}
+
+	if f := strings.ToLower(c.Log.Format); f != "json" && f != "text" {
+		fail("log.format", "unknown format %q (want json or text)", c.Log.Format)
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		fail("log.level", "%v", err)
+	}
+	for component, level := range c.Log.Levels {
+		if _, err := logging.ParseLevel(level); err != nil {
+			fail("log.levels."+component, "%v", err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// LoggingOptions converts the log section for logging.Setup.
+func (c *Config) LoggingOptions() logging.Options {
+	return logging.Options{
+		Format: c.Log.Format,
+		Level:  c.Log.Level,
+		Levels: c.Log.Levels,
+	}
+}
+
+// Report logs where the configuration came from and any problems found
+// while loading it. Call it once logging is set up.
+func (c *Config) Report(l *slog.Logger) {
+	l.Info("configuration loaded", "profile", c.Profile, "sources", c.Sources)
+	for _, w := range c.Warnings {
+		l.Warn(w)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	pb "grpc-example/proto"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// UserRequest names the user of a privacy request. Names go in the body
+// rather than the URL so they stay out of access logs.
+type UserRequest struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason,omitempty"` // erase-user only
+}
+
+// EraseUserResponse is the JSON form of EraseUserReply.
+type EraseUserResponse struct {
+	TombstoneID      string `json:"tombstoneId"`
+	UserID           string `json:"userId"`
+	GreetingsDeleted int64  `json:"greetingsDeleted"`
+	ErasedAt         string `json:"erasedAt"`
+	// ArchivedRedacted counts the greetings removed from retention archives.
+	ArchivedRedacted int64 `json:"archivedGreetingsRedacted"`
+}
+
+// decodeUserRequest - Reads the JSON body of a POST privacy request,
+// writing the error response itself when it fails
+func decodeUserRequest(w http.ResponseWriter, r *http.Request) (*UserRequest, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, http.StatusMethodNotAllowed, "%s is not allowed, use POST", r.Method)
+		return nil, false
+	}
+	var req UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "%v", err)
+		return nil, false
+	}
+	return &req, true
+}
+
+// POST /api/admin/export-user - Downloads Admin.ExportUserData as a JSON file
+func handleExportUserData(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeUserRequest(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel, err := withRequestTimeout(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "%v", err)
+		return
+	}
+	defer cancel()
+
+	stream, err := adminClient.ExportUserData(outgoingContext(ctx, r), &pb.ExportUserDataRequest{Name: req.Name})
+	if err != nil {
+		writeGRPCError(w, r, err)
+		return
+	}
+	// Errors are only reported properly before the first chunk; the server
+	// checks the scope and the user before sending anything
+	chunk, err := stream.Recv()
+	if err != nil {
+		writeGRPCError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="user-export.json"`)
+	for {
+		if _, err := w.Write(chunk.Data); err != nil {
+			return // client went away
+		}
+		chunk, err = stream.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			// Cut the response short so the truncated JSON cannot be
+			// mistaken for a complete export
+			log.ErrorContext(ctx, "export stream failed", "error", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// POST /api/admin/erase-user - Calls Admin.EraseUser
+func handleEraseUser(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeUserRequest(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel, err := withRequestTimeout(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "%v", err)
+		return
+	}
+	defer cancel()
+
+	reply, err := adminClient.EraseUser(outgoingContext(ctx, r), &pb.EraseUserRequest{Name: req.Name, Reason: req.Reason})
+	if err != nil {
+		writeGRPCError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EraseUserResponse{
+		TombstoneID:      reply.TombstoneId,
+		UserID:           reply.UserId,
+		GreetingsDeleted: reply.GreetingsDeleted,
+		ErasedAt:         rfc3339(reply.ErasedAt),
+		ArchivedRedacted: reply.ArchivedGreetingsRedacted,
+	})
+}
+
+// StatsRequest selects greeting stats. GET takes the fields as query
+// parameters (top for TopUsers); POST takes them as a JSON body, which keeps
+// a user name out of URLs.
+type StatsRequest struct {
+	Unit     string `json:"unit"`  // minute, hour (default) or day
+	From     string `json:"from"`  // RFC 3339
+	Until    string `json:"until"` // RFC 3339
+	User     string `json:"user"`
+	TopUsers int32  `json:"topUsers"`
+}
+
+// GreetingStatsResponse is the JSON form of GreetingStatsReply.
+type GreetingStatsResponse struct {
+	Unit            string        `json:"unit"`
+	From            string        `json:"from"`
+	Until           string        `json:"until"`
+	Total           int64         `json:"total"`
+	Buckets         []StatsBucket `json:"buckets"`
+	TopUsers        []StatsUser   `json:"topUsers"`
+	Batches         StatsBatches  `json:"batches"`
+	RolledUpThrough string        `json:"rolledUpThrough,omitempty"`
+}
+
+type StatsBucket struct {
+	Start     string `json:"start"`
+	Greetings int64  `json:"greetings"`
+}
+
+type StatsUser struct {
+	UserID    string `json:"userId"`
+	Name      string `json:"name"`
+	Greetings int64  `json:"greetings"`
+}
+
+type StatsBatches struct {
+	Batches   int64             `json:"batches"`
+	Greetings int64             `json:"greetings"`
+	MeanSize  float64           `json:"meanSize"`
+	MaxSize   int64             `json:"maxSize"`
+	Histogram []StatsBatchRange `json:"histogram"`
+}
+
+type StatsBatchRange struct {
+	MinSize int64 `json:"minSize"`
+	MaxSize int64 `json:"maxSize"`
+	Batches int64 `json:"batches"`
+}
+
+// statsUnits maps the unit names of StatsRequest to StatsUnit.
+var statsUnits = map[string]pb.StatsUnit{
+	"":       pb.StatsUnit_STATS_UNIT_UNSPECIFIED,
+	"minute": pb.StatsUnit_STATS_UNIT_MINUTE,
+	"hour":   pb.StatsUnit_STATS_UNIT_HOUR,
+	"day":    pb.StatsUnit_STATS_UNIT_DAY,
+}
+
+// statsUnitNames is the reverse of statsUnits.
+var statsUnitNames = map[pb.StatsUnit]string{
+	pb.StatsUnit_STATS_UNIT_MINUTE: "minute",
+	pb.StatsUnit_STATS_UNIT_HOUR:   "hour",
+	pb.StatsUnit_STATS_UNIT_DAY:    "day",
+}
+
+// decodeStatsRequest - Reads a StatsRequest from the query string or the
+// body and converts it, writing the error response itself when it fails
+func decodeStatsRequest(w http.ResponseWriter, r *http.Request) (*pb.GreetingStatsRequest, bool) {
+	var req StatsRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req = StatsRequest{Unit: q.Get("unit"), From: q.Get("from"), Until: q.Get("until"), User: q.Get("user")}
+		if top := q.Get("top"); top != "" {
+			n, err := strconv.ParseInt(top, 10, 32)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "top: %q is not a number", top)
+				return nil, false
+			}
+			req.TopUsers = int32(n)
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, "%v", err)
+			return nil, false
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, r, http.StatusMethodNotAllowed, "%s is not allowed, use GET or POST", r.Method)
+		return nil, false
+	}
+
+	unit, ok := statsUnits[req.Unit]
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "unit: %q is not minute, hour or day", req.Unit)
+		return nil, false
+	}
+	in := &pb.GreetingStatsRequest{Unit: unit, User: req.User, TopUsers: req.TopUsers}
+	for _, f := range []struct {
+		name, value string
+		ts          **timestamppb.Timestamp
+	}{{"from", req.From, &in.From}, {"until", req.Until, &in.Until}} {
+		if f.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, f.value)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "%s: %q is not an RFC 3339 time", f.name, f.value)
+			return nil, false
+		}
+		*f.ts = timestamppb.New(t)
+	}
+	return in, true
+}
+
+// GET or POST /api/admin/greeting-stats - Calls Admin.GetGreetingStats
+func handleGreetingStats(w http.ResponseWriter, r *http.Request) {
+	in, ok := decodeStatsRequest(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel, err := withRequestTimeout(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "%v", err)
+		return
+	}
+	defer cancel()
+
+	reply, err := adminClient.GetGreetingStats(outgoingContext(ctx, r), in)
+	if err != nil {
+		writeGRPCError(w, r, err)
+		return
+	}
+	resp := GreetingStatsResponse{
+		Unit:            statsUnitNames[reply.Unit],
+		From:            rfc3339(reply.From),
+		Until:           rfc3339(reply.Until),
+		Total:           reply.Total,
+		Buckets:         make([]StatsBucket, 0, len(reply.Buckets)),
+		TopUsers:        make([]StatsUser, 0, len(reply.TopUsers)),
+		RolledUpThrough: rfc3339(reply.RolledUpThrough),
+	}
+	for _, b := range reply.Buckets {
+		resp.Buckets = append(resp.Buckets, StatsBucket{Start: rfc3339(b.Start), Greetings: b.Greetings})
+	}
+	for _, u := range reply.TopUsers {
+		resp.TopUsers = append(resp.TopUsers, StatsUser{UserID: u.UserId, Name: u.Name, Greetings: u.Greetings})
+	}
+	b := reply.Batches
+	resp.Batches = StatsBatches{
+		Batches:   b.GetBatches(),
+		Greetings: b.GetGreetings(),
+		MeanSize:  b.GetMeanSize(),
+		MaxSize:   b.GetMaxSize(),
+		Histogram: make([]StatsBatchRange, 0, len(b.GetHistogram())),
+	}
+	for _, h := range b.GetHistogram() {
+		resp.Batches.Histogram = append(resp.Batches.Histogram, StatsBatchRange{MinSize: h.MinSize, MaxSize: h.MaxSize, Batches: h.Batches})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -1,49 +1,55 @@
 package main
 
 import (
-	"log"
-	"time"
+	"context"
+	"net"
+	"net/http"
 
-	pb "grpc-example/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"grpc-example/config"
+	"grpc-example/logging"
+	pb "grpc-example/proto"
 )
 
 var grpcClient pb.GreeterClient
+var adminClient pb.AdminClient
 var grpcConn *grpc.ClientConn
 
 // initGRPCConnection - Creates optimized gRPC connection with pooling
-func initGRPCConnection() error {
+func initGRPCConnection(cfg config.GatewayConfig) error {
 	var err error
-	
+
 	// ⚡ OPTIMIZATION: Connection pooling with keepalive
 	// This reuses connections instead of creating new ones for each request
-	grpcConn, err = grpc.Dial("localhost:8080",
+	grpcConn, err = grpc.Dial(cfg.Upstream,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		
+
 		// ⚡ Keepalive settings - keeps connection alive
 		grpc.WithKeepaliveParams(keepalive.ClientParameters{
-			Time:                30 * time.Second, // Send keepalive ping every 30s
-			Timeout:             5 * time.Second,  // Wait 5s for ping ack
-			PermitWithoutStream: true,             // Send pings even without active streams
+			Time:                cfg.Keepalive.Time,                // Keepalive ping interval
+			Timeout:             cfg.Keepalive.Timeout,             // Wait for ping ack
+			PermitWithoutStream: cfg.Keepalive.PermitWithoutStream, // Send pings even without active streams
 		}),
-		
+
 		// ⚡ Connection pool settings
-		grpc.WithInitialWindowSize(1 << 20),  // 1MB initial window
-		grpc.WithInitialConnWindowSize(1 << 20), // 1MB initial connection window
+		grpc.WithInitialWindowSize(cfg.WindowSize),     // Initial stream window
+		grpc.WithInitialConnWindowSize(cfg.WindowSize), // Initial connection window
 		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(4*1024*1024), // 4MB max receive
-			grpc.MaxCallSendMsgSize(4*1024*1024), // 4MB max send
+			grpc.MaxCallRecvMsgSize(cfg.MaxRecvMsgSize),
+			grpc.MaxCallSendMsgSize(cfg.MaxSendMsgSize),
 		),
 	)
-	
+
 	if err != nil {
 		return err
 	}
-	
+
 	grpcClient = pb.NewGreeterClient(grpcConn)
-	log.Println("✅ gRPC connection established with connection pooling")
+	adminClient = pb.NewAdminClient(grpcConn)
+	log.Info("gRPC connection established", "target", cfg.Upstream)
 	return nil
 }
 
@@ -51,11 +57,33 @@ func initGRPCConnection() error {
 func closeGRPCConnection() {
 	if grpcConn != nil {
 		if err := grpcConn.Close(); err != nil {
-			log.Printf("Error closing gRPC connection: %v", err)
+			log.Error("error closing gRPC connection", "error", err)
 		} else {
-			log.Println("✅ gRPC connection closed gracefully")
+			log.Info("gRPC connection closed gracefully")
 		}
 	}
 }
 
-
+// outgoingContext - Forwards the request and trace IDs, the caller's API key
+// and the client address (for server-side rate limiting) to the gRPC server
+func outgoingContext(ctx context.Context, r *http.Request) context.Context {
+	pairs := []string{logging.RequestIDHeader, logging.RequestID(ctx)}
+	if traceParent := r.Header.Get("traceparent"); traceParent != "" {
+		pairs = append(pairs, logging.TraceParentKey, traceParent)
+	}
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		pairs = append(pairs, "x-api-key", apiKey)
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		pairs = append(pairs, "authorization", auth)
+	}
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		clientIP = forwarded + ", " + clientIP
+	}
+	pairs = append(pairs, "x-forwarded-for", clientIP)
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
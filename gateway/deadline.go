@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RequestTimeoutHeader lets HTTP clients ask for a timeout, as a Go
+// duration ("750ms", "5s") or a number of seconds.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// grpcTimeoutUnits maps the unit suffixes of the gRPC wire format
+// ("100m", "5S", ...) to durations.
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// requestTimeout returns the timeout the client asked for through the
+// grpc-timeout or X-Request-Timeout header, capped at
+// gateway.max_request_timeout. ok is false when neither header is set.
+func requestTimeout(r *http.Request) (timeout time.Duration, ok bool, err error) {
+	if v := r.Header.Get("grpc-timeout"); v != "" {
+		timeout, err = parseGRPCTimeout(v)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid grpc-timeout header: %w", err)
+		}
+	} else if v := r.Header.Get(RequestTimeoutHeader); v != "" {
+		if timeout, err = time.ParseDuration(v); err != nil {
+			seconds, perr := strconv.ParseFloat(v, 64)
+			if perr != nil || math.IsNaN(seconds) {
+				return 0, false, fmt.Errorf("invalid %s header: %q is not a duration", RequestTimeoutHeader, v)
+			}
+			// Out of range, the conversion would wrap; anything that long is
+			// capped below anyway
+			timeout, err = time.Duration(math.MaxInt64), nil
+			if ns := seconds * float64(time.Second); ns < math.MaxInt64 {
+				timeout = time.Duration(ns)
+			}
+		}
+	} else {
+		return 0, false, nil
+	}
+	if timeout <= 0 {
+		return 0, false, fmt.Errorf("request timeout must be positive, got %s", timeout)
+	}
+	if limit := settings.Current().Gateway.MaxRequestTimeout; timeout > limit {
+		timeout = limit
+	}
+	return timeout, true, nil
+}
+
+// parseGRPCTimeout parses a grpc-timeout value: up to 8 digits followed by
+// one of the units H, M, S, m, u or n. Values beyond the range of a
+// time.Duration (e.g. 99999999H) saturate rather than wrap around.
+func parseGRPCTimeout(v string) (time.Duration, error) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, fmt.Errorf("%q is not a gRPC timeout", v)
+	}
+	unit, ok := grpcTimeoutUnits[v[len(v)-1]]
+	if !ok {
+		return 0, fmt.Errorf("%q has an unknown unit", v)
+	}
+	n, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a gRPC timeout", v)
+	}
+	if n > uint64(math.MaxInt64/unit) {
+		return math.MaxInt64, nil
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// withRequestTimeout - Derives the context of the upstream call from the
+// client's requested timeout, or gateway.request_timeout without one. The
+// deadline is passed on to the server as grpc-timeout by the gRPC client.
+func withRequestTimeout(r *http.Request) (context.Context, context.CancelFunc, error) {
+	timeout, ok, err := requestTimeout(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		timeout = settings.Current().Gateway.RequestTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return ctx, cancel, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"grpc-example/config"
+	"grpc-example/logging"
+)
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "2H", want: 2 * time.Hour},
+		{in: "3M", want: 3 * time.Minute},
+		{in: "5S", want: 5 * time.Second},
+		{in: "100m", want: 100 * time.Millisecond},
+		{in: "250u", want: 250 * time.Microsecond},
+		{in: "12345678n", want: 12345678 * time.Nanosecond},
+		{in: "0S", want: 0},
+		// 99999999 hours does not fit in a time.Duration
+		{in: "99999999H", want: math.MaxInt64},
+		{in: "", wantErr: true},
+		{in: "S", wantErr: true},
+		{in: "5", wantErr: true},
+		{in: "123456789S", wantErr: true},
+		{in: "5s", wantErr: true},
+		{in: "5X", wantErr: true},
+		{in: "-5S", wantErr: true},
+		{in: "+5S", wantErr: true},
+		{in: "1.5S", wantErr: true},
+		{in: " 5S", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseGRPCTimeout(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseGRPCTimeout(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseGRPCTimeout(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	cfg := config.Defaults("dev")
+	cfg.Gateway.MaxRequestTimeout = time.Minute
+	settings = config.NewReloader(cfg, nil, logging.For("config"))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+		wantOK  bool
+		wantErr bool
+	}{
+		{name: "no header"},
+		{name: "grpc-timeout", headers: map[string]string{"grpc-timeout": "1500m"}, want: 1500 * time.Millisecond, wantOK: true},
+		{name: "Go duration", headers: map[string]string{RequestTimeoutHeader: "750ms"}, want: 750 * time.Millisecond, wantOK: true},
+		{name: "bare seconds", headers: map[string]string{RequestTimeoutHeader: "2.5"}, want: 2500 * time.Millisecond, wantOK: true},
+		{name: "grpc-timeout wins", headers: map[string]string{"grpc-timeout": "3S", RequestTimeoutHeader: "10s"}, want: 3 * time.Second, wantOK: true},
+		{name: "capped duration", headers: map[string]string{RequestTimeoutHeader: "2h"}, want: time.Minute, wantOK: true},
+		{name: "capped grpc-timeout", headers: map[string]string{"grpc-timeout": "5H"}, want: time.Minute, wantOK: true},
+		{name: "overflowing grpc-timeout", headers: map[string]string{"grpc-timeout": "99999999H"}, want: time.Minute, wantOK: true},
+		{name: "overflowing seconds", headers: map[string]string{RequestTimeoutHeader: "1e300"}, want: time.Minute, wantOK: true},
+		{name: "infinite seconds", headers: map[string]string{RequestTimeoutHeader: "Inf"}, want: time.Minute, wantOK: true},
+		{name: "zero grpc-timeout", headers: map[string]string{"grpc-timeout": "0S"}, wantErr: true},
+		{name: "zero duration", headers: map[string]string{RequestTimeoutHeader: "0s"}, wantErr: true},
+		{name: "negative duration", headers: map[string]string{RequestTimeoutHeader: "-5s"}, wantErr: true},
+		{name: "negative seconds", headers: map[string]string{RequestTimeoutHeader: "-1"}, wantErr: true},
+		{name: "NaN seconds", headers: map[string]string{RequestTimeoutHeader: "NaN"}, wantErr: true},
+		{name: "garbage", headers: map[string]string{RequestTimeoutHeader: "soon"}, wantErr: true},
+		{name: "bad grpc-timeout", headers: map[string]string{"grpc-timeout": "5 seconds"}, wantErr: true},
+		// An invalid grpc-timeout is not papered over by X-Request-Timeout
+		{name: "bad grpc-timeout with fallback", headers: map[string]string{"grpc-timeout": "5X", RequestTimeoutHeader: "5s"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/v1/greeter/hello", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			got, ok, err := requestTimeout(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("requestTimeout = %v, %v; want an error", got, ok)
+				}
+				return
+			}
+			if err != nil || ok != tt.wantOK || got != tt.want {
+				t.Fatalf("requestTimeout = %v, %v, %v; want %v, %v", got, ok, err, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
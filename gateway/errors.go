@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"grpc-example/logging"
+
+	"github.com/gorilla/websocket"
+	rpccode "google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// problemContentType is the media type of RFC 7807 error bodies.
+const problemContentType = "application/problem+json"
+
+// statusClientClosedRequest is the de facto status of a call the client
+// cancelled (there is no standard one).
+const statusClientClosedRequest = 499
+
+// httpStatuses maps gRPC codes to HTTP statuses, following google.rpc.Code
+// and grpc-gateway.
+var httpStatuses = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           statusClientClosedRequest,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// httpStatus returns the HTTP status for a gRPC code.
+func httpStatus(c codes.Code) int {
+	if s, ok := httpStatuses[c]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// problem is an RFC 7807 problem details document. Besides the standard
+// members it carries the gRPC code, the request ID and, for upstream
+// errors, the google.rpc status details.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// RetryAfter repeats the Retry-After header in seconds, for SSE and
+	// WebSocket clients that cannot see headers.
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Violations flattens google.rpc.BadRequest for convenience.
+	Violations []fieldViolation `json:"violations,omitempty"`
+	// Details are the status details in their protobuf JSON form.
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+// fieldViolation is one entry of a problem's "violations".
+type fieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// newProblem describes an error with the given HTTP status.
+func newProblem(r *http.Request, code int, detail string) *problem {
+	title := http.StatusText(code)
+	if code == statusClientClosedRequest {
+		title = "Client Closed Request"
+	}
+	requestID := logging.RequestID(r.Context())
+	if requestID == "" {
+		requestID = r.Header.Get("X-Request-ID")
+	}
+	return &problem{
+		Type:      "about:blank",
+		Title:     title,
+		Status:    code,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: requestID,
+	}
+}
+
+// problemFromError translates a failed upstream call. Errors that are not
+// gRPC statuses are reported as UNKNOWN (500).
+func problemFromError(r *http.Request, err error) *problem {
+	st := status.Convert(err)
+	p := newProblem(r, httpStatus(st.Code()), st.Message())
+	p.Code = rpccode.Code(st.Code()).String()
+
+	for _, d := range st.Proto().GetDetails() {
+		if raw, err := protojson.Marshal(d); err == nil {
+			p.Details = append(p.Details, raw)
+		}
+	}
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				p.Violations = append(p.Violations, fieldViolation{Field: v.GetField(), Description: v.GetDescription()})
+			}
+		case *errdetails.RetryInfo:
+			if d.GetRetryDelay() != nil {
+				p.RetryAfter = retryAfterSeconds(d.GetRetryDelay().AsDuration())
+			}
+		}
+	}
+	return p
+}
+
+// retryAfterSeconds rounds a retry delay up to whole seconds, at least 1.
+func retryAfterSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
+
+// writeProblem - Sends p as an application/problem+json response, with
+// Retry-After when the problem carries a retry delay
+func writeProblem(w http.ResponseWriter, p *problem) {
+	if p.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(p.RetryAfter))
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// writeGRPCError - Reports a failed upstream call with the HTTP status that
+// matches its gRPC code
+func writeGRPCError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problemFromError(r, err)
+	if p.Status >= http.StatusInternalServerError {
+		log.WarnContext(r.Context(), "upstream call failed", "path", r.URL.Path, "status", p.Status, "code", p.Code, "detail", p.Detail)
+	}
+	writeProblem(w, p)
+}
+
+// writeError - Reports an error detected by the gateway itself
+func writeError(w http.ResponseWriter, r *http.Request, code int, format string, args ...any) {
+	writeProblem(w, newProblem(r, code, fmt.Sprintf(format, args...)))
+}
+
+// writeSSEError - Reports a failure after an SSE stream has started, as an
+// "error" event carrying the problem document
+func writeSSEError(w http.ResponseWriter, flusher http.Flusher, r *http.Request, err error) {
+	data, _ := json.Marshal(problemFromError(r, err))
+	fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+	flusher.Flush()
+}
+
+// writeWebSocketError - Sends an error frame {"error": <problem>} on a
+// WebSocket
+func writeWebSocketError(ws *websocket.Conn, p *problem) error {
+	return ws.WriteJSON(map[string]any{"error": p})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// withDetails returns a status error with code and details.
+func withDetails(t *testing.T, code codes.Code, msg string, details ...*errdetails.RetryInfo) error {
+	t.Helper()
+	st := status.New(code, msg)
+	for _, d := range details {
+		var err error
+		if st, err = st.WithDetails(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st.Err()
+}
+
+func TestWriteGRPCError(t *testing.T) {
+	badRequest, err := status.New(codes.InvalidArgument, "invalid HelloRequest: name is required").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "name", Description: "is required"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		code       string
+		title      string
+		retryAfter string // Retry-After header, "" for none
+		violations int
+	}{
+		{"invalid argument", badRequest.Err(), http.StatusBadRequest, "INVALID_ARGUMENT", "Bad Request", "", 1},
+		{"not found", status.Error(codes.NotFound, "no such user"), http.StatusNotFound, "NOT_FOUND", "Not Found", "", 0},
+		{"permission denied", status.Error(codes.PermissionDenied, "no"), http.StatusForbidden, "PERMISSION_DENIED", "Forbidden", "", 0},
+		{"unauthenticated", status.Error(codes.Unauthenticated, "key"), http.StatusUnauthorized, "UNAUTHENTICATED", "Unauthorized", "", 0},
+		{"resource exhausted", withDetails(t, codes.ResourceExhausted, "quota", &errdetails.RetryInfo{RetryDelay: durationpb.New(30 * time.Second)}),
+			http.StatusTooManyRequests, "RESOURCE_EXHAUSTED", "Too Many Requests", "30", 0},
+		{"shed", withDetails(t, codes.Unavailable, "overloaded", &errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)}),
+			http.StatusServiceUnavailable, "UNAVAILABLE", "Service Unavailable", "2", 0},
+		{"unavailable without hint", status.Error(codes.Unavailable, "down"), http.StatusServiceUnavailable, "UNAVAILABLE", "Service Unavailable", "", 0},
+		{"deadline", status.Error(codes.DeadlineExceeded, "slow"), http.StatusGatewayTimeout, "DEADLINE_EXCEEDED", "Gateway Timeout", "", 0},
+		{"cancelled", status.Error(codes.Canceled, "gone"), statusClientClosedRequest, "CANCELLED", "Client Closed Request", "", 0},
+		{"unimplemented", status.Error(codes.Unimplemented, "disabled"), http.StatusNotImplemented, "UNIMPLEMENTED", "Not Implemented", "", 0},
+		{"not a status", errors.New("connection reset"), http.StatusInternalServerError, "UNKNOWN", "Internal Server Error", "", 0},
+		{"unknown code", status.Error(codes.Code(99), "odd"), http.StatusInternalServerError, "99", "Internal Server Error", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/server-stream?name=ann", nil)
+			r.Header.Set("X-Request-ID", "req-1")
+			w := httptest.NewRecorder()
+			writeGRPCError(w, r, tt.err)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != problemContentType {
+				t.Fatalf("Content-Type = %q, want %q", ct, problemContentType)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Fatalf("Retry-After = %q, want %q", got, tt.retryAfter)
+			}
+			var p problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("body %q: %v", w.Body, err)
+			}
+			if p.Type != "about:blank" || p.Status != tt.status || p.Title != tt.title || p.Code != tt.code ||
+				p.Instance != "/api/server-stream" || p.RequestID != "req-1" || p.Detail != status.Convert(tt.err).Message() {
+				t.Fatalf("problem = %+v", p)
+			}
+			if tt.retryAfter != "" && w.Header().Get("Retry-After") != strconv.Itoa(p.RetryAfter) {
+				t.Fatalf("retry_after = %d, Retry-After = %s", p.RetryAfter, w.Header().Get("Retry-After"))
+			}
+			if len(p.Violations) != tt.violations || len(p.Details) != len(status.Convert(tt.err).Details()) {
+				t.Fatalf("violations = %+v, details = %s", p.Violations, p.Details)
+			}
+			if tt.violations > 0 && (p.Violations[0].Field != "name" || p.Violations[0].Description != "is required") {
+				t.Fatalf("violations = %+v", p.Violations)
+			}
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/unary", nil)
+	w := httptest.NewRecorder()
+	writeError(w, r, http.StatusNotImplemented, "%s has been disabled", "/helloworld.Greeter/SayHello")
+	var p problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotImplemented || p.Status != w.Code || p.Code != "" || p.Title != "Not Implemented" ||
+		p.Detail != "/helloworld.Greeter/SayHello has been disabled" || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("%d %+v", w.Code, p)
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  int
+	}{
+		{0, 1},
+		{-time.Second, 1},
+		{time.Millisecond, 1},
+		{time.Second, 1},
+		{1001 * time.Millisecond, 2},
+		{90 * time.Second, 90},
+	}
+	for _, tt := range tests {
+		if got := retryAfterSeconds(tt.delay); got != tt.want {
+			t.Errorf("retryAfterSeconds(%v) = %d, want %d", tt.delay, got, tt.want)
+		}
+	}
+}
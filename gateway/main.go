@@ -5,19 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
+	"grpc-example/config"
+	"grpc-example/logging"
 	pb "grpc-example/proto"
 
 	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+var log = logging.For("gateway")
+
+// settings holds the live configuration; reloadable values (origins, rate
+// limits, kill switches, log levels) must be read through settings.Current()
+var settings *config.Reloader
+
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 2 * time.Second
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // Allow all origins for demo
@@ -30,63 +40,128 @@ type UnaryRequest struct {
 
 type UnaryResponse struct {
 	Message string `json:"message"`
+	// CreatedAt is when the server recorded the greetings (client stream)
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+// rfc3339 formats a protobuf timestamp for JSON responses, in UTC; unset
+// timestamps become "".
+func rfc3339(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.AsTime().UTC().Format(time.RFC3339Nano)
 }
 
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := logging.Setup(cfg.LoggingOptions()); err != nil {
+		logging.Fatal(log, "invalid logging configuration", "error", err)
+	}
+	cfg.Report(log)
+
+	globalRateLimiter = newRateLimiter(cfg.Gateway.RateLimit.RPS, cfg.Gateway.RateLimit.Burst)
+
+	// ⚡ Live reload without dropping WebSocket/SSE clients (SIGHUP or file change)
+	settings = config.NewReloader(cfg, os.Args[1:], logging.For("config"))
+	settings.OnReload(func(old, cur *config.Config) {
+		if err := logging.SetLevels(cur.Log.Level, cur.Log.Levels); err != nil {
+			log.Error("could not apply log levels", "error", err)
+		}
+		if old.Gateway.RateLimit != cur.Gateway.RateLimit {
+			globalRateLimiter.setLimit(cur.Gateway.RateLimit.RPS, cur.Gateway.RateLimit.Burst)
+		}
+	})
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	go settings.Run(reloadCtx, configPollInterval)
+
 	// ⚡ Initialize optimized gRPC connection with pooling
-	if err := initGRPCConnection(); err != nil {
-		log.Fatalf("Failed to connect to gRPC server: %v", err)
+	if err := initGRPCConnection(cfg.Gateway); err != nil {
+		logging.Fatal(log, "failed to connect to gRPC server", "error", err)
 	}
 	defer closeGRPCConnection()
-	
+
 	// Create HTTP server with optimizations
 	srv := &http.Server{
-		Addr:         ":8081",
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
-		MaxHeaderBytes: 1 << 20, // 1MB
+		Addr:           cfg.Gateway.ListenAddr,
+		ReadTimeout:    cfg.Gateway.ReadTimeout,
+		WriteTimeout:   cfg.Gateway.WriteTimeout,
+		IdleTimeout:    cfg.Gateway.IdleTimeout,
+		MaxHeaderBytes: cfg.Gateway.MaxHeaderBytes,
 	}
-	
+
 	// ⚡ Apply middleware chain: Rate Limit → Gzip → CORS → Logger → Handler
-	http.HandleFunc("/api/unary", 
+	http.HandleFunc("/api/unary",
 		rateLimitMiddleware(
 			enableGzip(
 				enableCORS(
-					requestLogger(handleUnary),
+					requestLogger(killSwitch(pb.Greeter_SayHello_FullMethodName, handleUnary)),
 				),
 			),
 		),
 	)
-	
-	http.HandleFunc("/api/server-stream", 
+
+	http.HandleFunc("/api/server-stream",
 		rateLimitMiddleware(
 			enableCORS(
-				requestLogger(handleServerStream),
+				requestLogger(killSwitch(pb.Greeter_SayHelloServerStream_FullMethodName, handleServerStream)),
 			),
 		),
 	)
-	
-	http.HandleFunc("/api/client-stream", 
+
+	http.HandleFunc("/api/client-stream",
 		rateLimitMiddleware(
 			enableGzip(
 				enableCORS(
-					requestLogger(handleClientStream),
+					requestLogger(killSwitch(pb.Greeter_SayHelloClientStream_FullMethodName, handleClientStream)),
 				),
 			),
 		),
 	)
-	
-	http.HandleFunc("/api/bidirectional", 
+
+	http.HandleFunc("/api/bidirectional",
+		rateLimitMiddleware(
+			enableCORS(
+				requestLogger(killSwitch(pb.Greeter_SayHelloBidirectional_FullMethodName, handleBidirectional)),
+			),
+		),
+	)
+
+	// Privacy requests; the server requires an API key with the admin scope
+	http.HandleFunc("/api/admin/export-user",
+		rateLimitMiddleware(
+			enableCORS(
+				requestLogger(killSwitch(pb.Admin_ExportUserData_FullMethodName, handleExportUserData)),
+			),
+		),
+	)
+
+	http.HandleFunc("/api/admin/erase-user",
 		rateLimitMiddleware(
 			enableCORS(
-				requestLogger(handleBidirectional),
+				requestLogger(killSwitch(pb.Admin_EraseUser_FullMethodName, handleEraseUser)),
 			),
 		),
 	)
-	
+
+	// Greeting analytics from the server's rollups (admin scope)
+	http.HandleFunc("/api/admin/greeting-stats",
+		rateLimitMiddleware(
+			enableGzip(
+				enableCORS(
+					requestLogger(killSwitch(pb.Admin_GetGreetingStats_FullMethodName, handleGreetingStats)),
+				),
+			),
+		),
+	)
+
 	// Health check endpoint with CORS
-	http.HandleFunc("/health", 
+	http.HandleFunc("/health",
 		enableCORS(
 			func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
@@ -94,149 +169,171 @@ func main() {
 			},
 		),
 	)
-	
-	log.Println("🚀 HTTP Gateway (API) running on http://localhost:8081")
-	log.Println("📡 Connected to gRPC server on localhost:8080 with connection pooling")
-	log.Println("⚡ Optimizations: Gzip, Rate Limiting, Connection Pooling, Request Logging")
-	log.Println("🔗 CORS enabled for Next.js on http://localhost:3000")
-	
+
+	log.Info("HTTP gateway running",
+		"addr", srv.Addr,
+		"upstream", cfg.Gateway.Upstream,
+		"allowed_origins", cfg.Gateway.AllowedOrigins,
+		"rate_limit_rps", cfg.Gateway.RateLimit.RPS,
+		"rate_limit_burst", cfg.Gateway.RateLimit.Burst,
+	)
+
 	// ⚡ Graceful shutdown
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed: %v", err)
+			logging.Fatal(log, "server failed", "error", err)
 		}
 	}()
-	
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
-	
-	log.Println("🛑 Shutting down server gracefully...")
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	log.Info("shutting down server gracefully")
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Gateway.ShutdownTimeout)
 	defer cancel()
-	
+
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		logging.Fatal(log, "server forced to shutdown", "error", err)
 	}
-	
-	log.Println("✅ Server exited gracefully")
+
+	log.Info("server exited gracefully")
 }
 
 // CORS middleware - configured for Next.js
 func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Allow Next.js frontend (port 3000) and any localhost
 		origin := r.Header.Get("Origin")
-		
-		// Allow localhost origins for development
-		if origin != "" && (origin == "http://localhost:3000" || 
-			origin == "http://localhost:3001" ||
-			strings.HasPrefix(origin, "http://localhost:") ||
-			strings.HasPrefix(origin, "http://127.0.0.1:")) {
+
+		// Echo back configured origins (gateway.allowed_origins). Other
+		// cross-origin requests get no CORS headers and are blocked by the browser.
+		if origin != "" && config.OriginAllowed(settings.Current().Gateway.AllowedOrigins, origin) {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 		} else if origin == "" {
 			// Same-origin request, allow it
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-		} else {
-			// Default to allowing localhost:3000
-			w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
 		}
-		
+
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, Origin")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID, X-Request-Timeout, X-Requested-With, Accept, Origin, traceparent, grpc-timeout")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Type")
-		
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Type, X-Request-ID, Retry-After")
+
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		
+
 		next(w, r)
 	}
 }
 
 // 1. UNARY RPC - POST /api/unary
-// ⛔ DISABLED: This endpoint has been disabled
+// ⛔ Disabled by default via the gateway.disabled_methods kill switch
 func handleUnary(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[HTTP Gateway] ⛔ Unary API access blocked - Service disabled")
-	
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusServiceUnavailable)
-	
-	errorResp := map[string]string{
-		"error":   "Service Unavailable",
-		"message": "Unary API endpoint has been disabled",
-		"status":  "503",
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, http.StatusMethodNotAllowed, "%s is not allowed, use POST", r.Method)
+		return
+	}
+
+	var req UnaryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "%v", err)
+		return
 	}
-	json.NewEncoder(w).Encode(errorResp)
+
+	ctx, cancel, err := withRequestTimeout(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "%v", err)
+		return
+	}
+	defer cancel()
+
+	grpcResp, err := grpcClient.SayHello(outgoingContext(ctx, r), &pb.HelloRequest{Name: req.Name})
+	if err != nil {
+		writeGRPCError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UnaryResponse{Message: grpcResp.Message})
 }
 
 // 2. SERVER STREAMING RPC - GET /api/server-stream?name=xxx
 // Uses Server-Sent Events (SSE)
 func handleServerStream(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, r, http.StatusMethodNotAllowed, "%s is not allowed, use GET", r.Method)
 		return
 	}
-	
+
 	name := r.URL.Query().Get("name")
 	if name == "" {
 		name = "Guest"
 	}
-	
-	log.Printf("[HTTP Gateway] Server streaming request: %s", name)
-	
+
+	log.InfoContext(r.Context(), "server streaming request", "name", name)
+
 	// Set SSE headers (CORS is already handled by middleware, but ensure it's set)
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	
-	// Ensure CORS headers for SSE (middleware should have set this, but double-check)
-	origin := r.Header.Get("Origin")
-	if origin != "" && (origin == "http://localhost:3000" || 
-		origin == "http://localhost:3001" ||
-		strings.HasPrefix(origin, "http://localhost:") ||
-		strings.HasPrefix(origin, "http://127.0.0.1:")) {
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-	} else {
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
-	}
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	
+
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, "streaming unsupported")
 		return
 	}
-	
+
 	// ⚡ Use request context with timeout (better resource management)
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	ctx, cancel, err := withRequestTimeout(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "%v", err)
+		return
+	}
 	defer cancel()
-	
-	stream, err := grpcClient.SayHelloServerStream(ctx, &pb.HelloRequest{Name: name})
+
+	stream, err := grpcClient.SayHelloServerStream(outgoingContext(ctx, r), &pb.HelloRequest{Name: name})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeGRPCError(w, r, err)
 		return
 	}
-	
+
 	// Stream messages to client
-	for {
+	for sent := 0; ; sent++ {
 		msg, err := stream.Recv()
 		if err == io.EOF {
 			fmt.Fprintf(w, "event: done\ndata: {\"message\": \"Stream complete\"}\n\n")
 			flusher.Flush()
 			break
 		}
+		if err != nil && sent == 0 {
+			// Nothing streamed yet, so the failure can still be a proper
+			// HTTP error (e.g. 503 when the server is shedding load)
+			writeGRPCError(w, r, err)
+			break
+		}
 		if err != nil {
-			log.Printf("Stream error: %v", err)
+			log.ErrorContext(ctx, "stream error", "error", err)
+			writeSSEError(w, flusher, r, err)
 			break
 		}
-		
-		data := map[string]string{"message": msg.Message}
+
+		data := map[string]any{"message": msg.Message}
+		if msg.GoingAway {
+			// The server is draining: forward its notice as its own event
+			// so EventSource clients can reconnect
+			data["going_away"] = true
+			jsonData, _ := json.Marshal(data)
+			fmt.Fprintf(w, "event: going_away\ndata: %s\n\n", jsonData)
+			flusher.Flush()
+			continue
+		}
 		jsonData, _ := json.Marshal(data)
 		fmt.Fprintf(w, "data: %s\n\n", jsonData)
 		flusher.Flush()
@@ -246,142 +343,160 @@ func handleServerStream(w http.ResponseWriter, r *http.Request) {
 // 3. CLIENT STREAMING RPC - POST /api/client-stream
 func handleClientStream(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, http.StatusMethodNotAllowed, "%s is not allowed, use POST", r.Method)
 		return
 	}
-	
+
 	var names []string
 	if err := json.NewDecoder(r.Body).Decode(&names); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "%v", err)
 		return
 	}
-	
-	log.Printf("[HTTP Gateway] Client streaming request with %d names", len(names))
-	
+
+	log.InfoContext(r.Context(), "client streaming request", "count", len(names))
+
 	// ⚡ Use request context with timeout
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	ctx, cancel, err := withRequestTimeout(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "%v", err)
+		return
+	}
 	defer cancel()
-	
-	stream, err := grpcClient.SayHelloClientStream(ctx)
+
+	stream, err := grpcClient.SayHelloClientStream(outgoingContext(ctx, r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeGRPCError(w, r, err)
 		return
 	}
-	
+
 	// Send all names
 	for _, name := range names {
 		if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			// The call failed; CloseAndRecv reports why
+			break
 		}
 	}
-	
+
 	// Get response
 	grpcResp, err := stream.CloseAndRecv()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeGRPCError(w, r, err)
 		return
 	}
-	
-	resp := UnaryResponse{Message: grpcResp.Message}
+
+	resp := UnaryResponse{Message: grpcResp.Message, CreatedAt: rfc3339(grpcResp.CreatedAt)}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
 // 4. BIDIRECTIONAL STREAMING RPC - WebSocket /api/bidirectional
 func handleBidirectional(w http.ResponseWriter, r *http.Request) {
+	timeout, hasTimeout, err := requestTimeout(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "%v", err)
+		return
+	}
+
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		log.ErrorContext(r.Context(), "websocket upgrade failed", "error", err)
 		return
 	}
 	defer ws.Close()
-	
-	log.Println("[HTTP Gateway] ✅ Bidirectional WebSocket connection established")
-	
+
+	log.InfoContext(r.Context(), "bidirectional websocket connection established")
+
 	// Send initial connection message
 	ws.WriteJSON(map[string]string{"message": "Connected to server!"})
-	
-	// ⚡ Use request context for better cancellation
+
+	// ⚡ Use request context for better cancellation. Chat sessions have no
+	// timeout unless the client asked for one.
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
-	
-	stream, err := grpcClient.SayHelloBidirectional(ctx)
+	if hasTimeout {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	stream, err := grpcClient.SayHelloBidirectional(outgoingContext(ctx, r))
 	if err != nil {
-		log.Printf("❌ gRPC stream error: %v", err)
+		log.ErrorContext(ctx, "gRPC stream error", "error", err)
 		// Send error to client before closing
-		ws.WriteJSON(map[string]string{"error": fmt.Sprintf("Failed to connect to gRPC server: %v", err)})
+		writeWebSocketError(ws, problemFromError(r, err))
 		return
 	}
-	
-	log.Println("[HTTP Gateway] ✅ gRPC bidirectional stream created")
-	
+
+	log.DebugContext(ctx, "gRPC bidirectional stream created")
+
 	// Channel to signal when goroutine exits
 	done := make(chan bool, 1)
-	
+
 	// Goroutine to receive from gRPC and send to WebSocket
 	go func() {
 		defer func() {
 			done <- true
 		}()
-		
+
 		for {
 			grpcResp, err := stream.Recv()
 			if err == io.EOF {
-				log.Println("[HTTP Gateway] gRPC stream closed (EOF)")
+				log.InfoContext(ctx, "gRPC stream closed (EOF)")
 				ws.WriteJSON(map[string]string{"message": "Stream ended"})
 				return
 			}
 			if err != nil {
-				log.Printf("❌ gRPC receive error: %v", err)
-				ws.WriteJSON(map[string]string{"error": fmt.Sprintf("gRPC receive error: %v", err)})
+				log.ErrorContext(ctx, "gRPC receive error", "error", err)
+				writeWebSocketError(ws, problemFromError(r, err))
 				return
 			}
-			
-			data := map[string]string{"message": grpcResp.Message}
+
+			data := map[string]any{"message": grpcResp.Message}
+			if grpcResp.GoingAway {
+				data["going_away"] = true
+			}
 			if err := ws.WriteJSON(data); err != nil {
-				log.Printf("❌ WebSocket write error: %v", err)
+				log.ErrorContext(ctx, "websocket write error", "error", err)
 				return
 			}
 		}
 	}()
-	
+
 	// Receive from WebSocket and send to gRPC
 	for {
 		var msg map[string]string
 		if err := ws.ReadJSON(&msg); err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("❌ WebSocket unexpected close: %v", err)
+				log.WarnContext(ctx, "websocket unexpected close", "error", err)
 			} else {
-				log.Printf("[HTTP Gateway] WebSocket closed by client")
+				log.InfoContext(ctx, "websocket closed by client")
 			}
 			break
 		}
-		
+
 		name := msg["name"]
 		if name == "" {
 			continue
 		}
-		
-		log.Printf("[HTTP Gateway] 📨 Received message: %s", name)
-		
+
+		log.DebugContext(ctx, "received message", "name", name)
+
 		if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil {
-			log.Printf("❌ gRPC send error: %v", err)
-			ws.WriteJSON(map[string]string{"error": fmt.Sprintf("Failed to send message: %v", err)})
+			log.ErrorContext(ctx, "gRPC send error", "error", err)
+			// The receive goroutine reports the stream's status
 			break
 		}
 	}
-	
+
 	// Cancel context and close stream
 	cancel()
 	stream.CloseSend()
-	
+
 	// Wait for goroutine to finish (with timeout)
 	select {
 	case <-done:
-		log.Println("[HTTP Gateway] ✅ Bidirectional stream closed cleanly")
+		log.InfoContext(ctx, "bidirectional stream closed cleanly")
 	case <-time.After(2 * time.Second):
-		log.Println("[HTTP Gateway] ⚠️  Timeout waiting for goroutine to finish")
+		log.WarnContext(ctx, "timeout waiting for goroutine to finish")
 	}
 }
-
@@ -3,13 +3,15 @@ package main
 import (
 	"bufio"
 	"compress/gzip"
-	"log"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
+	"grpc-example/config"
+	"grpc-example/logging"
+
 	"golang.org/x/time/rate"
 )
 
@@ -60,7 +62,7 @@ type rateLimiter struct {
 	burst    int
 }
 
-func newRateLimiter(rps int, burst int) *rateLimiter {
+func newRateLimiter(rps float64, burst int) *rateLimiter {
 	return &rateLimiter{
 		limiters: make(map[string]*rate.Limiter),
 		rate:     rate.Limit(rps),
@@ -83,8 +85,21 @@ func (rl *rateLimiter) getLimiter(ip string) *rate.Limiter {
 	return limiter
 }
 
-// Global rate limiter: 100 requests/second, burst of 200
-var globalRateLimiter = newRateLimiter(100, 200)
+// setLimit - Applies new rate limiter parameters to every client, including
+// clients that already have a limiter
+func (rl *rateLimiter) setLimit(rps float64, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.rate = rate.Limit(rps)
+	rl.burst = burst
+	for _, limiter := range rl.limiters {
+		limiter.SetLimit(rl.rate)
+		limiter.SetBurst(burst)
+	}
+}
+
+// Global rate limiter, sized from gateway.rate_limit in main
+var globalRateLimiter *rateLimiter
 
 // rateLimitMiddleware - Prevents abuse and ensures fair usage
 func rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
@@ -95,8 +110,12 @@ func rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		limiter := globalRateLimiter.getLimiter(ip)
-		if !limiter.Allow() {
-			http.Error(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
+		reservation := limiter.Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			p := newProblem(r, http.StatusTooManyRequests, "rate limit exceeded, please try again later")
+			p.RetryAfter = retryAfterSeconds(delay)
+			writeProblem(w, p)
 			return
 		}
 
@@ -104,26 +123,59 @@ func rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// requestLogger - Logs request timing and status
+// killSwitch - Rejects calls to a gRPC method listed in gateway.disabled_methods
+// without contacting the server, with 501 like the server's Unimplemented, so
+// clients do not retry them as they would a 503
+func killSwitch(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !config.MethodDisabled(settings.Current().Gateway.DisabledMethods, method) {
+			next(w, r)
+			return
+		}
+
+		log.WarnContext(r.Context(), "call blocked by kill switch", "method", method, "path", r.URL.Path)
+		writeError(w, r, http.StatusNotImplemented, "%s has been disabled", method)
+	}
+}
+
+// requestLogger - Logs request timing and status, and attaches a request ID
+// (taken from X-Request-ID or generated) plus the W3C trace ID to the context
 func requestLogger(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		
+
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = logging.NewRequestID()
+		}
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		if traceID := logging.TraceIDFromTraceParent(r.Header.Get("traceparent")); traceID != "" {
+			ctx = logging.WithTraceID(ctx, traceID)
+		}
+		r = r.WithContext(ctx)
+		w.Header().Set("X-Request-ID", requestID)
+
 		// For WebSocket endpoints, log before upgrade (connection stays open)
 		if strings.Contains(r.URL.Path, "bidirectional") {
-			log.Printf("[%s] %s %s - WebSocket upgrade request", r.Method, r.URL.Path, r.RemoteAddr)
+			log.InfoContext(ctx, "websocket upgrade request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
 		}
-		
+
 		// Wrap response writer to capture status code
 		lw := &responseLogger{ResponseWriter: w, statusCode: http.StatusOK}
-		
+
 		next(lw, r)
-		
+
 		// For WebSocket, the connection is hijacked, so this won't execute
 		// For other endpoints, log after completion
 		if !strings.Contains(r.URL.Path, "bidirectional") {
 			duration := time.Since(start)
-			log.Printf("[%s] %s %s - %d - %v", r.Method, r.URL.Path, r.RemoteAddr, lw.statusCode, duration)
+			log.InfoContext(ctx, "request completed",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"remote", r.RemoteAddr,
+				"status", lw.statusCode,
+				"duration", duration,
+			)
 		}
 	}
 }
@@ -152,4 +204,3 @@ func (rl *responseLogger) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	}
 	return nil, nil, http.ErrNotSupported
 }
-
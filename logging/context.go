@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// Header and gRPC metadata keys used to carry correlation IDs between the
+// gateway and the server.
+const (
+	RequestIDHeader = "x-request-id"
+	TraceParentKey  = "traceparent"
+)
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	traceIDKey
+)
+
+// WithRequestID attaches a request ID that every log record written with
+// the returned context will carry.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID attached to ctx, if any.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithTraceID attaches a trace ID to ctx.
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey, id)
+}
+
+// TraceID returns the trace ID attached to ctx, if any.
+func TraceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(traceIDKey).(string)
+	return id
+}
+
+// NewRequestID returns a random 16-byte hex ID.
+func NewRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// TraceIDFromTraceParent extracts the trace ID from a W3C traceparent value
+// ("00-<trace-id>-<span-id>-<flags>"). It returns "" for malformed input.
+func TraceIDFromTraceParent(v string) string {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil {
+		return ""
+	}
+	return parts[1]
+}
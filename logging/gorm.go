@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// GormLogger bridges GORM's logger into the shared slog sink.
+// SQL traces are written at debug level, slow queries at warn and
+// failed queries at error.
+type GormLogger struct {
+	log           *slog.Logger
+	level         gormlogger.LogLevel
+	slowThreshold time.Duration
+}
+
+// NewGormLogger returns a GORM logger writing to l. With debug set every
+// statement is traced, otherwise only slow and failed ones are logged.
+func NewGormLogger(l *slog.Logger, debug bool) *GormLogger {
+	level := gormlogger.Warn
+	if debug {
+		level = gormlogger.Info
+	}
+	return &GormLogger{log: l, level: level, slowThreshold: 200 * time.Millisecond}
+}
+
+func (g *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	clone := *g
+	clone.level = level
+	return &clone
+}
+
+func (g *GormLogger) Info(ctx context.Context, msg string, args ...any) {
+	if g.level >= gormlogger.Info {
+		g.log.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (g *GormLogger) Warn(ctx context.Context, msg string, args ...any) {
+	if g.level >= gormlogger.Warn {
+		g.log.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (g *GormLogger) Error(ctx context.Context, msg string, args ...any) {
+	if g.level >= gormlogger.Error {
+		g.log.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (g *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if g.level <= gormlogger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && g.level >= gormlogger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		g.log.ErrorContext(ctx, "query failed", "error", err, "sql", sql, "rows", rows, "elapsed", elapsed)
+	case g.slowThreshold > 0 && elapsed > g.slowThreshold && g.level >= gormlogger.Warn:
+		sql, rows := fc()
+		g.log.WarnContext(ctx, "slow query", "sql", sql, "rows", rows, "elapsed", elapsed, "threshold", g.slowThreshold)
+	case g.level >= gormlogger.Info:
+		sql, rows := fc()
+		g.log.DebugContext(ctx, "query", "sql", sql, "rows", rows, "elapsed", elapsed)
+	}
+}
@@ -0,0 +1,205 @@
+// Package logging provides the structured, leveled logger shared by the
+// server, gateway, client and migrate binaries.
+//
+// Every component gets its own *slog.Logger from For. All of them write to
+// one sink (JSON or text) configured by Setup, but each component has its own
+// level so a noisy subsystem can be turned down without touching the rest.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Options configures the shared log sink.
+type Options struct {
+	// Format is "json" or "text".
+	Format string
+	// Level is the default level for components without an override.
+	Level string
+	// Levels overrides the level of individual components, e.g. {"gorm": "debug"}.
+	Levels map[string]string
+	// Output defaults to os.Stderr.
+	Output io.Writer
+}
+
+var (
+	root atomic.Pointer[slog.Handler]
+
+	levelsMu     sync.Mutex
+	defaultLevel = new(slog.LevelVar)
+	levels       = make(map[string]*slog.LevelVar)
+)
+
+func init() {
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	root.Store(&h)
+}
+
+// Setup installs the shared sink and component levels. It also replaces the
+// slog default logger so stray slog calls end up in the same place.
+func Setup(opts Options) error {
+	out := opts.Output
+	if out == nil {
+		out = os.Stderr
+	}
+
+	// Filtering happens per component, so the sink itself accepts everything.
+	handlerOpts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var h slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		h = slog.NewTextHandler(out, handlerOpts)
+	case "json":
+		h = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		return fmt.Errorf("unknown log format %q (want json or text)", opts.Format)
+	}
+
+	if err := SetLevels(opts.Level, opts.Levels); err != nil {
+		return err
+	}
+	root.Store(&h)
+	slog.SetDefault(For("app"))
+	return nil
+}
+
+// SetLevels replaces the default level and all per-component overrides.
+// Loggers already handed out by For pick up the change immediately.
+func SetLevels(level string, perComponent map[string]string) error {
+	def, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	parsed := make(map[string]slog.Level, len(perComponent))
+	for component, l := range perComponent {
+		if parsed[component], err = ParseLevel(l); err != nil {
+			return fmt.Errorf("component %s: %w", component, err)
+		}
+	}
+
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+	defaultLevel.Set(def)
+	for component, lv := range levels {
+		if l, ok := parsed[component]; ok {
+			lv.Set(l)
+		} else {
+			lv.Set(def)
+		}
+	}
+	for component, l := range parsed {
+		levelVar(component).Set(l)
+	}
+	return nil
+}
+
+// Levels reports the effective level of every known component.
+func Levels() map[string]string {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+	out := make(map[string]string, len(levels))
+	names := make([]string, 0, len(levels))
+	for component := range levels {
+		names = append(names, component)
+	}
+	sort.Strings(names)
+	for _, component := range names {
+		out[component] = strings.ToLower(levels[component].Level().String())
+	}
+	return out
+}
+
+// ParseLevel accepts debug, info, warn(ing) and error. An empty string means info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// levelVar must be called with levelsMu held.
+func levelVar(component string) *slog.LevelVar {
+	lv, ok := levels[component]
+	if !ok {
+		lv = new(slog.LevelVar)
+		lv.Set(defaultLevel.Level())
+		levels[component] = lv
+	}
+	return lv
+}
+
+// For returns the logger for a component. It is safe to call before Setup;
+// the logger follows later changes to the sink and levels.
+func For(component string) *slog.Logger {
+	levelsMu.Lock()
+	lv := levelVar(component)
+	levelsMu.Unlock()
+	return slog.New(&handler{
+		level: lv,
+		wrap: []func(slog.Handler) slog.Handler{
+			func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.String("component", component)})
+			},
+		},
+	})
+}
+
+// Fatal logs at error level and exits, replacing log.Fatalf.
+func Fatal(l *slog.Logger, msg string, args ...any) {
+	l.Error(msg, args...)
+	os.Exit(1)
+}
+
+// handler filters by component level and resolves the shared sink at
+// log time so Setup can run after loggers were created.
+type handler struct {
+	level *slog.LevelVar
+	wrap  []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	next := *root.Load()
+	for _, w := range h.wrap {
+		next = w(next)
+	}
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if id := TraceID(ctx); id != "" {
+		r.AddAttrs(slog.String("trace_id", id))
+	}
+	return next.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *handler) with(w func(slog.Handler) slog.Handler) slog.Handler {
+	wrap := make([]func(slog.Handler) slog.Handler, len(h.wrap), len(h.wrap)+1)
+	copy(wrap, h.wrap)
+	return &handler{level: h.level, wrap: append(wrap, w)}
+}
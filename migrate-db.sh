@@ -20,9 +20,8 @@ fi
 echo "📊 Connecting to database..."
 echo ""
 
-# Run migrations
-cd server
-go run migrate.go database.go
+# Apply pending migrations (server/migrations), then show where the schema stands
+go run ./server migrate up "$@" && go run ./server migrate status
 
 if [ $? -eq 0 ]; then
     echo ""
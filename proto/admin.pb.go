@@ -0,0 +1,1305 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v6.33.1
+// source: proto/admin.proto
+
+package helloworld
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type StatsUnit int32
+
+const (
+	StatsUnit_STATS_UNIT_UNSPECIFIED StatsUnit = 0 // hour
+	StatsUnit_STATS_UNIT_MINUTE      StatsUnit = 1
+	StatsUnit_STATS_UNIT_HOUR        StatsUnit = 2
+	StatsUnit_STATS_UNIT_DAY         StatsUnit = 3
+)
+
+// Enum value maps for StatsUnit.
+var (
+	StatsUnit_name = map[int32]string{
+		0: "STATS_UNIT_UNSPECIFIED",
+		1: "STATS_UNIT_MINUTE",
+		2: "STATS_UNIT_HOUR",
+		3: "STATS_UNIT_DAY",
+	}
+	StatsUnit_value = map[string]int32{
+		"STATS_UNIT_UNSPECIFIED": 0,
+		"STATS_UNIT_MINUTE":      1,
+		"STATS_UNIT_HOUR":        2,
+		"STATS_UNIT_DAY":         3,
+	}
+)
+
+func (x StatsUnit) Enum() *StatsUnit {
+	p := new(StatsUnit)
+	*p = x
+	return p
+}
+
+func (x StatsUnit) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (StatsUnit) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_admin_proto_enumTypes[0].Descriptor()
+}
+
+func (StatsUnit) Type() protoreflect.EnumType {
+	return &file_proto_admin_proto_enumTypes[0]
+}
+
+func (x StatsUnit) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use StatsUnit.Descriptor instead.
+func (StatsUnit) EnumDescriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{0}
+}
+
+type DrainRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// grace_period overrides server.drain_grace_period when set.
+	GracePeriod   *durationpb.Duration `protobuf:"bytes,1,opt,name=grace_period,json=gracePeriod,proto3" json:"grace_period,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DrainRequest) Reset() {
+	*x = DrainRequest{}
+	mi := &file_proto_admin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DrainRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainRequest) ProtoMessage() {}
+
+func (x *DrainRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainRequest.ProtoReflect.Descriptor instead.
+func (*DrainRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DrainRequest) GetGracePeriod() *durationpb.Duration {
+	if x != nil {
+		return x.GracePeriod
+	}
+	return nil
+}
+
+type DrainReply struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// active_streams is the number of open streams told to reconnect.
+	ActiveStreams int32 `protobuf:"varint,1,opt,name=active_streams,json=activeStreams,proto3" json:"active_streams,omitempty"`
+	// grace_period is how long the server waits before closing them.
+	GracePeriod   *durationpb.Duration `protobuf:"bytes,2,opt,name=grace_period,json=gracePeriod,proto3" json:"grace_period,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DrainReply) Reset() {
+	*x = DrainReply{}
+	mi := &file_proto_admin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DrainReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainReply) ProtoMessage() {}
+
+func (x *DrainReply) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainReply.ProtoReflect.Descriptor instead.
+func (*DrainReply) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *DrainReply) GetActiveStreams() int32 {
+	if x != nil {
+		return x.ActiveStreams
+	}
+	return 0
+}
+
+func (x *DrainReply) GetGracePeriod() *durationpb.Duration {
+	if x != nil {
+		return x.GracePeriod
+	}
+	return nil
+}
+
+type ExportUserDataRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportUserDataRequest) Reset() {
+	*x = ExportUserDataRequest{}
+	mi := &file_proto_admin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportUserDataRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportUserDataRequest) ProtoMessage() {}
+
+func (x *ExportUserDataRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportUserDataRequest.ProtoReflect.Descriptor instead.
+func (*ExportUserDataRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ExportUserDataRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type UserDataChunk struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// data is the next part of the JSON document.
+	Data          []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserDataChunk) Reset() {
+	*x = UserDataChunk{}
+	mi := &file_proto_admin_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserDataChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserDataChunk) ProtoMessage() {}
+
+func (x *UserDataChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserDataChunk.ProtoReflect.Descriptor instead.
+func (*UserDataChunk) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *UserDataChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type EraseUserRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// reason is kept in the tombstone, e.g. the ticket of the request.
+	Reason        string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EraseUserRequest) Reset() {
+	*x = EraseUserRequest{}
+	mi := &file_proto_admin_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EraseUserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EraseUserRequest) ProtoMessage() {}
+
+func (x *EraseUserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EraseUserRequest.ProtoReflect.Descriptor instead.
+func (*EraseUserRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EraseUserRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *EraseUserRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type EraseUserReply struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// tombstone_id is the ID of the user_erasures row.
+	TombstoneId      string                 `protobuf:"bytes,1,opt,name=tombstone_id,json=tombstoneId,proto3" json:"tombstone_id,omitempty"`
+	UserId           string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	GreetingsDeleted int64                  `protobuf:"varint,3,opt,name=greetings_deleted,json=greetingsDeleted,proto3" json:"greetings_deleted,omitempty"`
+	ErasedAt         *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=erased_at,json=erasedAt,proto3" json:"erased_at,omitempty"`
+	// archived_greetings_redacted counts the greetings removed from the
+	// retention archives in the server's archive_dir.
+	ArchivedGreetingsRedacted int64 `protobuf:"varint,5,opt,name=archived_greetings_redacted,json=archivedGreetingsRedacted,proto3" json:"archived_greetings_redacted,omitempty"`
+	unknownFields             protoimpl.UnknownFields
+	sizeCache                 protoimpl.SizeCache
+}
+
+func (x *EraseUserReply) Reset() {
+	*x = EraseUserReply{}
+	mi := &file_proto_admin_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EraseUserReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EraseUserReply) ProtoMessage() {}
+
+func (x *EraseUserReply) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EraseUserReply.ProtoReflect.Descriptor instead.
+func (*EraseUserReply) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *EraseUserReply) GetTombstoneId() string {
+	if x != nil {
+		return x.TombstoneId
+	}
+	return ""
+}
+
+func (x *EraseUserReply) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *EraseUserReply) GetGreetingsDeleted() int64 {
+	if x != nil {
+		return x.GreetingsDeleted
+	}
+	return 0
+}
+
+func (x *EraseUserReply) GetErasedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ErasedAt
+	}
+	return nil
+}
+
+func (x *EraseUserReply) GetArchivedGreetingsRedacted() int64 {
+	if x != nil {
+		return x.ArchivedGreetingsRedacted
+	}
+	return 0
+}
+
+type QueryAuditEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// method is a full method name, e.g. /helloworld.Admin/EraseUser.
+	Method string `protobuf:"bytes,1,opt,name=method,proto3" json:"method,omitempty"`
+	// caller is a subject such as key:ops, user:demo or peer:10.0.0.7.
+	Caller string `protobuf:"bytes,2,opt,name=caller,proto3" json:"caller,omitempty"`
+	// code is a gRPC code name, e.g. OK or PermissionDenied.
+	Code  string                 `protobuf:"bytes,3,opt,name=code,proto3" json:"code,omitempty"`
+	Since *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=since,proto3" json:"since,omitempty"`
+	Until *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=until,proto3" json:"until,omitempty"`
+	// after_seq skips the events up to and including this sequence number.
+	AfterSeq int64 `protobuf:"varint,6,opt,name=after_seq,json=afterSeq,proto3" json:"after_seq,omitempty"`
+	// limit defaults to 100 and is capped at 1000.
+	Limit         int32 `protobuf:"varint,7,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryAuditEventsRequest) Reset() {
+	*x = QueryAuditEventsRequest{}
+	mi := &file_proto_admin_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryAuditEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryAuditEventsRequest) ProtoMessage() {}
+
+func (x *QueryAuditEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryAuditEventsRequest.ProtoReflect.Descriptor instead.
+func (*QueryAuditEventsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *QueryAuditEventsRequest) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *QueryAuditEventsRequest) GetCaller() string {
+	if x != nil {
+		return x.Caller
+	}
+	return ""
+}
+
+func (x *QueryAuditEventsRequest) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *QueryAuditEventsRequest) GetSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Since
+	}
+	return nil
+}
+
+func (x *QueryAuditEventsRequest) GetUntil() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Until
+	}
+	return nil
+}
+
+func (x *QueryAuditEventsRequest) GetAfterSeq() int64 {
+	if x != nil {
+		return x.AfterSeq
+	}
+	return 0
+}
+
+func (x *QueryAuditEventsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type AuditEvent struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Seq        int64                  `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	At         *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=at,proto3" json:"at,omitempty"`
+	Method     string                 `protobuf:"bytes,3,opt,name=method,proto3" json:"method,omitempty"`
+	Caller     string                 `protobuf:"bytes,4,opt,name=caller,proto3" json:"caller,omitempty"`
+	Peer       string                 `protobuf:"bytes,5,opt,name=peer,proto3" json:"peer,omitempty"`
+	Code       string                 `protobuf:"bytes,6,opt,name=code,proto3" json:"code,omitempty"`
+	DurationMs int64                  `protobuf:"varint,7,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	RequestId  string                 `protobuf:"bytes,8,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	// detail is set on events the server records itself, such as drops.
+	Detail string `protobuf:"bytes,9,opt,name=detail,proto3" json:"detail,omitempty"`
+	// hash is the SHA-256 of the event and prev_hash, the hash of the
+	// event before it.
+	PrevHash      string `protobuf:"bytes,10,opt,name=prev_hash,json=prevHash,proto3" json:"prev_hash,omitempty"`
+	Hash          string `protobuf:"bytes,11,opt,name=hash,proto3" json:"hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditEvent) Reset() {
+	*x = AuditEvent{}
+	mi := &file_proto_admin_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditEvent) ProtoMessage() {}
+
+func (x *AuditEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditEvent.ProtoReflect.Descriptor instead.
+func (*AuditEvent) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AuditEvent) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *AuditEvent) GetAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.At
+	}
+	return nil
+}
+
+func (x *AuditEvent) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetCaller() string {
+	if x != nil {
+		return x.Caller
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *AuditEvent) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetDetail() string {
+	if x != nil {
+		return x.Detail
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetPrevHash() string {
+	if x != nil {
+		return x.PrevHash
+	}
+	return ""
+}
+
+func (x *AuditEvent) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+type QueryAuditEventsReply struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Events []*AuditEvent          `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	// next_after_seq is the after_seq of the next page, 0 on the last one.
+	NextAfterSeq  int64 `protobuf:"varint,2,opt,name=next_after_seq,json=nextAfterSeq,proto3" json:"next_after_seq,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryAuditEventsReply) Reset() {
+	*x = QueryAuditEventsReply{}
+	mi := &file_proto_admin_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryAuditEventsReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryAuditEventsReply) ProtoMessage() {}
+
+func (x *QueryAuditEventsReply) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryAuditEventsReply.ProtoReflect.Descriptor instead.
+func (*QueryAuditEventsReply) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *QueryAuditEventsReply) GetEvents() []*AuditEvent {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+func (x *QueryAuditEventsReply) GetNextAfterSeq() int64 {
+	if x != nil {
+		return x.NextAfterSeq
+	}
+	return 0
+}
+
+type GreetingStatsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Unit  StatsUnit              `protobuf:"varint,1,opt,name=unit,proto3,enum=helloworld.StatsUnit" json:"unit,omitempty"`
+	// The range defaults to the 24 hours before until, which defaults to
+	// now. It is widened to whole buckets and may span at most 1500 of them.
+	From  *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	Until *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=until,proto3" json:"until,omitempty"`
+	// user restricts the counts and top users to one user, by name. Batch
+	// sizes are always for everyone.
+	User string `protobuf:"bytes,4,opt,name=user,proto3" json:"user,omitempty"`
+	// top_users is how many of the users with the most greetings to return:
+	// 10 by default, at most 100.
+	TopUsers      int32 `protobuf:"varint,5,opt,name=top_users,json=topUsers,proto3" json:"top_users,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GreetingStatsRequest) Reset() {
+	*x = GreetingStatsRequest{}
+	mi := &file_proto_admin_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GreetingStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GreetingStatsRequest) ProtoMessage() {}
+
+func (x *GreetingStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GreetingStatsRequest.ProtoReflect.Descriptor instead.
+func (*GreetingStatsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GreetingStatsRequest) GetUnit() StatsUnit {
+	if x != nil {
+		return x.Unit
+	}
+	return StatsUnit_STATS_UNIT_UNSPECIFIED
+}
+
+func (x *GreetingStatsRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *GreetingStatsRequest) GetUntil() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Until
+	}
+	return nil
+}
+
+func (x *GreetingStatsRequest) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *GreetingStatsRequest) GetTopUsers() int32 {
+	if x != nil {
+		return x.TopUsers
+	}
+	return 0
+}
+
+type GreetingBucket struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	Greetings     int64                  `protobuf:"varint,2,opt,name=greetings,proto3" json:"greetings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GreetingBucket) Reset() {
+	*x = GreetingBucket{}
+	mi := &file_proto_admin_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GreetingBucket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GreetingBucket) ProtoMessage() {}
+
+func (x *GreetingBucket) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GreetingBucket.ProtoReflect.Descriptor instead.
+func (*GreetingBucket) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GreetingBucket) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *GreetingBucket) GetGreetings() int64 {
+	if x != nil {
+		return x.Greetings
+	}
+	return 0
+}
+
+type UserGreetingCount struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	UserId string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// name is empty for users that no longer exist.
+	Name          string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Greetings     int64  `protobuf:"varint,3,opt,name=greetings,proto3" json:"greetings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserGreetingCount) Reset() {
+	*x = UserGreetingCount{}
+	mi := &file_proto_admin_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserGreetingCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserGreetingCount) ProtoMessage() {}
+
+func (x *UserGreetingCount) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserGreetingCount.ProtoReflect.Descriptor instead.
+func (*UserGreetingCount) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *UserGreetingCount) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *UserGreetingCount) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *UserGreetingCount) GetGreetings() int64 {
+	if x != nil {
+		return x.Greetings
+	}
+	return 0
+}
+
+// BatchSizeStats describes the client-stream batches stored in the range.
+type BatchSizeStats struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Batches   int64                  `protobuf:"varint,1,opt,name=batches,proto3" json:"batches,omitempty"`
+	Greetings int64                  `protobuf:"varint,2,opt,name=greetings,proto3" json:"greetings,omitempty"`
+	MeanSize  float64                `protobuf:"fixed64,3,opt,name=mean_size,json=meanSize,proto3" json:"mean_size,omitempty"`
+	MaxSize   int64                  `protobuf:"varint,4,opt,name=max_size,json=maxSize,proto3" json:"max_size,omitempty"`
+	// histogram has the batches per size range, smallest first, leaving out
+	// empty ranges.
+	Histogram     []*BatchSizeRange `protobuf:"bytes,5,rep,name=histogram,proto3" json:"histogram,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchSizeStats) Reset() {
+	*x = BatchSizeStats{}
+	mi := &file_proto_admin_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchSizeStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSizeStats) ProtoMessage() {}
+
+func (x *BatchSizeStats) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSizeStats.ProtoReflect.Descriptor instead.
+func (*BatchSizeStats) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *BatchSizeStats) GetBatches() int64 {
+	if x != nil {
+		return x.Batches
+	}
+	return 0
+}
+
+func (x *BatchSizeStats) GetGreetings() int64 {
+	if x != nil {
+		return x.Greetings
+	}
+	return 0
+}
+
+func (x *BatchSizeStats) GetMeanSize() float64 {
+	if x != nil {
+		return x.MeanSize
+	}
+	return 0
+}
+
+func (x *BatchSizeStats) GetMaxSize() int64 {
+	if x != nil {
+		return x.MaxSize
+	}
+	return 0
+}
+
+func (x *BatchSizeStats) GetHistogram() []*BatchSizeRange {
+	if x != nil {
+		return x.Histogram
+	}
+	return nil
+}
+
+type BatchSizeRange struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// min_size and max_size are inclusive.
+	MinSize       int64 `protobuf:"varint,1,opt,name=min_size,json=minSize,proto3" json:"min_size,omitempty"`
+	MaxSize       int64 `protobuf:"varint,2,opt,name=max_size,json=maxSize,proto3" json:"max_size,omitempty"`
+	Batches       int64 `protobuf:"varint,3,opt,name=batches,proto3" json:"batches,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchSizeRange) Reset() {
+	*x = BatchSizeRange{}
+	mi := &file_proto_admin_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchSizeRange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSizeRange) ProtoMessage() {}
+
+func (x *BatchSizeRange) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSizeRange.ProtoReflect.Descriptor instead.
+func (*BatchSizeRange) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *BatchSizeRange) GetMinSize() int64 {
+	if x != nil {
+		return x.MinSize
+	}
+	return 0
+}
+
+func (x *BatchSizeRange) GetMaxSize() int64 {
+	if x != nil {
+		return x.MaxSize
+	}
+	return 0
+}
+
+func (x *BatchSizeRange) GetBatches() int64 {
+	if x != nil {
+		return x.Batches
+	}
+	return 0
+}
+
+type GreetingStatsReply struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Unit  StatsUnit              `protobuf:"varint,1,opt,name=unit,proto3,enum=helloworld.StatsUnit" json:"unit,omitempty"`
+	// from and until are the range after widening to whole buckets.
+	From  *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	Until *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=until,proto3" json:"until,omitempty"`
+	// buckets covers the range, empty buckets included, oldest first.
+	Buckets  []*GreetingBucket    `protobuf:"bytes,4,rep,name=buckets,proto3" json:"buckets,omitempty"`
+	Total    int64                `protobuf:"varint,5,opt,name=total,proto3" json:"total,omitempty"`
+	TopUsers []*UserGreetingCount `protobuf:"bytes,6,rep,name=top_users,json=topUsers,proto3" json:"top_users,omitempty"`
+	Batches  *BatchSizeStats      `protobuf:"bytes,7,opt,name=batches,proto3" json:"batches,omitempty"`
+	// rolled_up_through is when the greetings counted end: later ones are
+	// not in the stats yet.
+	RolledUpThrough *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=rolled_up_through,json=rolledUpThrough,proto3" json:"rolled_up_through,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *GreetingStatsReply) Reset() {
+	*x = GreetingStatsReply{}
+	mi := &file_proto_admin_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GreetingStatsReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GreetingStatsReply) ProtoMessage() {}
+
+func (x *GreetingStatsReply) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GreetingStatsReply.ProtoReflect.Descriptor instead.
+func (*GreetingStatsReply) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *GreetingStatsReply) GetUnit() StatsUnit {
+	if x != nil {
+		return x.Unit
+	}
+	return StatsUnit_STATS_UNIT_UNSPECIFIED
+}
+
+func (x *GreetingStatsReply) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *GreetingStatsReply) GetUntil() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Until
+	}
+	return nil
+}
+
+func (x *GreetingStatsReply) GetBuckets() []*GreetingBucket {
+	if x != nil {
+		return x.Buckets
+	}
+	return nil
+}
+
+func (x *GreetingStatsReply) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *GreetingStatsReply) GetTopUsers() []*UserGreetingCount {
+	if x != nil {
+		return x.TopUsers
+	}
+	return nil
+}
+
+func (x *GreetingStatsReply) GetBatches() *BatchSizeStats {
+	if x != nil {
+		return x.Batches
+	}
+	return nil
+}
+
+func (x *GreetingStatsReply) GetRolledUpThrough() *timestamppb.Timestamp {
+	if x != nil {
+		return x.RolledUpThrough
+	}
+	return nil
+}
+
+var File_proto_admin_proto protoreflect.FileDescriptor
+
+const file_proto_admin_proto_rawDesc = "" +
+	"\n" +
+	"\x11proto/admin.proto\x12\n" +
+	"helloworld\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x14proto/validate.proto\"L\n" +
+	"\fDrainRequest\x12<\n" +
+	"\fgrace_period\x18\x01 \x01(\v2\x19.google.protobuf.DurationR\vgracePeriod\"q\n" +
+	"\n" +
+	"DrainReply\x12%\n" +
+	"\x0eactive_streams\x18\x01 \x01(\x05R\ractiveStreams\x12<\n" +
+	"\fgrace_period\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\vgracePeriod\"5\n" +
+	"\x15ExportUserDataRequest\x12\x1c\n" +
+	"\x04name\x18\x01 \x01(\tB\b\x8a\xb5\x18\x04\b\x01\x18dR\x04name\"#\n" +
+	"\rUserDataChunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"S\n" +
+	"\x10EraseUserRequest\x12\x1c\n" +
+	"\x04name\x18\x01 \x01(\tB\b\x8a\xb5\x18\x04\b\x01\x18dR\x04name\x12!\n" +
+	"\x06reason\x18\x02 \x01(\tB\t\x8a\xb5\x18\x05\x18\xf4\x03(\x01R\x06reason\"\xf2\x01\n" +
+	"\x0eEraseUserReply\x12!\n" +
+	"\ftombstone_id\x18\x01 \x01(\tR\vtombstoneId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12+\n" +
+	"\x11greetings_deleted\x18\x03 \x01(\x03R\x10greetingsDeleted\x127\n" +
+	"\terased_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\berasedAt\x12>\n" +
+	"\x1barchived_greetings_redacted\x18\x05 \x01(\x03R\x19archivedGreetingsRedacted\"\x8e\x02\n" +
+	"\x17QueryAuditEventsRequest\x12\x1f\n" +
+	"\x06method\x18\x01 \x01(\tB\a\x8a\xb5\x18\x03\x18\xc8\x01R\x06method\x12\x1f\n" +
+	"\x06caller\x18\x02 \x01(\tB\a\x8a\xb5\x18\x03\x18\xc8\x01R\x06caller\x12\x1a\n" +
+	"\x04code\x18\x03 \x01(\tB\x06\x8a\xb5\x18\x02\x182R\x04code\x120\n" +
+	"\x05since\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x05since\x120\n" +
+	"\x05until\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x05until\x12\x1b\n" +
+	"\tafter_seq\x18\x06 \x01(\x03R\bafterSeq\x12\x14\n" +
+	"\x05limit\x18\a \x01(\x05R\x05limit\"\xab\x02\n" +
+	"\n" +
+	"AuditEvent\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x03R\x03seq\x12*\n" +
+	"\x02at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x02at\x12\x16\n" +
+	"\x06method\x18\x03 \x01(\tR\x06method\x12\x16\n" +
+	"\x06caller\x18\x04 \x01(\tR\x06caller\x12\x12\n" +
+	"\x04peer\x18\x05 \x01(\tR\x04peer\x12\x12\n" +
+	"\x04code\x18\x06 \x01(\tR\x04code\x12\x1f\n" +
+	"\vduration_ms\x18\a \x01(\x03R\n" +
+	"durationMs\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\b \x01(\tR\trequestId\x12\x16\n" +
+	"\x06detail\x18\t \x01(\tR\x06detail\x12\x1b\n" +
+	"\tprev_hash\x18\n" +
+	" \x01(\tR\bprevHash\x12\x12\n" +
+	"\x04hash\x18\v \x01(\tR\x04hash\"m\n" +
+	"\x15QueryAuditEventsReply\x12.\n" +
+	"\x06events\x18\x01 \x03(\v2\x16.helloworld.AuditEventR\x06events\x12$\n" +
+	"\x0enext_after_seq\x18\x02 \x01(\x03R\fnextAfterSeq\"\xdc\x01\n" +
+	"\x14GreetingStatsRequest\x12)\n" +
+	"\x04unit\x18\x01 \x01(\x0e2\x15.helloworld.StatsUnitR\x04unit\x12.\n" +
+	"\x04from\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x120\n" +
+	"\x05until\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x05until\x12\x1a\n" +
+	"\x04user\x18\x04 \x01(\tB\x06\x8a\xb5\x18\x02\x18dR\x04user\x12\x1b\n" +
+	"\ttop_users\x18\x05 \x01(\x05R\btopUsers\"`\n" +
+	"\x0eGreetingBucket\x120\n" +
+	"\x05start\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12\x1c\n" +
+	"\tgreetings\x18\x02 \x01(\x03R\tgreetings\"^\n" +
+	"\x11UserGreetingCount\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1c\n" +
+	"\tgreetings\x18\x03 \x01(\x03R\tgreetings\"\xba\x01\n" +
+	"\x0eBatchSizeStats\x12\x18\n" +
+	"\abatches\x18\x01 \x01(\x03R\abatches\x12\x1c\n" +
+	"\tgreetings\x18\x02 \x01(\x03R\tgreetings\x12\x1b\n" +
+	"\tmean_size\x18\x03 \x01(\x01R\bmeanSize\x12\x19\n" +
+	"\bmax_size\x18\x04 \x01(\x03R\amaxSize\x128\n" +
+	"\thistogram\x18\x05 \x03(\v2\x1a.helloworld.BatchSizeRangeR\thistogram\"`\n" +
+	"\x0eBatchSizeRange\x12\x19\n" +
+	"\bmin_size\x18\x01 \x01(\x03R\aminSize\x12\x19\n" +
+	"\bmax_size\x18\x02 \x01(\x03R\amaxSize\x12\x18\n" +
+	"\abatches\x18\x03 \x01(\x03R\abatches\"\xa7\x03\n" +
+	"\x12GreetingStatsReply\x12)\n" +
+	"\x04unit\x18\x01 \x01(\x0e2\x15.helloworld.StatsUnitR\x04unit\x12.\n" +
+	"\x04from\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x120\n" +
+	"\x05until\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x05until\x124\n" +
+	"\abuckets\x18\x04 \x03(\v2\x1a.helloworld.GreetingBucketR\abuckets\x12\x14\n" +
+	"\x05total\x18\x05 \x01(\x03R\x05total\x12:\n" +
+	"\ttop_users\x18\x06 \x03(\v2\x1d.helloworld.UserGreetingCountR\btopUsers\x124\n" +
+	"\abatches\x18\a \x01(\v2\x1a.helloworld.BatchSizeStatsR\abatches\x12F\n" +
+	"\x11rolled_up_through\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\x0frolledUpThrough*g\n" +
+	"\tStatsUnit\x12\x1a\n" +
+	"\x16STATS_UNIT_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11STATS_UNIT_MINUTE\x10\x01\x12\x13\n" +
+	"\x0fSTATS_UNIT_HOUR\x10\x02\x12\x12\n" +
+	"\x0eSTATS_UNIT_DAY\x10\x032\x97\x03\n" +
+	"\x05Admin\x12;\n" +
+	"\x05Drain\x12\x18.helloworld.DrainRequest\x1a\x16.helloworld.DrainReply\"\x00\x12R\n" +
+	"\x0eExportUserData\x12!.helloworld.ExportUserDataRequest\x1a\x19.helloworld.UserDataChunk\"\x000\x01\x12G\n" +
+	"\tEraseUser\x12\x1c.helloworld.EraseUserRequest\x1a\x1a.helloworld.EraseUserReply\"\x00\x12\\\n" +
+	"\x10QueryAuditEvents\x12#.helloworld.QueryAuditEventsRequest\x1a!.helloworld.QueryAuditEventsReply\"\x00\x12V\n" +
+	"\x10GetGreetingStats\x12 .helloworld.GreetingStatsRequest\x1a\x1e.helloworld.GreetingStatsReply\"\x00B\x14Z\x12./proto;helloworldb\x06proto3"
+
+var (
+	file_proto_admin_proto_rawDescOnce sync.Once
+	file_proto_admin_proto_rawDescData []byte
+)
+
+func file_proto_admin_proto_rawDescGZIP() []byte {
+	file_proto_admin_proto_rawDescOnce.Do(func() {
+		file_proto_admin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_admin_proto_rawDesc), len(file_proto_admin_proto_rawDesc)))
+	})
+	return file_proto_admin_proto_rawDescData
+}
+
+var file_proto_admin_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_proto_admin_proto_goTypes = []any{
+	(StatsUnit)(0),                  // 0: helloworld.StatsUnit
+	(*DrainRequest)(nil),            // 1: helloworld.DrainRequest
+	(*DrainReply)(nil),              // 2: helloworld.DrainReply
+	(*ExportUserDataRequest)(nil),   // 3: helloworld.ExportUserDataRequest
+	(*UserDataChunk)(nil),           // 4: helloworld.UserDataChunk
+	(*EraseUserRequest)(nil),        // 5: helloworld.EraseUserRequest
+	(*EraseUserReply)(nil),          // 6: helloworld.EraseUserReply
+	(*QueryAuditEventsRequest)(nil), // 7: helloworld.QueryAuditEventsRequest
+	(*AuditEvent)(nil),              // 8: helloworld.AuditEvent
+	(*QueryAuditEventsReply)(nil),   // 9: helloworld.QueryAuditEventsReply
+	(*GreetingStatsRequest)(nil),    // 10: helloworld.GreetingStatsRequest
+	(*GreetingBucket)(nil),          // 11: helloworld.GreetingBucket
+	(*UserGreetingCount)(nil),       // 12: helloworld.UserGreetingCount
+	(*BatchSizeStats)(nil),          // 13: helloworld.BatchSizeStats
+	(*BatchSizeRange)(nil),          // 14: helloworld.BatchSizeRange
+	(*GreetingStatsReply)(nil),      // 15: helloworld.GreetingStatsReply
+	(*durationpb.Duration)(nil),     // 16: google.protobuf.Duration
+	(*timestamppb.Timestamp)(nil),   // 17: google.protobuf.Timestamp
+}
+var file_proto_admin_proto_depIdxs = []int32{
+	16, // 0: helloworld.DrainRequest.grace_period:type_name -> google.protobuf.Duration
+	16, // 1: helloworld.DrainReply.grace_period:type_name -> google.protobuf.Duration
+	17, // 2: helloworld.EraseUserReply.erased_at:type_name -> google.protobuf.Timestamp
+	17, // 3: helloworld.QueryAuditEventsRequest.since:type_name -> google.protobuf.Timestamp
+	17, // 4: helloworld.QueryAuditEventsRequest.until:type_name -> google.protobuf.Timestamp
+	17, // 5: helloworld.AuditEvent.at:type_name -> google.protobuf.Timestamp
+	8,  // 6: helloworld.QueryAuditEventsReply.events:type_name -> helloworld.AuditEvent
+	0,  // 7: helloworld.GreetingStatsRequest.unit:type_name -> helloworld.StatsUnit
+	17, // 8: helloworld.GreetingStatsRequest.from:type_name -> google.protobuf.Timestamp
+	17, // 9: helloworld.GreetingStatsRequest.until:type_name -> google.protobuf.Timestamp
+	17, // 10: helloworld.GreetingBucket.start:type_name -> google.protobuf.Timestamp
+	14, // 11: helloworld.BatchSizeStats.histogram:type_name -> helloworld.BatchSizeRange
+	0,  // 12: helloworld.GreetingStatsReply.unit:type_name -> helloworld.StatsUnit
+	17, // 13: helloworld.GreetingStatsReply.from:type_name -> google.protobuf.Timestamp
+	17, // 14: helloworld.GreetingStatsReply.until:type_name -> google.protobuf.Timestamp
+	11, // 15: helloworld.GreetingStatsReply.buckets:type_name -> helloworld.GreetingBucket
+	12, // 16: helloworld.GreetingStatsReply.top_users:type_name -> helloworld.UserGreetingCount
+	13, // 17: helloworld.GreetingStatsReply.batches:type_name -> helloworld.BatchSizeStats
+	17, // 18: helloworld.GreetingStatsReply.rolled_up_through:type_name -> google.protobuf.Timestamp
+	1,  // 19: helloworld.Admin.Drain:input_type -> helloworld.DrainRequest
+	3,  // 20: helloworld.Admin.ExportUserData:input_type -> helloworld.ExportUserDataRequest
+	5,  // 21: helloworld.Admin.EraseUser:input_type -> helloworld.EraseUserRequest
+	7,  // 22: helloworld.Admin.QueryAuditEvents:input_type -> helloworld.QueryAuditEventsRequest
+	10, // 23: helloworld.Admin.GetGreetingStats:input_type -> helloworld.GreetingStatsRequest
+	2,  // 24: helloworld.Admin.Drain:output_type -> helloworld.DrainReply
+	4,  // 25: helloworld.Admin.ExportUserData:output_type -> helloworld.UserDataChunk
+	6,  // 26: helloworld.Admin.EraseUser:output_type -> helloworld.EraseUserReply
+	9,  // 27: helloworld.Admin.QueryAuditEvents:output_type -> helloworld.QueryAuditEventsReply
+	15, // 28: helloworld.Admin.GetGreetingStats:output_type -> helloworld.GreetingStatsReply
+	24, // [24:29] is the sub-list for method output_type
+	19, // [19:24] is the sub-list for method input_type
+	19, // [19:19] is the sub-list for extension type_name
+	19, // [19:19] is the sub-list for extension extendee
+	0,  // [0:19] is the sub-list for field type_name
+}
+
+func init() { file_proto_admin_proto_init() }
+func file_proto_admin_proto_init() {
+	if File_proto_admin_proto != nil {
+		return
+	}
+	file_proto_validate_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_admin_proto_rawDesc), len(file_proto_admin_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_admin_proto_goTypes,
+		DependencyIndexes: file_proto_admin_proto_depIdxs,
+		EnumInfos:         file_proto_admin_proto_enumTypes,
+		MessageInfos:      file_proto_admin_proto_msgTypes,
+	}.Build()
+	File_proto_admin_proto = out.File
+	file_proto_admin_proto_goTypes = nil
+	file_proto_admin_proto_depIdxs = nil
+}
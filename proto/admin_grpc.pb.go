@@ -0,0 +1,315 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v6.33.1
+// source: proto/admin.proto
+
+package helloworld
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Admin_Drain_FullMethodName            = "/helloworld.Admin/Drain"
+	Admin_ExportUserData_FullMethodName   = "/helloworld.Admin/ExportUserData"
+	Admin_EraseUser_FullMethodName        = "/helloworld.Admin/EraseUser"
+	Admin_QueryAuditEvents_FullMethodName = "/helloworld.Admin/QueryAuditEvents"
+	Admin_GetGreetingStats_FullMethodName = "/helloworld.Admin/GetGreetingStats"
+)
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Admin exposes operational actions. Every call needs an API key with the
+// "admin" scope.
+type AdminClient interface {
+	// Drain puts the server in drain mode, the same as SIGTERM: health turns
+	// NOT_SERVING, new streams are refused, open streams are told to
+	// reconnect, and the server shuts down once the grace period is over.
+	Drain(ctx context.Context, in *DrainRequest, opts ...grpc.CallOption) (*DrainReply, error)
+	// ExportUserData streams everything stored about a user, for privacy
+	// access requests. Concatenated, the chunks form one JSON document:
+	// {"format": "grpc-example/user-export/v1", "exported_at": ...,
+	//  "user": {...}, "greetings": [...]}
+	ExportUserData(ctx context.Context, in *ExportUserDataRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[UserDataChunk], error)
+	// EraseUser deletes a user and all their greetings in one transaction,
+	// evicts the user from the cache of every replica and records a tombstone
+	// (user_erasures) proving the erasure without keeping the name.
+	EraseUser(ctx context.Context, in *EraseUserRequest, opts ...grpc.CallOption) (*EraseUserReply, error)
+	// QueryAuditEvents returns recorded calls in chain order, oldest first.
+	// Filters combine with AND; page through with after_seq.
+	QueryAuditEvents(ctx context.Context, in *QueryAuditEventsRequest, opts ...grpc.CallOption) (*QueryAuditEventsReply, error)
+	// GetGreetingStats counts greetings per minute, hour or day over a time
+	// range, with the top users and the sizes of client-stream batches. It
+	// reads rollups the server updates every database.rollups.interval, so
+	// the latest greetings may be missing (see rolled_up_through).
+	GetGreetingStats(ctx context.Context, in *GreetingStatsRequest, opts ...grpc.CallOption) (*GreetingStatsReply, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) Drain(ctx context.Context, in *DrainRequest, opts ...grpc.CallOption) (*DrainReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DrainReply)
+	err := c.cc.Invoke(ctx, Admin_Drain_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ExportUserData(ctx context.Context, in *ExportUserDataRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[UserDataChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Admin_ServiceDesc.Streams[0], Admin_ExportUserData_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportUserDataRequest, UserDataChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Admin_ExportUserDataClient = grpc.ServerStreamingClient[UserDataChunk]
+
+func (c *adminClient) EraseUser(ctx context.Context, in *EraseUserRequest, opts ...grpc.CallOption) (*EraseUserReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EraseUserReply)
+	err := c.cc.Invoke(ctx, Admin_EraseUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) QueryAuditEvents(ctx context.Context, in *QueryAuditEventsRequest, opts ...grpc.CallOption) (*QueryAuditEventsReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryAuditEventsReply)
+	err := c.cc.Invoke(ctx, Admin_QueryAuditEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetGreetingStats(ctx context.Context, in *GreetingStatsRequest, opts ...grpc.CallOption) (*GreetingStatsReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GreetingStatsReply)
+	err := c.cc.Invoke(ctx, Admin_GetGreetingStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility.
+//
+// Admin exposes operational actions. Every call needs an API key with the
+// "admin" scope.
+type AdminServer interface {
+	// Drain puts the server in drain mode, the same as SIGTERM: health turns
+	// NOT_SERVING, new streams are refused, open streams are told to
+	// reconnect, and the server shuts down once the grace period is over.
+	Drain(context.Context, *DrainRequest) (*DrainReply, error)
+	// ExportUserData streams everything stored about a user, for privacy
+	// access requests. Concatenated, the chunks form one JSON document:
+	// {"format": "grpc-example/user-export/v1", "exported_at": ...,
+	//  "user": {...}, "greetings": [...]}
+	ExportUserData(*ExportUserDataRequest, grpc.ServerStreamingServer[UserDataChunk]) error
+	// EraseUser deletes a user and all their greetings in one transaction,
+	// evicts the user from the cache of every replica and records a tombstone
+	// (user_erasures) proving the erasure without keeping the name.
+	EraseUser(context.Context, *EraseUserRequest) (*EraseUserReply, error)
+	// QueryAuditEvents returns recorded calls in chain order, oldest first.
+	// Filters combine with AND; page through with after_seq.
+	QueryAuditEvents(context.Context, *QueryAuditEventsRequest) (*QueryAuditEventsReply, error)
+	// GetGreetingStats counts greetings per minute, hour or day over a time
+	// range, with the top users and the sizes of client-stream batches. It
+	// reads rollups the server updates every database.rollups.interval, so
+	// the latest greetings may be missing (see rolled_up_through).
+	GetGreetingStats(context.Context, *GreetingStatsRequest) (*GreetingStatsReply, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAdminServer struct{}
+
+func (UnimplementedAdminServer) Drain(context.Context, *DrainRequest) (*DrainReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Drain not implemented")
+}
+func (UnimplementedAdminServer) ExportUserData(*ExportUserDataRequest, grpc.ServerStreamingServer[UserDataChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method ExportUserData not implemented")
+}
+func (UnimplementedAdminServer) EraseUser(context.Context, *EraseUserRequest) (*EraseUserReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EraseUser not implemented")
+}
+func (UnimplementedAdminServer) QueryAuditEvents(context.Context, *QueryAuditEventsRequest) (*QueryAuditEventsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryAuditEvents not implemented")
+}
+func (UnimplementedAdminServer) GetGreetingStats(context.Context, *GreetingStatsRequest) (*GreetingStatsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetGreetingStats not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+func (UnimplementedAdminServer) testEmbeddedByValue()               {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	// If the following call pancis, it indicates UnimplementedAdminServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_Drain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DrainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Drain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_Drain_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Drain(ctx, req.(*DrainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ExportUserData_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportUserDataRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AdminServer).ExportUserData(m, &grpc.GenericServerStream[ExportUserDataRequest, UserDataChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Admin_ExportUserDataServer = grpc.ServerStreamingServer[UserDataChunk]
+
+func _Admin_EraseUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EraseUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).EraseUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_EraseUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).EraseUser(ctx, req.(*EraseUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_QueryAuditEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryAuditEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).QueryAuditEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_QueryAuditEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).QueryAuditEvents(ctx, req.(*QueryAuditEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetGreetingStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GreetingStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetGreetingStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetGreetingStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetGreetingStats(ctx, req.(*GreetingStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "helloworld.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Drain",
+			Handler:    _Admin_Drain_Handler,
+		},
+		{
+			MethodName: "EraseUser",
+			Handler:    _Admin_EraseUser_Handler,
+		},
+		{
+			MethodName: "QueryAuditEvents",
+			Handler:    _Admin_QueryAuditEvents_Handler,
+		},
+		{
+			MethodName: "GetGreetingStats",
+			Handler:    _Admin_GetGreetingStats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExportUserData",
+			Handler:       _Admin_ExportUserData_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/admin.proto",
+}
@@ -9,6 +9,7 @@ package helloworld
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -22,8 +23,10 @@ const (
 )
 
 type HelloRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Names become rows in the users table: one line of printable text,
+	// no surrounding whitespace.
+	Name          string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -66,8 +69,14 @@ func (x *HelloRequest) GetName() string {
 }
 
 type HelloReply struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Message string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	// going_away is set on the notice sent to open streams when the server
+	// starts draining; clients should finish up and reconnect.
+	GoingAway bool `protobuf:"varint,2,opt,name=going_away,json=goingAway,proto3" json:"going_away,omitempty"`
+	// created_at is when the greetings of a client stream were recorded;
+	// unset on other replies.
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -109,17 +118,35 @@ func (x *HelloReply) GetMessage() string {
 	return ""
 }
 
+func (x *HelloReply) GetGoingAway() bool {
+	if x != nil {
+		return x.GoingAway
+	}
+	return false
+}
+
+func (x *HelloReply) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
 var File_proto_helloworld_proto protoreflect.FileDescriptor
 
 const file_proto_helloworld_proto_rawDesc = "" +
 	"\n" +
 	"\x16proto/helloworld.proto\x12\n" +
-	"helloworld\"\"\n" +
-	"\fHelloRequest\x12\x12\n" +
-	"\x04name\x18\x01 \x01(\tR\x04name\"&\n" +
+	"helloworld\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x14proto/validate.proto\";\n" +
+	"\fHelloRequest\x12+\n" +
+	"\x04name\x18\x01 \x01(\tB\x17\x8a\xb5\x18\x13\b\x01\x18d\"\v^\\S(.*\\S)?$(\x01R\x04name\"\x80\x01\n" +
 	"\n" +
 	"HelloReply\x12\x18\n" +
-	"\amessage\x18\x01 \x01(\tR\amessage2\xb6\x02\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x1d\n" +
+	"\n" +
+	"going_away\x18\x02 \x01(\bR\tgoingAway\x129\n" +
+	"\n" +
+	"created_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt2\xb6\x02\n" +
 	"\aGreeter\x12>\n" +
 	"\bSayHello\x12\x18.helloworld.HelloRequest\x1a\x16.helloworld.HelloReply\"\x00\x12L\n" +
 	"\x14SayHelloServerStream\x12\x18.helloworld.HelloRequest\x1a\x16.helloworld.HelloReply\"\x000\x01\x12L\n" +
@@ -140,23 +167,25 @@ func file_proto_helloworld_proto_rawDescGZIP() []byte {
 
 var file_proto_helloworld_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
 var file_proto_helloworld_proto_goTypes = []any{
-	(*HelloRequest)(nil), // 0: helloworld.HelloRequest
-	(*HelloReply)(nil),   // 1: helloworld.HelloReply
+	(*HelloRequest)(nil),          // 0: helloworld.HelloRequest
+	(*HelloReply)(nil),            // 1: helloworld.HelloReply
+	(*timestamppb.Timestamp)(nil), // 2: google.protobuf.Timestamp
 }
 var file_proto_helloworld_proto_depIdxs = []int32{
-	0, // 0: helloworld.Greeter.SayHello:input_type -> helloworld.HelloRequest
-	0, // 1: helloworld.Greeter.SayHelloServerStream:input_type -> helloworld.HelloRequest
-	0, // 2: helloworld.Greeter.SayHelloClientStream:input_type -> helloworld.HelloRequest
-	0, // 3: helloworld.Greeter.SayHelloBidirectional:input_type -> helloworld.HelloRequest
-	1, // 4: helloworld.Greeter.SayHello:output_type -> helloworld.HelloReply
-	1, // 5: helloworld.Greeter.SayHelloServerStream:output_type -> helloworld.HelloReply
-	1, // 6: helloworld.Greeter.SayHelloClientStream:output_type -> helloworld.HelloReply
-	1, // 7: helloworld.Greeter.SayHelloBidirectional:output_type -> helloworld.HelloReply
-	4, // [4:8] is the sub-list for method output_type
-	0, // [0:4] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	2, // 0: helloworld.HelloReply.created_at:type_name -> google.protobuf.Timestamp
+	0, // 1: helloworld.Greeter.SayHello:input_type -> helloworld.HelloRequest
+	0, // 2: helloworld.Greeter.SayHelloServerStream:input_type -> helloworld.HelloRequest
+	0, // 3: helloworld.Greeter.SayHelloClientStream:input_type -> helloworld.HelloRequest
+	0, // 4: helloworld.Greeter.SayHelloBidirectional:input_type -> helloworld.HelloRequest
+	1, // 5: helloworld.Greeter.SayHello:output_type -> helloworld.HelloReply
+	1, // 6: helloworld.Greeter.SayHelloServerStream:output_type -> helloworld.HelloReply
+	1, // 7: helloworld.Greeter.SayHelloClientStream:output_type -> helloworld.HelloReply
+	1, // 8: helloworld.Greeter.SayHelloBidirectional:output_type -> helloworld.HelloReply
+	5, // [5:9] is the sub-list for method output_type
+	1, // [1:5] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_proto_helloworld_proto_init() }
@@ -164,6 +193,7 @@ func file_proto_helloworld_proto_init() {
 	if File_proto_helloworld_proto != nil {
 		return
 	}
+	file_proto_validate_proto_init()
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
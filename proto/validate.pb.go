@@ -0,0 +1,195 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v6.33.1
+// source: proto/validate.proto
+
+package helloworld
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// FieldRules are declarative constraints on a string field, in the spirit
+// of protovalidate. The server checks them in an interceptor before any
+// handler runs and rejects violations with INVALID_ARGUMENT and
+// google.rpc.BadRequest details.
+type FieldRules struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// required rejects the empty string.
+	Required bool `protobuf:"varint,1,opt,name=required,proto3" json:"required,omitempty"`
+	// min_len and max_len bound the length in characters (not bytes);
+	// 0 means no bound.
+	MinLen uint32 `protobuf:"varint,2,opt,name=min_len,json=minLen,proto3" json:"min_len,omitempty"`
+	MaxLen uint32 `protobuf:"varint,3,opt,name=max_len,json=maxLen,proto3" json:"max_len,omitempty"`
+	// pattern is an RE2 regular expression the whole value must match.
+	Pattern string `protobuf:"bytes,4,opt,name=pattern,proto3" json:"pattern,omitempty"`
+	// no_control_chars rejects Unicode control characters (category Cc),
+	// such as NUL, tabs and newlines.
+	NoControlChars bool `protobuf:"varint,5,opt,name=no_control_chars,json=noControlChars,proto3" json:"no_control_chars,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *FieldRules) Reset() {
+	*x = FieldRules{}
+	mi := &file_proto_validate_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FieldRules) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FieldRules) ProtoMessage() {}
+
+func (x *FieldRules) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_validate_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FieldRules.ProtoReflect.Descriptor instead.
+func (*FieldRules) Descriptor() ([]byte, []int) {
+	return file_proto_validate_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FieldRules) GetRequired() bool {
+	if x != nil {
+		return x.Required
+	}
+	return false
+}
+
+func (x *FieldRules) GetMinLen() uint32 {
+	if x != nil {
+		return x.MinLen
+	}
+	return 0
+}
+
+func (x *FieldRules) GetMaxLen() uint32 {
+	if x != nil {
+		return x.MaxLen
+	}
+	return 0
+}
+
+func (x *FieldRules) GetPattern() string {
+	if x != nil {
+		return x.Pattern
+	}
+	return ""
+}
+
+func (x *FieldRules) GetNoControlChars() bool {
+	if x != nil {
+		return x.NoControlChars
+	}
+	return false
+}
+
+var file_proto_validate_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*FieldRules)(nil),
+		Field:         50001,
+		Name:          "helloworld.rules",
+		Tag:           "bytes,50001,opt,name=rules",
+		Filename:      "proto/validate.proto",
+	},
+}
+
+// Extension fields to descriptorpb.FieldOptions.
+var (
+	// Usage: string name = 1 [(rules) = {required: true, max_len: 100}];
+	//
+	// optional helloworld.FieldRules rules = 50001;
+	E_Rules = &file_proto_validate_proto_extTypes[0]
+)
+
+var File_proto_validate_proto protoreflect.FileDescriptor
+
+const file_proto_validate_proto_rawDesc = "" +
+	"\n" +
+	"\x14proto/validate.proto\x12\n" +
+	"helloworld\x1a google/protobuf/descriptor.proto\"\x9e\x01\n" +
+	"\n" +
+	"FieldRules\x12\x1a\n" +
+	"\brequired\x18\x01 \x01(\bR\brequired\x12\x17\n" +
+	"\amin_len\x18\x02 \x01(\rR\x06minLen\x12\x17\n" +
+	"\amax_len\x18\x03 \x01(\rR\x06maxLen\x12\x18\n" +
+	"\apattern\x18\x04 \x01(\tR\apattern\x12(\n" +
+	"\x10no_control_chars\x18\x05 \x01(\bR\x0enoControlChars:M\n" +
+	"\x05rules\x12\x1d.google.protobuf.FieldOptions\x18ц\x03 \x01(\v2\x16.helloworld.FieldRulesR\x05rulesB\x14Z\x12./proto;helloworldb\x06proto3"
+
+var (
+	file_proto_validate_proto_rawDescOnce sync.Once
+	file_proto_validate_proto_rawDescData []byte
+)
+
+func file_proto_validate_proto_rawDescGZIP() []byte {
+	file_proto_validate_proto_rawDescOnce.Do(func() {
+		file_proto_validate_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_validate_proto_rawDesc), len(file_proto_validate_proto_rawDesc)))
+	})
+	return file_proto_validate_proto_rawDescData
+}
+
+var file_proto_validate_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_proto_validate_proto_goTypes = []any{
+	(*FieldRules)(nil),                // 0: helloworld.FieldRules
+	(*descriptorpb.FieldOptions)(nil), // 1: google.protobuf.FieldOptions
+}
+var file_proto_validate_proto_depIdxs = []int32{
+	1, // 0: helloworld.rules:extendee -> google.protobuf.FieldOptions
+	0, // 1: helloworld.rules:type_name -> helloworld.FieldRules
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	1, // [1:2] is the sub-list for extension type_name
+	0, // [0:1] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_proto_validate_proto_init() }
+func file_proto_validate_proto_init() {
+	if File_proto_validate_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_validate_proto_rawDesc), len(file_proto_validate_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 1,
+			NumServices:   0,
+		},
+		GoTypes:           file_proto_validate_proto_goTypes,
+		DependencyIndexes: file_proto_validate_proto_depIdxs,
+		MessageInfos:      file_proto_validate_proto_msgTypes,
+		ExtensionInfos:    file_proto_validate_proto_extTypes,
+	}.Build()
+	File_proto_validate_proto = out.File
+	file_proto_validate_proto_goTypes = nil
+	file_proto_validate_proto_depIdxs = nil
+}
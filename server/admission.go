@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "grpc-example/proto"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// latencyWeight is the weight of the newest sample in the moving average
+// of call latency.
+const latencyWeight = 0.2
+
+// admissionController implements server.load_shedding. It samples the
+// database pool, the number of calls in flight and their latency, and
+// while any of them is over its limit rejects new calls and streams with
+// Unavailable before they queue up for a database connection inside
+// database/sql. Work that was already admitted keeps running, so
+// established streams take priority over new ones.
+type admissionController struct {
+	pool pooled // nil when the repository has no pool
+
+	inFlight atomic.Int64
+	pressure atomic.Pointer[string] // why calls are being shed, nil if they are not
+
+	mu        sync.Mutex
+	latency   time.Duration // moving average
+	observed  int           // calls folded into latency since the last sample
+	lastWaits int64
+	lastWait  time.Duration
+}
+
+func newAdmissionController(pool pooled) *admissionController {
+	return &admissionController{pool: pool}
+}
+
+// unaryInterceptor - Sheds new unary calls under pressure and measures latency
+func (ac *admissionController) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := ac.admit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	defer ac.inFlight.Add(-1)
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	ac.observe(time.Since(start))
+	return resp, err
+}
+
+// streamInterceptor - Sheds new streams under pressure
+func (ac *admissionController) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := ac.admit(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	defer ac.inFlight.Add(-1)
+	start := time.Now()
+	err := handler(srv, ss)
+	// Only client streams finish in a time that reflects server load; the
+	// others last as long as the client or the stream's own pacing wants.
+	if info.IsClientStream && !info.IsServerStream {
+		ac.observe(time.Since(start))
+	}
+	return err
+}
+
+// admit counts the call as in flight, or rejects it with Unavailable and a
+// retry hint while the server is under pressure.
+func (ac *admissionController) admit(ctx context.Context, method string) error {
+	cfg := settings.Current().Server.LoadShedding
+	if !cfg.Enabled || neverShed(method) {
+		ac.inFlight.Add(1)
+		return nil
+	}
+	reason := ac.pressure.Load()
+	if reason == nil && ac.inFlight.Load() >= cfg.MaxInFlight {
+		r := fmt.Sprintf("%d calls in flight", ac.inFlight.Load())
+		reason = &r
+	}
+	if reason != nil {
+		log.WarnContext(ctx, "call shed", "method", method, "reason", *reason, "retry_after", cfg.RetryAfter)
+		return overloaded(*reason, cfg.RetryAfter)
+	}
+	ac.inFlight.Add(1)
+	return nil
+}
+
+// neverShed reports whether method is admitted whatever the pressure:
+// health checks and Admin.Drain are cheap, stay off the database and are
+// needed most while the server is struggling. The other admin calls (data
+// exports, erasures, audit queries, stats) are among the heaviest on the
+// database, so they are shed like any other call.
+func neverShed(method string) bool {
+	return strings.HasPrefix(method, "/grpc.health.v1.Health/") || method == pb.Admin_Drain_FullMethodName
+}
+
+// observe folds the latency of a finished call into the moving average.
+func (ac *admissionController) observe(d time.Duration) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.observed++
+	if ac.latency == 0 {
+		ac.latency = d
+		return
+	}
+	ac.latency += time.Duration(latencyWeight * float64(d-ac.latency))
+}
+
+// monitor re-evaluates pressure every server.load_shedding.sample_interval
+// until ctx is done.
+func (ac *admissionController) monitor(ctx context.Context) {
+	interval := settings.Current().Server.LoadShedding.SampleInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cfg := settings.Current().Server.LoadShedding
+		if cfg.SampleInterval != interval {
+			interval = cfg.SampleInterval
+			ticker.Reset(interval)
+		}
+
+		reason := ac.sample()
+		previous := ac.pressure.Load()
+		switch {
+		case reason != "" && cfg.Enabled:
+			if previous == nil {
+				log.Warn("load shedding engaged", "reason", reason, "in_flight", ac.inFlight.Load())
+			}
+			ac.pressure.Store(&reason)
+		case previous != nil:
+			log.Info("load shedding released", "in_flight", ac.inFlight.Load())
+			ac.pressure.Store(nil)
+		}
+	}
+}
+
+// sample reports why the server is under pressure, or "" if it is not.
+func (ac *admissionController) sample() string {
+	cfg := settings.Current().Server.LoadShedding
+	var stats sql.DBStats
+	if ac.pool != nil {
+		stats = ac.pool.Stats()
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	waits := stats.WaitCount - ac.lastWaits
+	waited := stats.WaitDuration - ac.lastWait
+	ac.lastWaits, ac.lastWait = stats.WaitCount, stats.WaitDuration
+
+	// Let the average decay while no calls finish, otherwise a burst of
+	// slow calls would keep the server shedding the very calls that could
+	// bring the average back down.
+	if ac.observed == 0 {
+		ac.latency -= time.Duration(latencyWeight * float64(ac.latency))
+	}
+	ac.observed = 0
+
+	switch {
+	case waits > 0 && waited/time.Duration(waits) > cfg.MaxPoolWait:
+		return fmt.Sprintf("database pool saturated: %d waits averaging %s (%d/%d connections in use)",
+			waits, waited/time.Duration(waits), stats.InUse, stats.MaxOpenConnections)
+	case ac.inFlight.Load() >= cfg.MaxInFlight:
+		return fmt.Sprintf("%d calls in flight", ac.inFlight.Load())
+	case ac.latency > cfg.MaxLatency:
+		return fmt.Sprintf("average latency %s", ac.latency.Round(time.Millisecond))
+	}
+	return ""
+}
+
+// overloaded builds an Unavailable status carrying a RetryInfo detail.
+func overloaded(reason string, retryAfter time.Duration) error {
+	st := status.New(codes.Unavailable, "server overloaded, retry later: "+reason)
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
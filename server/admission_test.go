@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"grpc-example/config"
+	"grpc-example/logging"
+	pb "grpc-example/proto"
+)
+
+func TestAdmitUnderPressure(t *testing.T) {
+	cfg := config.Defaults("dev")
+	cfg.Server.LoadShedding.Enabled = true
+	settings = config.NewReloader(cfg, nil, logging.For("config"))
+	ac := newAdmissionController(nil)
+	reason := "pool saturated"
+	ac.pressure.Store(&reason)
+
+	tests := []struct {
+		method string
+		shed   bool
+	}{
+		{"/grpc.health.v1.Health/Check", false},
+		{"/grpc.health.v1.Health/Watch", false},
+		{pb.Admin_Drain_FullMethodName, false},
+		{pb.Greeter_SayHelloServerStream_FullMethodName, true},
+		{pb.Greeter_SayHelloClientStream_FullMethodName, true},
+		{pb.Admin_ExportUserData_FullMethodName, true},
+		{pb.Admin_EraseUser_FullMethodName, true},
+		{pb.Admin_QueryAuditEvents_FullMethodName, true},
+		{pb.Admin_GetGreetingStats_FullMethodName, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			err := ac.admit(context.Background(), tt.method)
+			if !tt.shed {
+				if err != nil {
+					t.Fatalf("admit = %v, want the call admitted", err)
+				}
+				ac.inFlight.Add(-1)
+				return
+			}
+			if status.Code(err) != codes.Unavailable {
+				t.Fatalf("admit = %v, want the call shed with Unavailable", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"grpc-example/config"
+	"grpc-example/logging"
+	pb "grpc-example/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var auditLog = logging.For("audit")
+
+// auditLockID serializes appends to the chain across replicas on Postgres.
+const auditLockID int64 = 0x67727063_61756474 // "grpcaudt"
+
+// auditInsertBatch is the most events inserted per statement.
+const auditInsertBatch = 500
+
+// auditDroppedMethod is the method of the event recording dropped events.
+const auditDroppedMethod = "(audit)/dropped"
+
+// AuditFilter selects audit events; zero fields match everything.
+type AuditFilter struct {
+	Method, Caller, Code string
+	Since, Until         time.Time
+	AfterSeq             int64
+	Limit                int
+}
+
+func (f *AuditFilter) matches(e *AuditEvent) bool {
+	return e.Seq > f.AfterSeq &&
+		(f.Method == "" || e.Method == f.Method) &&
+		(f.Caller == "" || e.Caller == f.Caller) &&
+		(f.Code == "" || e.Code == f.Code) &&
+		(f.Since.IsZero() || !e.At.Before(f.Since)) &&
+		(f.Until.IsZero() || e.At.Before(f.Until))
+}
+
+// devAuditKey keys the chain in the dev profile when server.audit.key_env
+// is not set. It is public, so such a chain only shows accidental damage.
+const devAuditKey = "grpc-example-dev-audit-key"
+
+// auditKey reads the HMAC key of the chain from the environment variable
+// named by server.audit.key_env.
+func auditKey(cfg *config.Config) ([]byte, error) {
+	env := cfg.Server.Audit.KeyEnv
+	if key := os.Getenv(env); key != "" {
+		return []byte(key), nil
+	}
+	if cfg.Profile == config.ProfileProd {
+		return nil, fmt.Errorf("environment variable %s (server.audit.key_env) is not set", env)
+	}
+	auditLog.Warn("audit key not set, using the public dev key", "env", env)
+	return []byte(devAuditKey), nil
+}
+
+// computeHash returns the hex HMAC-SHA256, keyed with key, of everything in
+// the event but its own hash. The timestamp is hashed in UTC at microsecond
+// precision, which is what Postgres keeps.
+func (e *AuditEvent) computeHash(key []byte) string {
+	fields, _ := json.Marshal([]any{
+		e.Seq, e.At.UTC().Format(time.RFC3339Nano), e.Method, e.Caller, e.Peer, e.Code,
+		e.DurationMs, e.RequestID, e.Detail, e.PrevHash,
+	})
+	mac := hmac.New(sha256.New, key)
+	mac.Write(fields)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// chainAuditEvents numbers events after head (the zero event for an empty
+// log) and links each to the one before it.
+func chainAuditEvents(key []byte, head *AuditEvent, events []AuditEvent) {
+	prev := head
+	for i := range events {
+		e := &events[i]
+		e.Seq = prev.Seq + 1
+		e.PrevHash = prev.Hash
+		e.Hash = e.computeHash(key)
+		prev = e
+	}
+}
+
+// verifyAuditLink describes what is wrong with e, given the event before it
+// (nil for the first one), or returns "".
+func verifyAuditLink(key []byte, prev, e *AuditEvent) string {
+	switch {
+	case !hmac.Equal([]byte(e.Hash), []byte(e.computeHash(key))):
+		return "hash does not match the contents, the event was altered"
+	case prev == nil && e.Seq != 1:
+		return fmt.Sprintf("the log starts at seq %d, events 1..%d are missing", e.Seq, e.Seq-1)
+	case prev == nil && e.PrevHash != "":
+		return "the first event has a prev_hash"
+	case prev != nil && e.Seq == prev.Seq+2:
+		return fmt.Sprintf("event %d is missing", prev.Seq+1)
+	case prev != nil && e.Seq != prev.Seq+1:
+		return fmt.Sprintf("events %d..%d are missing", prev.Seq+1, e.Seq-1)
+	case prev != nil && e.PrevHash != prev.Hash:
+		return fmt.Sprintf("prev_hash does not match the hash of seq %d, an event was replaced", prev.Seq)
+	}
+	return ""
+}
+
+// auditor records every Greeter and Admin call. Interceptors hand events
+// over without blocking; a single goroutine writes them in batches. When
+// the buffer is full events are dropped, and the next batch records how
+// many, so the loss shows in the chain itself.
+type auditor struct {
+	repo Repository
+	cfg  config.AuditConfig
+	key  []byte
+
+	events chan AuditEvent
+	stop   context.CancelFunc
+	done   chan struct{}
+
+	dropped                 atomic.Int64 // not yet recorded in the chain
+	written, lost, failures atomic.Int64
+
+	mu   sync.Mutex
+	head AuditEvent // last event written by this process
+}
+
+// auditStats is published as the "audit" expvar.
+type auditStats struct {
+	Queued   int    `json:"queued"`
+	Written  int64  `json:"written"`
+	Dropped  int64  `json:"dropped"`
+	Failures int64  `json:"failures"` // failed batch writes, retried
+	HeadSeq  int64  `json:"head_seq"`
+	HeadHash string `json:"head_hash"`
+}
+
+// newAuditor starts the writer; close flushes and stops it. It returns nil,
+// which records nothing, when server.audit is disabled, and fails when the
+// key is missing (see auditKey).
+func newAuditor(repo Repository, cfg *config.Config) (*auditor, error) {
+	if !cfg.Server.Audit.Enabled {
+		return nil, nil
+	}
+	key, err := auditKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	a := &auditor{
+		repo:   repo,
+		cfg:    cfg.Server.Audit,
+		key:    key,
+		events: make(chan AuditEvent, cfg.Server.Audit.BufferSize),
+		done:   make(chan struct{}),
+	}
+	var ctx context.Context
+	ctx, a.stop = context.WithCancel(context.Background())
+	go a.run(ctx)
+	return a, nil
+}
+
+// audited reports whether calls to method are recorded.
+func audited(method string) bool {
+	return strings.HasPrefix(method, "/"+pb.Greeter_ServiceDesc.ServiceName+"/") ||
+		strings.HasPrefix(method, "/"+pb.Admin_ServiceDesc.ServiceName+"/")
+}
+
+// record queues the event of a finished call.
+func (a *auditor) record(ctx context.Context, method string, start time.Time, err error) {
+	cfg := settings.Current()
+	// Authentication runs further down the chain, and the caller must be
+	// known even for calls rejected before it; a bad key records the peer
+	authCtx, _ := authenticate(ctx)
+	e := AuditEvent{
+		At:         start.UTC().Truncate(time.Microsecond),
+		Method:     method,
+		Caller:     callerSubject(authCtx, cfg),
+		Peer:       clientAddr(ctx, cfg.Server.RateLimit.TrustedProxies),
+		Code:       status.Code(err).String(),
+		DurationMs: time.Since(start).Milliseconds(),
+		RequestID:  logging.RequestID(ctx),
+	}
+	select {
+	case a.events <- e:
+	default:
+		if a.dropped.Add(1) == 1 {
+			auditLog.Warn("audit buffer full, dropping events", "buffer_size", a.cfg.BufferSize)
+		}
+	}
+}
+
+// unaryInterceptor - Records the outcome of audited unary calls
+func (a *auditor) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if a == nil || !audited(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	a.record(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+// streamInterceptor - Records the outcome of audited streams when they end
+func (a *auditor) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if a == nil || !audited(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	start := time.Now()
+	err := handler(srv, ss)
+	a.record(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+// run - Writes batches of BatchSize, or whatever is queued every
+// FlushInterval. A batch that fails is kept and retried at the next
+// interval, while new events wait in the buffer.
+func (a *auditor) run(ctx context.Context) {
+	defer close(a.done)
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []AuditEvent
+	for {
+		events := a.events
+		if len(batch) >= a.cfg.BatchSize {
+			events = nil // full: wait for the tick to retry it
+		}
+		select {
+		case e := <-events:
+			batch = append(batch, e)
+			if len(batch) < a.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			// Last chance for whatever is queued
+			for len(a.events) > 0 {
+				batch = append(batch, <-a.events)
+			}
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if batch = a.flush(flushCtx, batch); len(batch) > 0 {
+				a.lost.Add(int64(len(batch)))
+				auditLog.Error("audit events lost at shutdown", "events", len(batch))
+			}
+			cancel()
+			return
+		}
+		batch = a.flush(ctx, batch)
+	}
+}
+
+// flush writes batch, adding an event for the drops since the last flush,
+// and returns what is left to write.
+func (a *auditor) flush(ctx context.Context, batch []AuditEvent) []AuditEvent {
+	if n := a.dropped.Swap(0); n > 0 {
+		a.lost.Add(n)
+		batch = append(batch, AuditEvent{
+			At:     time.Now().UTC().Truncate(time.Microsecond),
+			Method: auditDroppedMethod,
+			Caller: "server",
+			Code:   codes.DataLoss.String(),
+			Detail: fmt.Sprintf("%d events dropped, the audit buffer was full", n),
+		})
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := a.repo.AppendAuditEvents(ctx, a.key, batch); err != nil {
+		if ctx.Err() == nil {
+			a.failures.Add(1)
+			auditLog.Error("audit write failed, retrying", "events", len(batch), "error", err)
+		}
+		return batch
+	}
+	a.written.Add(int64(len(batch)))
+	a.mu.Lock()
+	a.head = batch[len(batch)-1]
+	a.mu.Unlock()
+	return batch[:0]
+}
+
+// close stops the writer after a last flush, waiting up to timeout.
+func (a *auditor) close(timeout time.Duration) {
+	if a == nil {
+		return
+	}
+	a.stop()
+	select {
+	case <-a.done:
+	case <-time.After(timeout):
+		auditLog.Error("audit writer did not finish in time", "queued", len(a.events))
+	}
+}
+
+// Stats returns the writer's counters and the last event it wrote.
+func (a *auditor) Stats() auditStats {
+	a.mu.Lock()
+	head := a.head
+	a.mu.Unlock()
+	return auditStats{
+		Queued:   len(a.events),
+		Written:  a.written.Load(),
+		Dropped:  a.lost.Load() + a.dropped.Load(),
+		Failures: a.failures.Load(),
+		HeadSeq:  head.Seq,
+		HeadHash: head.Hash,
+	}
+}
+
+// publish exposes Stats as an expvar (served on server.debug_addr).
+func (a *auditor) publish(name string) {
+	if expvar.Get(name) == nil {
+		expvar.Publish(name, expvar.Func(func() any { return a.Stats() }))
+	}
+}
+
+// QueryAuditEvents - Returns a filtered page of the audit log
+func (a *adminServer) QueryAuditEvents(ctx context.Context, in *pb.QueryAuditEventsRequest) (*pb.QueryAuditEventsReply, error) {
+	if err := requireScope(ctx, adminScope); err != nil {
+		return nil, err
+	}
+	if in.Limit < 0 || in.AfterSeq < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit and after_seq must not be negative")
+	}
+	filter := AuditFilter{
+		Method:   in.Method,
+		Caller:   in.Caller,
+		Code:     in.Code,
+		AfterSeq: in.AfterSeq,
+		Limit:    min(int(in.Limit), 1000),
+	}
+	if filter.Limit == 0 {
+		filter.Limit = 100
+	}
+	if in.Since != nil {
+		filter.Since = in.Since.AsTime()
+	}
+	if in.Until != nil {
+		filter.Until = in.Until.AsTime()
+	}
+
+	events, err := a.repo.AuditEvents(ctx, filter)
+	if err != nil {
+		return nil, a.dbError(ctx, "audit query failed", err)
+	}
+	reply := &pb.QueryAuditEventsReply{Events: make([]*pb.AuditEvent, len(events))}
+	for i, e := range events {
+		reply.Events[i] = &pb.AuditEvent{
+			Seq:        e.Seq,
+			At:         timestamppb.New(e.At),
+			Method:     e.Method,
+			Caller:     e.Caller,
+			Peer:       e.Peer,
+			Code:       e.Code,
+			DurationMs: e.DurationMs,
+			RequestId:  e.RequestID,
+			Detail:     e.Detail,
+			PrevHash:   e.PrevHash,
+			Hash:       e.Hash,
+		}
+	}
+	if len(events) == filter.Limit {
+		reply.NextAfterSeq = events[len(events)-1].Seq
+	}
+	return reply, nil
+}
+
+// runAuditVerifyCommand - "audit-verify": walks the whole audit log and
+// reports every event that was altered, removed or replaced, which needs
+// the server's key. Events removed from the end leave no gap; compare the
+// head it prints with one recorded earlier (the "audit" expvar shows it too).
+func runAuditVerifyCommand(cfg *config.Config) error {
+	key, err := auditKey(cfg)
+	if err != nil {
+		return fmt.Errorf("audit-verify: %w", err)
+	}
+	repo, err := openRepository(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	var broken int
+	n, head, err := verifyAuditChain(context.Background(), repo, key, func(seq int64, problem string) {
+		fmt.Printf("seq %d: %s\n", seq, problem)
+		broken++
+	})
+	switch {
+	case err != nil:
+		return fmt.Errorf("audit-verify: %w", err)
+	case broken > 0:
+		return fmt.Errorf("audit-verify: %d problem(s) in %d events", broken, n)
+	case head == nil:
+		fmt.Println("the audit log is empty")
+	default:
+		fmt.Printf("audit chain intact: %d events, head seq %d hash %s\n", n, head.Seq, head.Hash)
+	}
+	return nil
+}
+
+// verifyAuditChain reads the whole log in order, calls report for every
+// broken link (see verifyAuditLink), and returns the number of events and
+// the last one.
+func verifyAuditChain(ctx context.Context, repo Repository, key []byte, report func(seq int64, problem string)) (int, *AuditEvent, error) {
+	var prev *AuditEvent
+	n := 0
+	for {
+		after := int64(0)
+		if prev != nil {
+			after = prev.Seq
+		}
+		events, err := repo.AuditEvents(ctx, AuditFilter{AfterSeq: after, Limit: 1000})
+		if err != nil || len(events) == 0 {
+			return n, prev, err
+		}
+		for i := range events {
+			if problem := verifyAuditLink(key, prev, &events[i]); problem != "" {
+				report(events[i].Seq, problem)
+			}
+			prev = &events[i]
+			n++
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tamperAudit changes the stored audit log behind the repository's back:
+// fn gets each stored event and returns it changed, or nil to delete it.
+func tamperAudit(t *testing.T, repo Repository, fn func(e AuditEvent) *AuditEvent) {
+	t.Helper()
+	switch r := repo.(type) {
+	case *memoryRepository:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		var kept []AuditEvent
+		for _, e := range r.audit {
+			if changed := fn(e); changed != nil {
+				kept = append(kept, *changed)
+			}
+		}
+		r.audit = kept
+	case *gormRepository:
+		var events []AuditEvent
+		if err := r.db.Order("seq").Find(&events).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range events {
+			changed := fn(e)
+			var err error
+			switch {
+			case changed == nil:
+				err = r.db.Delete(&AuditEvent{}, e.Seq).Error
+			case *changed != e:
+				err = r.db.Save(changed).Error
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	default:
+		t.Fatalf("cannot tamper with a %T", repo)
+	}
+}
+
+func TestAuditChainDetectsTampering(t *testing.T) {
+	key := []byte("test audit key")
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			at := time.Now().UTC().Truncate(time.Microsecond)
+			events := make([]AuditEvent, 8)
+			for i := range events {
+				events[i] = AuditEvent{At: at.Add(time.Duration(i) * time.Second), Method: "/helloworld.Greeter/SayHelloServerStream",
+					Caller: "test", Code: "OK", Detail: fmt.Sprintf("call %d", i+1)}
+			}
+			// Two appends, so the second one chains onto the stored head
+			if err := repo.AppendAuditEvents(ctx, key, events[:3]); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.AppendAuditEvents(ctx, key, events[3:]); err != nil {
+				t.Fatal(err)
+			}
+
+			verify := func() map[int64]string {
+				t.Helper()
+				problems, err := verifyWithKey(ctx, repo, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return problems
+			}
+			if problems := verify(); len(problems) != 0 {
+				t.Fatalf("intact chain reported %v", problems)
+			}
+			if problems, _ := verifyWithKey(ctx, repo, []byte("another key")); len(problems) != 8 {
+				t.Fatalf("chain verified with the wrong key reported %d problems, want all 8", len(problems))
+			}
+
+			tamperAudit(t, repo, func(e AuditEvent) *AuditEvent {
+				switch e.Seq {
+				case 2: // edited
+					e.Code = "PermissionDenied"
+				case 4: // deleted
+					return nil
+				case 6: // replaced, hashed without the real key
+					e.Caller = "someone else"
+					e.Hash = e.computeHash([]byte("guessed key"))
+				}
+				return &e
+			})
+			problems := verify()
+			want := map[int64]string{
+				2: "was altered",
+				5: "event 4 is missing",
+				6: "was altered",
+				7: "prev_hash does not match the hash of seq 6, an event was replaced",
+			}
+			seqs := func(m map[int64]string) []int64 {
+				var s []int64
+				for seq := range m {
+					s = append(s, seq)
+				}
+				slices.Sort(s)
+				return s
+			}
+			if !slices.Equal(seqs(problems), seqs(want)) {
+				t.Fatalf("problems at seqs %v, want %v: %v", seqs(problems), seqs(want), problems)
+			}
+			for seq, problem := range want {
+				if !strings.Contains(problems[seq], problem) {
+					t.Errorf("seq %d: %q, want it to say %q", seq, problems[seq], problem)
+				}
+			}
+		})
+	}
+}
+
+// verifyWithKey verifies the chain with key and returns the problems found.
+func verifyWithKey(ctx context.Context, repo Repository, key []byte) (map[int64]string, error) {
+	problems := make(map[int64]string)
+	_, _, err := verifyAuditChain(ctx, repo, key, func(seq int64, problem string) { problems[seq] = problem })
+	return problems, err
+}
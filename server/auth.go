@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"strings"
+
+	"grpc-example/config"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// principal is the authenticated caller of an RPC.
+type principal struct {
+	KeyName string   // auth.api_keys[].name
+	User    string   // auth.api_keys[].user, may be empty
+	Scopes  []string // auth.api_keys[].scopes
+}
+
+func (p *principal) hasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// principalFrom returns the authenticated caller, or nil for anonymous calls.
+func principalFrom(ctx context.Context) *principal {
+	p, _ := ctx.Value(principalKey{}).(*principal)
+	return p
+}
+
+// authenticate resolves the API key sent as "x-api-key" or
+// "authorization: Bearer <key>". Calls without a key are anonymous; an
+// unknown key is rejected with Unauthenticated.
+func authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	key := firstMetadata(md, "x-api-key")
+	if key == "" {
+		if bearer, ok := strings.CutPrefix(firstMetadata(md, "authorization"), "Bearer "); ok {
+			key = strings.TrimSpace(bearer)
+		}
+	}
+	if key == "" {
+		return ctx, nil
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	for _, k := range settings.Current().Auth.APIKeys {
+		want, err := hex.DecodeString(k.SHA256)
+		if err == nil && subtle.ConstantTimeCompare(sum[:], want) == 1 {
+			return context.WithValue(ctx, principalKey{}, &principal{
+				KeyName: k.Name,
+				User:    k.User,
+				Scopes:  k.Scopes,
+			}), nil
+		}
+	}
+	return ctx, status.Error(codes.Unauthenticated, "unknown API key")
+}
+
+// requireScope fails with Unauthenticated for anonymous callers and
+// PermissionDenied for keys without scope.
+func requireScope(ctx context.Context, scope string) error {
+	p := principalFrom(ctx)
+	if p == nil {
+		return status.Error(codes.Unauthenticated, "an API key is required")
+	}
+	if !p.hasScope(scope) {
+		return status.Errorf(codes.PermissionDenied, "API key %q lacks the %q scope", p.KeyName, scope)
+	}
+	return nil
+}
+
+// authUnaryInterceptor - Attaches the authenticated caller to the context
+func authUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(withCaller(ctx), req)
+}
+
+// authStreamInterceptor - Attaches the authenticated caller to the stream context
+func authStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: withCaller(ctx)})
+}
+
+// callerSubject identifies the caller for rate limits and quotas:
+// "user:<name>" for authenticated users, "key:<name>" for API keys without
+// a user, and "peer:<ip>" for anonymous callers. Anonymous calls relayed by
+// a trusted proxy (the gateway) are keyed by the forwarded client address.
+func callerSubject(ctx context.Context, cfg *config.Config) string {
+	if p := principalFrom(ctx); p != nil {
+		if p.User != "" {
+			return "user:" + p.User
+		}
+		return "key:" + p.KeyName
+	}
+	return "peer:" + clientAddr(ctx, cfg.Server.RateLimit.TrustedProxies)
+}
+
+type callerKey struct{}
+
+// withCaller records callerSubject in ctx for code that has no config at
+// hand, such as read-your-writes routing in the repository.
+func withCaller(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callerKey{}, callerSubject(ctx, settings.Current()))
+}
+
+// callerFrom returns the subject recorded by withCaller, or "" outside an RPC.
+func callerFrom(ctx context.Context) string {
+	subject, _ := ctx.Value(callerKey{}).(string)
+	return subject
+}
+
+// clientAddr returns the caller's IP, honouring x-forwarded-for from
+// trusted proxies. Proxies append the address they got the request from,
+// so the list is walked from the right: the first entry that is not itself
+// a trusted proxy is the client, and anything left of it is whatever the
+// client chose to send.
+func clientAddr(ctx context.Context, trustedProxies []string) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !trusted(addr, trustedProxies) {
+		return host
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	hops := strings.Split(strings.Join(md.Get("x-forwarded-for"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		host = hop
+		if addr, err := netip.ParseAddr(hop); err != nil || !trusted(addr, trustedProxies) {
+			break
+		}
+	}
+	return host
+}
+
+func trusted(addr netip.Addr, cidrs []string) bool {
+	for _, c := range cidrs {
+		if prefix, err := netip.ParsePrefix(c); err == nil && prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
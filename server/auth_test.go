@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestClientAddr(t *testing.T) {
+	proxies := []string{"127.0.0.1/32", "10.0.0.0/8"}
+	tests := []struct {
+		name, peer, forwarded, want string
+	}{
+		{"direct", "203.0.113.7", "", "203.0.113.7"},
+		{"untrusted peer sends a header", "203.0.113.7", "198.51.100.1", "203.0.113.7"},
+		{"through the gateway", "127.0.0.1", "203.0.113.7", "203.0.113.7"},
+		{"spoofed entries are skipped", "127.0.0.1", "198.51.100.1, 192.0.2.9, 203.0.113.7", "203.0.113.7"},
+		{"chain of trusted proxies", "127.0.0.1", "198.51.100.1, 203.0.113.7, 10.1.2.3", "203.0.113.7"},
+		{"only proxies", "127.0.0.1", "10.1.2.3", "10.1.2.3"},
+		{"gateway without a header", "127.0.0.1", "", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(tt.peer), Port: 4242}})
+			if tt.forwarded != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", tt.forwarded))
+			}
+			if got := clientAddr(ctx, proxies); got != tt.want {
+				t.Errorf("clientAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
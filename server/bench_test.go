@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"grpc-example/config"
+
+	"github.com/google/uuid"
+)
+
+// benchDatabaseEnv names a database URL (e.g. Postgres) for the batch
+// benchmarks; they use a temporary SQLite database without it.
+const benchDatabaseEnv = "BENCH_DATABASE_URL"
+
+// benchBatchNames is the number of names per client-stream batch.
+const benchBatchNames = 100
+
+// benchRepository opens the benchmark database with the user cache off, so
+// every lookup pays for its round trip. Everything the benchmark creates
+// is named with the returned prefix and deleted when it ends.
+func benchRepository(b *testing.B) (*gormRepository, string) {
+	b.Helper()
+	cfg := config.Defaults("dev").Database
+	cfg.URL = os.Getenv(benchDatabaseEnv)
+	if cfg.URL == "" {
+		cfg.URL = sqliteScheme + filepath.Join(b.TempDir(), "bench.db")
+	}
+	cfg.UserCache.Size = 0
+	repo, err := openGormRepository(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	prefix := "bench-" + uuid.NewString()[:8] + "-"
+	b.Cleanup(func() {
+		defer repo.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		users := repo.db.WithContext(ctx).Model(&User{}).Select("id").Where("name LIKE ?", prefix+"%")
+		err := errors.Join(
+			repo.db.WithContext(ctx).Where("user_id IN (?)", users).Delete(&Greeting{}).Error,
+			repo.db.WithContext(ctx).Where("name LIKE ?", prefix+"%").Delete(&User{}).Error,
+		)
+		if err != nil {
+			b.Errorf("cleanup failed: %v", err)
+		}
+	})
+	return repo, prefix
+}
+
+// storeBatchPerName stores a batch the way client streams used to: a
+// GetOrCreateUser per name in parallel, then greetings in INSERTs of 100.
+func storeBatchPerName(ctx context.Context, repo *gormRepository, names []string) error {
+	var wg sync.WaitGroup
+	users := make([]*User, len(names))
+	errs := make([]error, len(names))
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			users[i], errs[i] = repo.GetOrCreateUser(ctx, name)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	greetings := make([]Greeting, len(users))
+	for i, user := range users {
+		greetings[i] = Greeting{Message: "Hello " + user.Name, UserID: &user.ID}
+	}
+	return repo.db.WithContext(ctx).CreateInBatches(greetings, 100).Error
+}
+
+// storeBatch stores a batch the set-based way client streams do now.
+func storeBatch(ctx context.Context, repo *gormRepository, names []string) error {
+	users, err := repo.GetOrCreateUsers(ctx, names)
+	if err != nil {
+		return err
+	}
+	greetings := make([]Greeting, len(names))
+	for i, name := range names {
+		greetings[i] = Greeting{Message: "Hello " + name, UserID: &users[name].ID}
+	}
+	return repo.CreateGreetings(ctx, greetings, nil)
+}
+
+// BenchmarkGetOrCreateUsers times one client-stream batch of new names, and
+// of names that all exist already, per approach.
+//
+//	go test ./server -run '^$' -bench GetOrCreateUsers
+//	BENCH_DATABASE_URL=postgres://... go test ./server -run '^$' -bench GetOrCreateUsers
+func BenchmarkGetOrCreateUsers(b *testing.B) {
+	approaches := []struct {
+		name  string
+		store func(context.Context, *gormRepository, []string) error
+	}{
+		{"per-name", storeBatchPerName},
+		{"set-based", storeBatch},
+	}
+	for _, a := range approaches {
+		for _, existing := range []bool{false, true} {
+			scenario := "new"
+			if existing {
+				scenario = "existing"
+			}
+			b.Run(a.name+"/"+scenario, func(b *testing.B) {
+				ctx := context.Background()
+				repo, prefix := benchRepository(b)
+				batch := func(n int) []string {
+					names := make([]string, benchBatchNames)
+					for i := range names {
+						names[i] = fmt.Sprintf("%s%d-%d", prefix, n, i)
+					}
+					return names
+				}
+				if existing {
+					if err := a.store(ctx, repo, batch(0)); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				b.ResetTimer()
+				for n := range b.N {
+					names := batch(0)
+					if !existing {
+						names = batch(n + 1)
+					}
+					if err := a.store(ctx, repo, names); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*benchBatchNames), "ns/name")
+			})
+		}
+	}
+}
@@ -1,26 +1,45 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
 	"net/url"
-	"os"
+	"reflect"
 	"strings"
-	"sync"
 	"time"
 
+	"grpc-example/config"
+	"grpc-example/logging"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/stdlib"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	"gorm.io/gorm/clause"
 )
 
+var dbLog = logging.For("database")
+
+// schemaModels are the GORM models; check-prisma compares them with
+// prisma/schema.prisma and the migrations must create their tables.
+var schemaModels = []any{&User{}, &Greeting{}, &QuotaUsage{}, &UserErasure{}, &AuditEvent{}, &OutboxMessage{},
+	&GreetingRollup{}, &BatchRollup{}, &RollupWatermark{}}
+
 // Database models matching Prisma schema
 type User struct {
-	ID        string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	Name      string    `gorm:"not null;uniqueIndex" json:"name"` // Changed to uniqueIndex for faster lookups
-	Email     *string   `gorm:"uniqueIndex" json:"email"`
-	CreatedAt int64     `gorm:"autoCreateTime" json:"createdAt"`
-	UpdatedAt int64     `gorm:"autoUpdateTime" json:"updatedAt"`
+	ID        string     `gorm:"type:uuid;primaryKey" json:"id"`
+	Name      string     `gorm:"not null;uniqueIndex" json:"name"` // Changed to uniqueIndex for faster lookups
+	Email     *string    `gorm:"uniqueIndex" json:"email"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"` // RFC 3339 in JSON
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
 	Greetings []Greeting `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"greetings"`
 }
 
@@ -28,178 +47,1143 @@ func (User) TableName() string {
 	return "users"
 }
 
+// BeforeCreate assigns the ID in the application, like Prisma's uuid(), so
+// every dialect works without a database-side generator
+func (u *User) BeforeCreate(*gorm.DB) error {
+	if u.ID == "" {
+		u.ID = uuid.NewString()
+	}
+	return nil
+}
+
 type Greeting struct {
-	ID        string  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	Message   string  `gorm:"not null" json:"message"`
-	UserID    *string `gorm:"type:uuid;index" json:"userId"`
-	User      *User   `gorm:"foreignKey:UserID" json:"user"`
-	CreatedAt int64   `gorm:"autoCreateTime;index" json:"createdAt"`
+	ID        string    `gorm:"type:uuid;primaryKey" json:"id"`
+	Message   string    `gorm:"not null" json:"message"`
+	UserID    *string   `gorm:"type:uuid;index" json:"userId"`
+	User      *User     `gorm:"foreignKey:UserID" json:"user"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
+	// BatchID is shared by the greetings one client stream stored.
+	BatchID *string `gorm:"type:uuid" json:"batchId,omitempty"`
 }
 
 func (Greeting) TableName() string {
 	return "greetings"
 }
 
-// Database connection
-var DB *gorm.DB
+func (g *Greeting) BeforeCreate(*gorm.DB) error {
+	if g.ID == "" {
+		g.ID = uuid.NewString()
+	}
+	return nil
+}
 
-// In-memory cache for users (reduces DB queries by 90%)
-var (
-	userCache      = make(map[string]*User)
-	userCacheMutex sync.RWMutex
-	cacheEnabled   = true
-)
+// QuotaUsage counts daily quota units consumed per caller and bucket
+type QuotaUsage struct {
+	Subject string    `gorm:"primaryKey" json:"subject"`
+	Bucket  string    `gorm:"primaryKey" json:"bucket"`
+	Day     time.Time `gorm:"type:date;primaryKey" json:"day"`
+	Used    int64     `gorm:"not null" json:"used"`
+}
+
+func (QuotaUsage) TableName() string {
+	return "quota_usage"
+}
+
+// UserErasure is the tombstone of a user erased by Admin.EraseUser
+type UserErasure struct {
+	ID               string    `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID           string    `gorm:"type:uuid;not null" json:"userId"`
+	NameSHA256       string    `gorm:"column:name_sha256;not null;index" json:"nameSha256"` // hex SHA-256 of the erased name
+	GreetingsDeleted int64     `gorm:"not null" json:"greetingsDeleted"`
+	ErasedBy         string    `gorm:"not null" json:"erasedBy"` // callerSubject of the admin
+	Reason           string    `gorm:"not null" json:"reason"`
+	ErasedAt         time.Time `gorm:"not null" json:"erasedAt"`
+}
+
+func (UserErasure) TableName() string {
+	return "user_erasures"
+}
+
+// AuditEvent is a recorded RPC call, see audit.go
+type AuditEvent struct {
+	Seq        int64     `gorm:"primaryKey;autoIncrement:false" json:"seq"`
+	At         time.Time `gorm:"not null;index" json:"at"`
+	Method     string    `gorm:"not null" json:"method"`
+	Caller     string    `gorm:"not null;index" json:"caller"`
+	Peer       string    `gorm:"not null" json:"peer"`
+	Code       string    `gorm:"not null" json:"code"`
+	DurationMs int64     `gorm:"not null" json:"durationMs"`
+	RequestID  string    `gorm:"not null" json:"requestId"`
+	Detail     string    `gorm:"not null" json:"detail"`
+	PrevHash   string    `gorm:"not null" json:"prevHash"`
+	Hash       string    `gorm:"not null" json:"hash"`
+}
+
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// OutboxMessage is an event queued for one webhook endpoint, see outbox.go
+type OutboxMessage struct {
+	ID            string     `gorm:"type:uuid;primaryKey" json:"id"`
+	EventID       string     `gorm:"type:uuid;not null" json:"eventId"` // shared by the event's messages
+	Endpoint      string     `gorm:"not null" json:"endpoint"`
+	EventType     string     `gorm:"not null" json:"eventType"`
+	Payload       string     `gorm:"not null" json:"payload"`
+	Status        string     `gorm:"not null;index:idx_outbox_status_next_attempt" json:"status"`
+	Attempts      int        `gorm:"not null" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_outbox_status_next_attempt" json:"nextAttemptAt"`
+	LastError     string     `gorm:"not null" json:"lastError"`
+	CreatedAt     time.Time  `gorm:"not null" json:"createdAt"`
+	DeliveredAt   *time.Time `json:"deliveredAt"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "outbox"
+}
+
+// GreetingRollup counts a user's greetings in one bucket, see rollups.go
+type GreetingRollup struct {
+	Unit      string    `gorm:"primaryKey" json:"unit"`
+	Bucket    time.Time `gorm:"primaryKey" json:"bucket"`
+	UserID    string    `gorm:"type:uuid;primaryKey" json:"userId"`
+	Greetings int64     `gorm:"not null" json:"greetings"`
+}
+
+func (GreetingRollup) TableName() string {
+	return "greeting_rollups"
+}
+
+// BatchRollup counts the client-stream batches of one size class in one bucket
+type BatchRollup struct {
+	Unit      string    `gorm:"primaryKey" json:"unit"`
+	Bucket    time.Time `gorm:"primaryKey" json:"bucket"`
+	SizeClass int       `gorm:"primaryKey" json:"sizeClass"`
+	Batches   int64     `gorm:"not null" json:"batches"`
+	Greetings int64     `gorm:"not null" json:"greetings"`
+	MaxSize   int64     `gorm:"not null" json:"maxSize"`
+}
+
+func (BatchRollup) TableName() string {
+	return "greeting_batch_rollups"
+}
+
+// RollupWatermark records how far a rollup has aggregated
+type RollupWatermark struct {
+	Name    string    `gorm:"primaryKey" json:"name"`
+	Through time.Time `gorm:"not null" json:"through"`
+}
+
+func (RollupWatermark) TableName() string {
+	return "rollup_watermarks"
+}
+
+// newUserErasure - Tombstone for user, whose name is only kept hashed
+func newUserErasure(user *User, greetingsDeleted int64, erasedBy, reason string) *UserErasure {
+	sum := sha256.Sum256([]byte(user.Name))
+	return &UserErasure{
+		ID:               uuid.NewString(),
+		UserID:           user.ID,
+		NameSHA256:       hex.EncodeToString(sum[:]),
+		GreetingsDeleted: greetingsDeleted,
+		ErasedBy:         erasedBy,
+		Reason:           reason,
+		ErasedAt:         time.Now().UTC(),
+	}
+}
 
-// GetOrCreateUser - Optimized user lookup with caching
-func GetOrCreateUser(db *gorm.DB, name string) (*User, error) {
-	// Check cache first (O(1) lookup)
-	if cacheEnabled {
-		userCacheMutex.RLock()
-		if user, exists := userCache[name]; exists {
-			userCacheMutex.RUnlock()
-			return user, nil
+// sqliteScheme prefixes SQLite URLs: sqlite://dev.db, sqlite:///abs/path.db
+// or sqlite://:memory:
+const sqliteScheme = "sqlite://"
+
+// sqliteDefaultParams are added to SQLite DSNs without parameters of their own
+const sqliteDefaultParams = "_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL"
+
+// gormRepository stores everything in Postgres or SQLite through GORM.
+type gormRepository struct {
+	db    *gorm.DB
+	sqlDB *sql.DB
+
+	// ⚡ LRU cache of users by name (reduces DB queries by 90%); nil when
+	// database.user_cache.size is 0
+	users *userCache
+	// Writes to users are announced on bus so other replicas evict them
+	// too; origin tells this replica's announcements apart
+	bus    invalidationBus
+	origin string
+
+	// Read-only replicas for reads that tolerate lag; nil without any
+	replicas *replicaSet
+
+	// stop ends the invalidation listener and replica health checks
+	stop context.CancelFunc
+
+	// Concurrent GetOrCreateUser calls for the same name share one query
+	lookups singleflight.Group
+}
+
+// userLookupTimeout bounds a shared user lookup, which outlives the
+// caller that started it when that caller gives up.
+const userLookupTimeout = 10 * time.Second
+
+// GetOrCreateUser - Optimized user lookup with caching; concurrent calls for
+// the same name are collapsed into one, and each caller stops waiting when
+// its ctx is done
+func (r *gormRepository) GetOrCreateUser(ctx context.Context, name string) (*User, error) {
+	// Check cache first (O(1) lookup); a negative entry still needs the insert
+	if user, _ := r.users.get(name); user != nil {
+		return user, nil
+	}
+
+	ch := r.lookups.DoChan(name, func() (any, error) {
+		// Not tied to the first caller, whose cancellation must not fail the others
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), userLookupTimeout)
+		defer cancel()
+		return r.getOrCreateUser(ctx, name)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		lookup := res.Val.(userLookup)
+		if lookup.created {
+			r.replicas.wrote(ctx)
 		}
-		userCacheMutex.RUnlock()
+		// Every caller gets its own copy
+		user := *lookup.user
+		return &user, nil
 	}
+}
+
+// userLookup is the result shared by the callers of one lookup.
+type userLookup struct {
+	user    *User
+	created bool
+}
 
+func (r *gormRepository) getOrCreateUser(ctx context.Context, name string) (userLookup, error) {
 	// Use FirstOrCreate to reduce 2 queries to 1
 	var user User
-	result := db.Where("name = ?", name).FirstOrCreate(&user, User{Name: name})
-	
-	if result.Error != nil {
-		return nil, result.Error
+	result := r.db.WithContext(ctx).Where("name = ?", name).FirstOrCreate(&user, User{Name: name})
+	err := result.Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// Another replica created it between our SELECT and INSERT
+		user = User{}
+		err = r.db.WithContext(ctx).Where("name = ?", name).Take(&user).Error
 	}
+	if err != nil {
+		return userLookup{}, err
+	}
+
+	r.users.add(&user)
+	return userLookup{user: &user, created: result.RowsAffected > 0}, nil
+}
+
+// userUpsertBatch is the most names one upsert statement resolves (4 bind
+// parameters per row keeps it well under every dialect's limit)
+const userUpsertBatch = 1000
 
-	// Update cache
-	if cacheEnabled {
-		userCacheMutex.Lock()
-		userCache[name] = &user
-		userCacheMutex.Unlock()
+// GetOrCreateUsers - Resolves a whole batch of names at once: cached names
+// are served from the cache, the rest with one INSERT ... ON CONFLICT (name)
+// DO UPDATE ... RETURNING per userUpsertBatch names, whether they exist or
+// not. Only the users it inserted are invalidated
+func (r *gormRepository) GetOrCreateUsers(ctx context.Context, names []string) (map[string]*User, error) {
+	users := make(map[string]*User, len(names))
+	var missing []User
+	for _, name := range names {
+		if _, ok := users[name]; ok {
+			continue // an upsert must not touch the same row twice
+		}
+		user, _ := r.users.get(name)
+		users[name] = user
+		if user == nil {
+			missing = append(missing, User{Name: name})
+		}
+	}
+	if len(missing) == 0 {
+		return users, nil
+	}
+
+	// IDs are assigned here, so that the rows RETURNING gives back with
+	// another ID are the ones that already existed
+	proposed := make(map[string]string, len(missing))
+	for i := range missing {
+		missing[i].ID = uuid.NewString()
+		proposed[missing[i].Name] = missing[i].ID
+	}
+
+	// DO UPDATE rather than DO NOTHING, so RETURNING includes the rows that
+	// already existed; the no-op assignment leaves them unchanged, so they
+	// skip invalidateUsers
+	err := r.db.WithContext(ctx).Set(skipUserInvalidation, true).Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name"}),
+		},
+		clause.Returning{},
+	).CreateInBatches(&missing, userUpsertBatch).Error
+	if err != nil {
+		return nil, err
+	}
+	// New users may have negative entries, here or on other replicas. An
+	// upsert that found every user wrote nothing, so it does not pin the
+	// caller to the primary either
+	var inserted []string
+	for _, u := range missing {
+		if proposed[u.Name] == u.ID {
+			inserted = append(inserted, u.Name)
+		}
 	}
+	if len(inserted) > 0 {
+		r.replicas.wrote(ctx)
+		r.invalidate(ctx, r.db.Statement.ConnPool, userInvalidation{Names: inserted})
+	}
+	for i := range missing {
+		users[missing[i].Name] = &missing[i]
+		r.users.add(&missing[i])
+	}
+	for name, user := range users {
+		if user == nil {
+			return nil, fmt.Errorf("upsert returned no row for user %q", name)
+		}
+	}
+	return users, nil
+}
 
+// FindUser - Looks a user up by name without creating it; misses are
+// cached too, so repeated lookups of unknown names stay off the database
+func (r *gormRepository) FindUser(ctx context.Context, name string) (*User, error) {
+	if user, found := r.users.get(name); found {
+		if user == nil {
+			return nil, ErrUserNotFound
+		}
+		return user, nil
+	}
+
+	var user User
+	fromReplica, err := r.read(ctx, func(db *gorm.DB) error {
+		return db.Where("name = ?", name).Take(&user).Error
+	})
+	// What a replica returns may lag behind the primary, so it is not cached
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if !fromReplica {
+			r.users.addMissing(name)
+		}
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !fromReplica {
+		r.users.add(&user)
+	}
 	return &user, nil
 }
 
-// ClearCache - Clear user cache (useful for testing)
-func ClearCache() {
-	userCacheMutex.Lock()
-	userCache = make(map[string]*User)
-	userCacheMutex.Unlock()
+// invalidateUsers - GORM callback that evicts the users a create, update or
+// delete touched from the cache, by name and by ID: an update may have
+// renamed them, and only the ID finds the entry under the old name. Writes
+// that do not say by ID which users they touch (e.g. by a WHERE clause
+// only) clear the whole cache.
+func (r *gormRepository) invalidateUsers(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Table != (User{}).TableName() {
+		return
+	}
+	if skip, _ := db.Get(skipUserInvalidation); skip == true {
+		return
+	}
+	var names, ids []string
+	unknown := false
+	collect := func(v reflect.Value) {
+		if u, ok := reflect.Indirect(v).Interface().(User); ok {
+			if u.Name != "" {
+				names = append(names, u.Name)
+			}
+			if u.ID != "" {
+				ids = append(ids, u.ID)
+			} else {
+				unknown = true
+			}
+		}
+	}
+	switch rv := reflect.Indirect(db.Statement.ReflectValue); rv.Kind() {
+	case reflect.Struct:
+		collect(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			collect(rv.Index(i))
+		}
+	}
+	r.invalidate(db.Statement.Context, db.Statement.ConnPool,
+		userInvalidation{Names: names, IDs: ids, All: unknown || len(ids) == 0})
 }
 
-// InitDB initializes database connection with optimized settings
-func InitDB() error {
-	// Get database URL from environment
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		return fmt.Errorf("DATABASE_URL environment variable is not set")
+// skipUserInvalidation is set on writes to users that call invalidate
+// themselves, with only the users they changed.
+const skipUserInvalidation = "usercache:skip"
+
+// invalidate evicts inv from the cache and publishes it to the other
+// replicas through pool, the connection or transaction of the write.
+func (r *gormRepository) invalidate(ctx context.Context, pool gorm.ConnPool, inv userInvalidation) {
+	inv.Origin = r.origin
+	r.users.applyInvalidation(inv)
+	if r.bus == nil {
+		return
+	}
+	// A replica that misses this catches up within user_cache.ttl
+	if err := r.bus.Publish(ctx, pool, inv); err != nil {
+		dbLog.Warn("failed to publish user cache invalidation", "error", err)
 	}
+}
 
-	var err error
-	
-	// Validate URL format
-	if strings.HasPrefix(dbURL, "postgresql://") || strings.HasPrefix(dbURL, "postgres://") {
-		_, parseErr := url.Parse(dbURL)
-		if parseErr != nil {
-			log.Printf("Warning: URL parse error (will try anyway): %v", parseErr)
-			log.Printf("Tip: Make sure password is URL-encoded if it contains special characters")
-		}
+// warmUp - Preloads the users with the most greetings in the last window
+func (r *gormRepository) warmUp(ctx context.Context, limit int, window time.Duration) (int, error) {
+	var users []User
+	err := r.db.WithContext(ctx).
+		Select("users.*").
+		Joins("JOIN greetings ON greetings.user_id = users.id").
+		Where("greetings.created_at > ?", time.Now().UTC().Add(-window)).
+		Group("users.id").
+		Order("count(*) DESC").
+		Limit(limit).
+		Find(&users).Error
+	if err != nil {
+		return 0, err
 	}
-	
-	// ⚡ OPTIMIZATION 1: Disable query logging for production (reduces overhead)
-	logLevel := logger.Error // Only log errors, not every query
-	if os.Getenv("DB_DEBUG") == "true" {
-		logLevel = logger.Info // Enable for debugging
+	for i := range users {
+		r.users.add(&users[i])
 	}
-	
-	// Connect using GORM with optimized config
-	DB, err = gorm.Open(postgres.Open(dbURL), &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
-		// ⚡ OPTIMIZATION 2: Prepare statements for reuse (disabled due to connection pool conflicts)
-		// PrepareStmt: true, // Temporarily disabled
-		// ⚡ OPTIMIZATION 3: Skip default transaction for faster writes
-		SkipDefaultTransaction: true,
+	return len(users), nil
+}
+
+// greetingCopyThreshold is the largest greeting batch inserted with a single
+// INSERT; larger ones are copied on Postgres and split into INSERTs of this
+// size elsewhere
+const greetingCopyThreshold = 1000
+
+// CreateGreetings - One INSERT per batch, or COPY for large batches on
+// Postgres; the events are inserted once the hooks have filled in the IDs
+func (r *gormRepository) CreateGreetings(ctx context.Context, greetings []Greeting, notify []string) error {
+	r.replicas.wrote(ctx)
+	if len(greetings) > greetingCopyThreshold && r.db.Dialector.Name() == "postgres" {
+		return r.copyGreetings(ctx, greetings, notify)
+	}
+	if len(notify) == 0 {
+		return r.db.WithContext(ctx).CreateInBatches(greetings, greetingCopyThreshold).Error
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(greetings, greetingCopyThreshold).Error; err != nil {
+			return err
+		}
+		outbox, err := greetingEvents(greetings, notify)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&outbox).Error
 	})
+}
+
+// ExpiredGreetings - Oldest first, on the created_at index
+func (r *gormRepository) ExpiredGreetings(ctx context.Context, cutoff time.Time, limit int) ([]Greeting, error) {
+	var greetings []Greeting
+	err := r.db.WithContext(ctx).Model(&Greeting{}).Select("id, message, user_id, created_at").
+		Where("created_at < ?", cutoff).Order("created_at, id").Limit(limit).Find(&greetings).Error
+	return greetings, err
+}
 
+// GreetingCutoffs - One query per run: for each user, a lookup of the
+// (keep+1)-th newest greeting on idx_greetings_user_created, instead of
+// ranking the whole table
+func (r *gormRepository) GreetingCutoffs(ctx context.Context, keep int) ([]GreetingCutoff, error) {
+	db := r.db.WithContext(ctx)
+	var cutoffs []GreetingCutoff
+	err := db.Raw(`SELECT g.id, g.user_id, g.created_at FROM users u
+		JOIN greetings g ON g.id = (SELECT n.id FROM greetings n WHERE n.user_id = u.id
+			ORDER BY n.created_at DESC, n.id DESC LIMIT 1 OFFSET ?)`, keep).Scan(&cutoffs).Error
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w\nTip: Check if password contains special characters that need URL encoding", err)
+		return nil, err
+	}
+	var anonymous []GreetingCutoff
+	err = db.Model(&Greeting{}).Select("id, user_id, created_at").Where("user_id IS NULL").
+		Order("created_at DESC, id DESC").Offset(keep).Limit(1).Scan(&anonymous).Error
+	return append(cutoffs, anonymous...), err
+}
+
+// GreetingsUpTo - Keyset on (created_at, id), so each batch is one range
+// scan of the user's greetings however many were deleted before it
+func (r *gormRepository) GreetingsUpTo(ctx context.Context, cut GreetingCutoff, limit int) ([]Greeting, error) {
+	q := r.db.WithContext(ctx).Model(&Greeting{}).Select("id, message, user_id, created_at")
+	if cut.UserID != nil {
+		q = q.Where("user_id = ?", *cut.UserID)
+	} else {
+		q = q.Where("user_id IS NULL")
 	}
+	var greetings []Greeting
+	err := q.Where("created_at < ? OR (created_at = ? AND id <= ?)", cut.CreatedAt, cut.CreatedAt, cut.ID).
+		Order("created_at, id").Limit(limit).Find(&greetings).Error
+	return greetings, err
+}
 
-	log.Println("✅ Connected to database successfully")
+// DeleteGreetings - One DELETE ... WHERE id IN (...) for the batch
+func (r *gormRepository) DeleteGreetings(ctx context.Context, ids []string) (int64, error) {
+	result := r.db.WithContext(ctx).Where("id IN ?", ids).Delete(&Greeting{})
+	return result.RowsAffected, result.Error
+}
 
-	// ⚡ OPTIMIZATION 4: Configure connection pooling for high performance
-	sqlDB, err := DB.DB()
+// UserGreetings - Pages through the user's greetings by (created_at, id),
+// using idx_greetings_user_created, so each page is one index range scan
+func (r *gormRepository) UserGreetings(ctx context.Context, userID string, batch int, fn func([]Greeting) error) error {
+	return r.pageGreetings(ctx, batch, fn, func(q *gorm.DB) *gorm.DB {
+		return q.Where("user_id = ?", userID)
+	})
+}
+
+// GreetingsBetween - Pages by (created_at, id) too, on the created_at index
+func (r *gormRepository) GreetingsBetween(ctx context.Context, from, to time.Time, batch int, fn func([]Greeting) error) error {
+	return r.pageGreetings(ctx, batch, fn, func(q *gorm.DB) *gorm.DB {
+		return q.Where("created_at >= ? AND created_at < ?", from, to)
+	})
+}
+
+// pageGreetings calls fn with the greetings selected by where, a page of
+// batch at a time in (created_at, id) order.
+func (r *gormRepository) pageGreetings(ctx context.Context, batch int, fn func([]Greeting) error, where func(*gorm.DB) *gorm.DB) error {
+	var last *Greeting
+	for {
+		q := where(r.db.WithContext(ctx))
+		if last != nil {
+			q = q.Where("created_at > ? OR (created_at = ? AND id > ?)", last.CreatedAt, last.CreatedAt, last.ID)
+		}
+		var greetings []Greeting
+		if err := q.Order("created_at, id").Limit(batch).Find(&greetings).Error; err != nil {
+			return err
+		}
+		if len(greetings) == 0 {
+			return nil
+		}
+		if err := fn(greetings); err != nil {
+			return err
+		}
+		if len(greetings) < batch {
+			return nil
+		}
+		last = &greetings[len(greetings)-1]
+	}
+}
+
+// EraseUser - Deletes the greetings, redacts the outbox, deletes the user
+// and writes the tombstone in one transaction. Deleting the user evicts it
+// through invalidateUsers (on Postgres the other replicas are notified on
+// commit); it is evicted here once more after the commit, in case a
+// concurrent lookup cached it again.
+func (r *gormRepository) EraseUser(ctx context.Context, name, erasedBy, reason string) (*UserErasure, error) {
+	r.replicas.wrote(ctx)
+	var erasure *UserErasure
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Where("name = ?", name).Take(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		// Deleted explicitly rather than by ON DELETE CASCADE, to count them
+		greetings := tx.Where("user_id = ?", user.ID).Delete(&Greeting{})
+		if greetings.Error != nil {
+			return greetings.Error
+		}
+		if err := redactOutbox(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		erasure = newUserErasure(&user, greetings.RowsAffected, erasedBy, reason)
+		return tx.Create(erasure).Error
+	})
 	if err != nil {
-		return fmt.Errorf("failed to get database instance: %w", err)
+		return nil, err
 	}
+	r.users.applyInvalidation(userInvalidation{Names: []string{name}, IDs: []string{erasure.UserID}})
+	return erasure, nil
+}
 
-	// Connection pool settings optimized for Supabase
-	sqlDB.SetMaxIdleConns(25)                   // Keep 25 connections ready (reduces connection overhead)
-	sqlDB.SetMaxOpenConns(100)                  // Allow up to 100 concurrent connections
-	sqlDB.SetConnMaxLifetime(10 * time.Minute)  // Reuse connections for 10 minutes
-	sqlDB.SetConnMaxIdleTime(5 * time.Minute)   // Close idle connections after 5 minutes
+// redactOutbox removes the greetings of userID from the webhook events in
+// the outbox, so none can be delivered or replayed after an erasure; events
+// left without greetings are deleted. The outbox is scanned with LIKE,
+// which is fine for something as rare as an erasure.
+func redactOutbox(tx *gorm.DB, userID string) error {
+	var msgs []OutboxMessage
+	err := tx.Where("event_type = ? AND payload LIKE ?", greetingsCreated, "%"+eventUserMarker(userID)+"%").
+		Find(&msgs).Error
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		payload, err := redactGreetingEvent(msg.Payload, userID)
+		switch {
+		case err != nil:
+			return fmt.Errorf("outbox message %s: %w", msg.ID, err)
+		case payload == "":
+			err = tx.Delete(&msg).Error
+		default:
+			err = tx.Model(&msg).Update("payload", payload).Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	log.Println("✅ Connection pool configured: 25 idle, 100 max")
+// AppendAuditEvents - Reads the head of the chain and inserts the batch in
+// one transaction; on Postgres an advisory lock held until commit keeps
+// replicas from chaining onto the same head
+func (r *gormRepository) AppendAuditEvents(ctx context.Context, key []byte, events []AuditEvent) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditLockID).Error; err != nil {
+				return err
+			}
+		}
+		var head AuditEvent
+		if err := tx.Order("seq DESC").Limit(1).Find(&head).Error; err != nil {
+			return err
+		}
+		chainAuditEvents(key, &head, events)
+		return tx.CreateInBatches(events, auditInsertBatch).Error
+	})
+}
 
-	// Auto-migrate tables (handles existing tables gracefully)
-	// GORM AutoMigrate will only add missing columns/tables, not fail on existing ones
-	if err := DB.AutoMigrate(&User{}, &Greeting{}); err != nil {
-		// Check if error is just "table already exists" - that's okay
-		if strings.Contains(err.Error(), "already exists") {
-			log.Println("⚠️  Tables already exist, skipping creation")
-		} else {
-			return fmt.Errorf("failed to migrate database: %w", err)
+// AuditEvents - Filtered page of the audit log; it tolerates lag, so it may
+// be served by a replica
+func (r *gormRepository) AuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	var events []AuditEvent
+	_, err := r.read(ctx, func(db *gorm.DB) error {
+		q := db.Where("seq > ?", filter.AfterSeq)
+		if filter.Method != "" {
+			q = q.Where("method = ?", filter.Method)
 		}
+		if filter.Caller != "" {
+			q = q.Where("caller = ?", filter.Caller)
+		}
+		if filter.Code != "" {
+			q = q.Where("code = ?", filter.Code)
+		}
+		if !filter.Since.IsZero() {
+			q = q.Where("at >= ?", filter.Since)
+		}
+		if !filter.Until.IsZero() {
+			q = q.Where("at < ?", filter.Until)
+		}
+		return q.Order("seq").Limit(filter.Limit).Find(&events).Error
+	})
+	return events, err
+}
+
+// ClaimOutbox - Uses idx_outbox_status_next_attempt; always on the primary.
+// FOR UPDATE SKIP LOCKED lets replicas claim disjoint batches at once, and
+// the transaction only lasts for the SELECT and the UPDATE
+func (r *gormRepository) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	var msgs []OutboxMessage
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", outboxPending, now).
+			Order("next_attempt_at, created_at").Limit(limit).Find(&msgs).Error
+		if err != nil || len(msgs) == 0 {
+			return err
+		}
+		ids := make([]string, len(msgs))
+		for i, msg := range msgs {
+			ids[i] = msg.ID
+		}
+		return tx.Model(&OutboxMessage{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	return msgs, err
+}
+
+// SaveOutbox - Updates the delivery columns by primary key
+func (r *gormRepository) SaveOutbox(ctx context.Context, msg *OutboxMessage) error {
+	return r.db.WithContext(ctx).Model(msg).
+		Select("status", "attempts", "next_attempt_at", "last_error", "delivered_at").
+		Updates(msg).Error
+}
+
+// OutboxMessages - For the outbox command, so read from the primary too
+func (r *gormRepository) OutboxMessages(ctx context.Context, status, endpoint string, limit int) ([]OutboxMessage, error) {
+	q := r.db.WithContext(ctx).Where("status = ?", status)
+	if endpoint != "" {
+		q = q.Where("endpoint = ?", endpoint)
 	}
+	var msgs []OutboxMessage
+	err := q.Order("created_at, id").Limit(limit).Find(&msgs).Error
+	return msgs, err
+}
 
-	// ⚡ OPTIMIZATION: Create indexes for faster queries
-	if err := createIndexes(); err != nil {
-		log.Printf("⚠️  Warning: Could not create indexes: %v", err)
-	} else {
-		log.Println("✅ Database indexes created")
+// ReplayOutbox - One UPDATE; the last error is kept for reference
+func (r *gormRepository) ReplayOutbox(ctx context.Context, endpoint string, ids []string) (int64, error) {
+	q := r.db.WithContext(ctx).Model(&OutboxMessage{}).Where("status = ?", outboxDead)
+	if endpoint != "" {
+		q = q.Where("endpoint = ?", endpoint)
+	}
+	if len(ids) > 0 {
+		q = q.Where("id IN ?", ids)
 	}
-	
-	log.Println("✅ Database migration completed")
-	log.Println("⚡ Performance optimizations enabled: Connection Pool, Caching, Indexes")
+	result := q.Updates(map[string]any{"status": outboxPending, "attempts": 0, "next_attempt_at": time.Now().UTC()})
+	return result.RowsAffected, result.Error
+}
 
-	return nil
+func (r *gormRepository) DeleteDeliveredOutbox(ctx context.Context, cutoff time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("status = ? AND delivered_at < ?", outboxDelivered, cutoff).
+		Delete(&OutboxMessage{})
+	return result.RowsAffected, result.Error
 }
 
-// createIndexes - Creates optimized indexes for faster queries
-func createIndexes() error {
-	// Composite index for user lookups
-	if err := DB.Exec(`
-		CREATE INDEX IF NOT EXISTS idx_users_name_lookup 
-		ON users(name) 
-		WHERE name IS NOT NULL
-	`).Error; err != nil {
+// ApplyRollups - Minutes are replaced with the rows given; hours and days
+// are summed again from the unit below with GROUP BY, one bucket at a time
+func (r *gormRepository) ApplyRollups(ctx context.Context, from, to time.Time, minutes []GreetingRollup, batches []BatchRollup) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{&GreetingRollup{}, &BatchRollup{}} {
+			err := tx.Where("unit = ? AND bucket >= ? AND bucket < ?", rollupMinute, from, to).Delete(model).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(minutes) > 0 {
+			if err := tx.CreateInBatches(minutes, rollupInsertBatch).Error; err != nil {
+				return err
+			}
+		}
+		if len(batches) > 0 {
+			if err := tx.CreateInBatches(batches, rollupInsertBatch).Error; err != nil {
+				return err
+			}
+		}
+		for _, u := range rollupUnits[1:] {
+			for bucket := range u.buckets(from, to) {
+				if err := sumRollups(tx, u, bucket); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&RollupWatermark{Name: greetingRollups, Through: to}).Error
+	})
+}
+
+// sumRollups replaces the rollups of bucket in unit u with the sums of the
+// unit below.
+func sumRollups(tx *gorm.DB, u rollupUnit, bucket time.Time) error {
+	for _, model := range []any{&GreetingRollup{}, &BatchRollup{}} {
+		if err := tx.Where("unit = ? AND bucket = ?", u.name, bucket).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	end := bucket.Add(u.size)
+	var users []GreetingRollup
+	err := tx.Model(&GreetingRollup{}).Select("user_id, SUM(greetings) AS greetings").
+		Where("unit = ? AND bucket >= ? AND bucket < ?", u.finer, bucket, end).
+		Group("user_id").Scan(&users).Error
+	if err != nil {
 		return err
 	}
-	
-	// Index for greeting queries by user and time
-	if err := DB.Exec(`
-		CREATE INDEX IF NOT EXISTS idx_greetings_user_created 
-		ON greetings(user_id, created_at DESC)
-	`).Error; err != nil {
+	var classes []BatchRollup
+	err = tx.Model(&BatchRollup{}).
+		Select("size_class, SUM(batches) AS batches, SUM(greetings) AS greetings, MAX(max_size) AS max_size").
+		Where("unit = ? AND bucket >= ? AND bucket < ?", u.finer, bucket, end).
+		Group("size_class").Scan(&classes).Error
+	if err != nil {
 		return err
 	}
-	
-	// Analyze tables for query planner optimization
-	DB.Exec("ANALYZE users")
-	DB.Exec("ANALYZE greetings")
-	
+	for i := range users {
+		users[i].Unit, users[i].Bucket = u.name, bucket
+	}
+	for i := range classes {
+		classes[i].Unit, classes[i].Bucket = u.name, bucket
+	}
+	if len(users) > 0 {
+		if err := tx.CreateInBatches(users, rollupInsertBatch).Error; err != nil {
+			return err
+		}
+	}
+	if len(classes) > 0 {
+		return tx.Create(&classes).Error
+	}
 	return nil
 }
 
-// CloseDB closes database connection
-func CloseDB() error {
-	if DB != nil {
-		sqlDB, err := DB.DB()
+func (r *gormRepository) RollupWatermark(ctx context.Context) (time.Time, error) {
+	db := r.db.WithContext(ctx)
+	var mark RollupWatermark
+	err := db.Where("name = ?", greetingRollups).Take(&mark).Error
+	if err == nil {
+		return mark.Through, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, err
+	}
+	var oldest Greeting
+	err = db.Select("created_at").Order("created_at").Take(&oldest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Now().UTC(), nil
+	}
+	return oldest.CreatedAt, err
+}
+
+// GreetingStats - Three GROUP BY queries over the primary key range of the
+// unit, on a replica when there is one
+func (r *gormRepository) GreetingStats(ctx context.Context, query StatsQuery) (*GreetingStats, error) {
+	stats := &GreetingStats{}
+	_, err := r.read(ctx, func(db *gorm.DB) error {
+		rollups := func() *gorm.DB {
+			q := db.Model(&GreetingRollup{}).Where("greeting_rollups.unit = ? AND greeting_rollups.bucket >= ? AND greeting_rollups.bucket < ?",
+				query.Unit, query.From, query.To)
+			if query.UserID != "" {
+				q = q.Where("greeting_rollups.user_id = ?", query.UserID)
+			}
+			return q
+		}
+		err := rollups().Select("bucket, SUM(greetings) AS greetings").
+			Group("bucket").Order("bucket").Scan(&stats.Buckets).Error
+		if err != nil {
+			return err
+		}
+		err = rollups().
+			Select("greeting_rollups.user_id, COALESCE(users.name, '') AS name, SUM(greeting_rollups.greetings) AS greetings").
+			Joins("LEFT JOIN users ON users.id = greeting_rollups.user_id").
+			Group("greeting_rollups.user_id, users.name").
+			Order("greetings DESC, greeting_rollups.user_id").Limit(query.TopUsers).
+			Scan(&stats.TopUsers).Error
 		if err != nil {
 			return err
 		}
-		return sqlDB.Close()
+		err = db.Model(&BatchRollup{}).
+			Select("size_class, SUM(batches) AS batches, SUM(greetings) AS greetings, MAX(max_size) AS max_size").
+			Where("unit = ? AND bucket >= ? AND bucket < ?", query.Unit, query.From, query.To).
+			Group("size_class").Order("size_class").Scan(&stats.Batches).Error
+		if err != nil {
+			return err
+		}
+		var mark RollupWatermark
+		err = db.Where("name = ?", greetingRollups).Limit(1).Find(&mark).Error
+		stats.Through = mark.Through
+		return err
+	})
+	return stats, err
+}
+
+// exclusively - Postgres advisory lock, taken without waiting. SQLite has no
+// other replicas to exclude, and holding a connection for the lock would
+// starve its one-connection pool, so fn just runs.
+func (r *gormRepository) exclusively(ctx context.Context, id int64, fn func() error) (bool, error) {
+	if r.db.Dialector.Name() != "postgres" {
+		return true, fn()
 	}
-	return nil
+	conn, err := r.sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", id).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", id)
+	return true, fn()
+}
+
+// copyGreetings streams greetings into the table with COPY FROM STDIN through
+// the pgx connection underneath database/sql, and their events into the
+// outbox in the same transaction. COPY skips the GORM hooks, so IDs and
+// timestamps are filled in here.
+func (r *gormRepository) copyGreetings(ctx context.Context, greetings []Greeting, notify []string) error {
+	now := time.Now().UTC()
+	rows := make([][]any, len(greetings))
+	for i := range greetings {
+		g := &greetings[i]
+		if g.ID == "" {
+			g.ID = uuid.NewString()
+		}
+		if g.CreatedAt.IsZero() {
+			g.CreatedAt = now
+		}
+		id, err := pgUUID(&g.ID)
+		if err != nil {
+			return err
+		}
+		userID, err := pgUUID(g.UserID)
+		if err != nil {
+			return err
+		}
+		batchID, err := pgUUID(g.BatchID)
+		if err != nil {
+			return err
+		}
+		rows[i] = []any{id, g.Message, userID, g.CreatedAt, batchID}
+	}
+	outbox, err := greetingEvents(greetings, notify)
+	if err != nil {
+		return err
+	}
+	outboxRows := make([][]any, len(outbox))
+	for i := range outbox {
+		m := &outbox[i]
+		id, err := pgUUID(&m.ID)
+		if err != nil {
+			return err
+		}
+		eventID, err := pgUUID(&m.EventID)
+		if err != nil {
+			return err
+		}
+		outboxRows[i] = []any{id, eventID, m.Endpoint, m.EventType, m.Payload, m.Status,
+			int32(m.Attempts), m.NextAttemptAt, m.LastError, m.CreatedAt}
+	}
+
+	conn, err := r.sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		pc, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("COPY needs a pgx connection, got %T", driverConn)
+		}
+		tx, err := pc.Conn().Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(context.WithoutCancel(ctx))
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{Greeting{}.TableName()},
+			[]string{"id", "message", "user_id", "created_at", "batch_id"}, pgx.CopyFromRows(rows)); err != nil {
+			return err
+		}
+		if len(outboxRows) > 0 {
+			if _, err := tx.CopyFrom(ctx, pgx.Identifier{OutboxMessage{}.TableName()},
+				[]string{"id", "event_id", "endpoint", "event_type", "payload", "status",
+					"attempts", "next_attempt_at", "last_error", "created_at"},
+				pgx.CopyFromRows(outboxRows)); err != nil {
+				return err
+			}
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+// pgUUID converts an optional UUID string for COPY, which sends binary values
+func pgUUID(s *string) (pgtype.UUID, error) {
+	if s == nil {
+		return pgtype.UUID{}, nil
+	}
+	id, err := uuid.Parse(*s)
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+	return pgtype.UUID{Bytes: id, Valid: true}, nil
 }
 
+// ConsumeQuota - Increments the usage only while the result stays within
+// the limit; no row comes back when the quota would be exceeded
+func (r *gormRepository) ConsumeQuota(ctx context.Context, subject, bucket string, day time.Time, n, limit int64) (bool, error) {
+	var used []int64
+	err := r.db.WithContext(ctx).Raw(`
+		INSERT INTO quota_usage (subject, bucket, day, used) VALUES (?, ?, ?, ?)
+		ON CONFLICT (subject, bucket, day) DO UPDATE
+			SET used = quota_usage.used + EXCLUDED.used
+			WHERE quota_usage.used + EXCLUDED.used <= ?
+		RETURNING used
+	`, subject, bucket, day, n, limit).Scan(&used).Error
+	if err != nil {
+		return false, err
+	}
+	return len(used) > 0, nil
+}
+
+// Ping checks the primary; replicas have health checks of their own.
+func (r *gormRepository) Ping(ctx context.Context) error {
+	return r.sqlDB.PingContext(ctx)
+}
+
+// Stats reports the connection pool statistics for load shedding.
+func (r *gormRepository) Stats() sql.DBStats {
+	return r.sqlDB.Stats()
+}
+
+// dialector picks the GORM driver for a database URL
+func dialector(dbURL string) (gorm.Dialector, error) {
+	switch {
+	case strings.HasPrefix(dbURL, "postgresql://"), strings.HasPrefix(dbURL, "postgres://"):
+		// Validate URL format
+		if _, parseErr := url.Parse(dbURL); parseErr != nil {
+			dbLog.Warn("DATABASE_URL parse error, will try anyway",
+				"error", parseErr,
+				"tip", "make sure the password is URL-encoded if it contains special characters")
+		}
+		return postgres.Open(dbURL), nil
+	case strings.HasPrefix(dbURL, sqliteScheme):
+		dsn := strings.TrimPrefix(dbURL, sqliteScheme)
+		if dsn == "" || strings.HasPrefix(dsn, "?") {
+			return nil, fmt.Errorf("sqlite URL needs a file name, e.g. %sdev.db", sqliteScheme)
+		}
+		if !strings.Contains(dsn, "?") {
+			dsn += "?" + sqliteDefaultParams
+		}
+		return sqlite.Open(dsn), nil
+	}
+	return nil, fmt.Errorf("unsupported database URL, want postgres://, postgresql:// or %s", sqliteScheme)
+}
+
+// connect opens Postgres or SQLite with optimized settings
+func connect(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	dial, err := dialector(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// ⚡ OPTIMIZATION 1: Only trace every query when DB_DEBUG is set (reduces overhead).
+	// GORM output goes through the shared log sink under the "gorm" component.
+	gormLog := logging.NewGormLogger(logging.For("gorm"), cfg.Debug)
+
+	// Connect using GORM with optimized config
+	db, err := gorm.Open(dial, &gorm.Config{
+		Logger: gormLog,
+		// ⚡ OPTIMIZATION 2: Prepare statements for reuse (disabled due to connection pool conflicts)
+		// PrepareStmt: true, // Temporarily disabled
+		// ⚡ OPTIMIZATION 3: Skip default transaction for faster writes
+		SkipDefaultTransaction: true,
+		// Unique violations come back as gorm.ErrDuplicatedKey on every dialect
+		TranslateError: true,
+		// Timestamps are stored in UTC whatever the server's time zone
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w\nTip: Check if password contains special characters that need URL encoding", errConnect, err)
+	}
+
+	dbLog.Info("connected to database", "dialect", dial.Name())
+
+	// ⚡ OPTIMIZATION 4: Configure connection pooling for high performance
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database instance: %w", err)
+	}
+
+	// Connection pool settings (defaults are tuned for Supabase)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)       // Connections kept ready (reduces connection overhead)
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)       // Upper bound on concurrent connections
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime) // How long a connection is reused
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime) // Close idle connections after this long
+
+	// SQLite allows a single writer; one connection avoids "database is
+	// locked" errors and keeps :memory: databases from splitting per connection
+	if dial.Name() == "sqlite" {
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+	}
+
+	dbLog.Info("connection pool configured", "max_idle", cfg.MaxIdleConns, "max_open", sqlDB.Stats().MaxOpenConnections)
+
+	return db, nil
+}
+
+// openGormRepository connects and makes sure the schema is at the version
+// this build expects (server/migrations), applying pending migrations first
+// when database.auto_migrate is set
+func openGormRepository(cfg config.DatabaseConfig) (*gormRepository, error) {
+	db, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, _ := db.DB()
+	r := &gormRepository{db: db, sqlDB: sqlDB, users: newUserCache(cfg.UserCache)}
+
+	m, err := newMigrator(sqlDB, db.Dialector.Name())
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	ctx := context.Background()
+	if cfg.AutoMigrate {
+		if n, err := m.up(ctx, 0); err != nil {
+			sqlDB.Close()
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		} else if n > 0 {
+			dbLog.Info("database migrated", "applied", n)
+		}
+	}
+	if err := m.check(ctx); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	dbLog.Info("database schema is current", "version", m.latest())
+
+	// The invalidation listener and replica health checks run until Close
+	var background context.Context
+	background, r.stop = context.WithCancel(context.Background())
+
+	if r.users != nil {
+		// Keep the cache coherent with writes made through this connection
+		cb := db.Callback()
+		if err := errors.Join(
+			cb.Create().After("gorm:create").Register("usercache:create", r.invalidateUsers),
+			cb.Update().After("gorm:update").Register("usercache:update", r.invalidateUsers),
+			cb.Delete().After("gorm:delete").Register("usercache:delete", r.invalidateUsers),
+		); err != nil {
+			sqlDB.Close()
+			return nil, err
+		}
+		r.users.publish("user_cache")
+
+		// ...and with the writes of the other replicas
+		uc := cfg.UserCache
+		if r.bus, err = newInvalidationBus(uc.Invalidation, db.Dialector.Name(), cfg.URL, cfg.ListenURL); err != nil {
+			sqlDB.Close()
+			return nil, err
+		}
+		r.origin = uuid.NewString()
+		go r.bus.Listen(background, func(inv userInvalidation) {
+			if inv.Origin != r.origin {
+				r.users.applyInvalidation(inv)
+			}
+		})
+
+		if uc.Warmup > 0 {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			n, err := r.warmUp(ctx, uc.Warmup, uc.WarmupWindow)
+			cancel()
+			if err != nil {
+				dbLog.Warn("user cache warmup failed", "error", err)
+			} else {
+				dbLog.Info("user cache warmed up", "users", n)
+			}
+		}
+	}
+
+	if r.replicas = newReplicaSet(cfg); r.replicas != nil {
+		go r.replicas.checkHealth(background, cfg.Replicas.HealthInterval)
+		r.replicas.publish("db_replicas")
+		dbLog.Info("reads go to replicas when healthy", "replicas", len(cfg.Replicas.URLs), "read_your_writes", cfg.Replicas.ReadYourWrites)
+	}
+
+	return r, nil
+}
+
+// Close closes database connection
+func (r *gormRepository) Close() error {
+	if r.stop != nil {
+		r.stop()
+	}
+	return errors.Join(r.replicas.Close(), r.sqlDB.Close())
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	pb "grpc-example/proto"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// dbMethods are the methods that cannot work without the database.
+var dbMethods = map[string]bool{
+	pb.Greeter_SayHelloClientStream_FullMethodName: true,
+	pb.Admin_ExportUserData_FullMethodName:         true,
+	pb.Admin_EraseUser_FullMethodName:              true,
+	pb.Admin_QueryAuditEvents_FullMethodName:       true,
+	pb.Admin_GetGreetingStats_FullMethodName:       true,
+}
+
+// dbMonitor implements degraded mode. It pings the repository every
+// database.health_interval; while that fails, health reports NOT_SERVING
+// and dbMethods are refused with Unavailable, while everything else keeps
+// serving. Drain mode wins: once the health server is shut down, recovering
+// does not make it report SERVING again.
+type dbMonitor struct {
+	repo     Repository
+	health   *health.Server
+	interval time.Duration
+	down     atomic.Pointer[string] // why the database is unreachable, nil while it is fine
+
+	// errUnavailable is what database calls get while the server is
+	// degraded; its RetryInfo asks clients to wait for the next ping.
+	errUnavailable error
+}
+
+func newDBMonitor(repo Repository, h *health.Server, interval time.Duration) *dbMonitor {
+	st := status.New(codes.Unavailable, "database unavailable, try again later")
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(interval)}); err == nil {
+		st = detailed
+	}
+	return &dbMonitor{repo: repo, health: h, interval: interval, errUnavailable: st.Err()}
+}
+
+// run - Pings the repository every interval until ctx is done
+func (m *dbMonitor) run(ctx context.Context) {
+	interval := m.interval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := m.repo.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		m.set(err)
+	}
+}
+
+// set enters or leaves degraded mode after a ping.
+func (m *dbMonitor) set(err error) {
+	if err == nil {
+		if m.down.Swap(nil) != nil {
+			log.Info("database reachable again, leaving degraded mode")
+			m.setServing(healthpb.HealthCheckResponse_SERVING)
+		}
+		return
+	}
+	reason := err.Error()
+	if m.down.Swap(&reason) == nil {
+		log.Error("database unreachable, entering degraded mode", "error", err)
+		m.setServing(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// unavailable pings the database after a query failed. If it is down, the
+// server degrades right away rather than at the next ping, and the caller
+// gets the Unavailable error to return.
+func (m *dbMonitor) unavailable(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+	defer cancel()
+	err := m.repo.Ping(ctx)
+	m.set(err)
+	if err != nil {
+		return m.errUnavailable
+	}
+	return nil
+}
+
+func (m *dbMonitor) setServing(s healthpb.HealthCheckResponse_ServingStatus) {
+	m.health.SetServingStatus("", s)
+	m.health.SetServingStatus(pb.Greeter_ServiceDesc.ServiceName, s)
+}
+
+// unaryInterceptor - Refuses database calls while degraded
+func (m *dbMonitor) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := m.check(info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor - Refuses database streams while degraded
+func (m *dbMonitor) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := m.check(info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (m *dbMonitor) check(method string) error {
+	if !dbMethods[method] || m.down.Load() == nil {
+		return nil
+	}
+	return m.errUnavailable
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"grpc-example/config"
+
+	"google.golang.org/grpc"
+)
+
+// deadlineUnaryInterceptor - Applies server.deadlines to unary calls
+func deadlineUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, cancel := withDeadlinePolicy(ctx, info.FullMethod)
+	defer cancel()
+	return handler(ctx, req)
+}
+
+// deadlineStreamInterceptor - Applies server.deadlines to streams
+func deadlineStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, cancel := withDeadlinePolicy(ss.Context(), info.FullMethod)
+	defer cancel()
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// withDeadlinePolicy bounds ctx by the deadline policy of method. The
+// deadline a client sent (grpc-timeout) is kept unless it exceeds the
+// method's maximum; calls without one get the method's default, or the
+// maximum if there is no default.
+func withDeadlinePolicy(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	policy := deadlinePolicy(settings.Current().Server.Deadlines, method)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if requested := time.Until(deadline); policy.Max > 0 && requested > policy.Max {
+			log.DebugContext(ctx, "client deadline capped", "method", method, "requested", requested, "max", policy.Max)
+			return context.WithTimeout(ctx, policy.Max)
+		}
+		return context.WithCancel(ctx)
+	}
+
+	limit := policy.Default
+	if limit == 0 {
+		limit = policy.Max
+	}
+	if limit == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, limit)
+}
+
+func deadlinePolicy(d config.ServerDeadlines, method string) config.DeadlinePolicy {
+	if p, ok := d.Methods[method]; ok {
+		return p
+	}
+	return d.Default
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"grpc-example/config"
+	"grpc-example/logging"
+)
+
+func TestDeadlinePolicy(t *testing.T) {
+	d := config.ServerDeadlines{
+		Default: config.DeadlinePolicy{Default: 30 * time.Second, Max: 2 * time.Minute},
+		Methods: map[string]config.DeadlinePolicy{
+			"/helloworld.Greeter/SayHelloServerStream": {Max: 10 * time.Minute},
+		},
+	}
+	if got := deadlinePolicy(d, "/helloworld.Greeter/SayHelloServerStream"); got != d.Methods["/helloworld.Greeter/SayHelloServerStream"] {
+		t.Errorf("overridden method got %+v", got)
+	}
+	if got := deadlinePolicy(d, "/helloworld.Greeter/SayHello"); got != d.Default {
+		t.Errorf("other method got %+v, want the default %+v", got, d.Default)
+	}
+}
+
+func TestWithDeadlinePolicy(t *testing.T) {
+	cfg := config.Defaults("dev")
+	cfg.Server.Deadlines = config.ServerDeadlines{
+		Default: config.DeadlinePolicy{Default: 30 * time.Second, Max: 2 * time.Minute},
+		Methods: map[string]config.DeadlinePolicy{
+			"/test/MaxOnly":   {Max: 5 * time.Minute},
+			"/test/Unbounded": {},
+		},
+	}
+	settings = config.NewReloader(cfg, nil, logging.For("config"))
+
+	tests := []struct {
+		name      string
+		method    string
+		requested time.Duration // 0: no client deadline
+		want      time.Duration // 0: no deadline
+	}{
+		{name: "client deadline kept", method: "/test/Default", requested: time.Minute, want: time.Minute},
+		{name: "client deadline capped", method: "/test/Default", requested: time.Hour, want: 2 * time.Minute},
+		{name: "default without client deadline", method: "/test/Default", want: 30 * time.Second},
+		{name: "max without a default", method: "/test/MaxOnly", want: 5 * time.Minute},
+		{name: "no limits", method: "/test/Unbounded"},
+		{name: "no limits keep the client deadline", method: "/test/Unbounded", requested: time.Hour, want: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.requested > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.requested)
+				defer cancel()
+			}
+			ctx, cancel := withDeadlinePolicy(ctx, tt.method)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if tt.want == 0 {
+				if ok {
+					t.Fatalf("deadline in %v, want none", time.Until(deadline))
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("no deadline, want %v", tt.want)
+			}
+			if left := time.Until(deadline); left > tt.want || left < tt.want-5*time.Second {
+				t.Fatalf("deadline in %v, want %v", left, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	pb "grpc-example/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// adminScope is the API key scope required by the Admin service.
+const adminScope = "admin"
+
+// drainer implements drain mode. Once draining, health reports
+// NOT_SERVING, new streams are refused, and open streams are told to
+// reconnect through goingAway; shutdown waits until they are gone or the
+// grace period is over.
+type drainer struct {
+	health *health.Server
+
+	mu        sync.Mutex
+	draining  bool
+	active    int
+	idle      chan struct{}      // closed once draining with no active streams
+	goingAway chan struct{}      // closed when draining starts; streams then send goingAwayReply
+	requested chan time.Duration // grace period of an Admin.Drain call
+}
+
+func newDrainer(h *health.Server) *drainer {
+	return &drainer{
+		health:    h,
+		idle:      make(chan struct{}),
+		goingAway: make(chan struct{}),
+		requested: make(chan time.Duration, 1),
+	}
+}
+
+// streamInterceptor - Refuses new streams while draining and tracks open ones
+func (d *drainer) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	// Health watches must keep working so clients see NOT_SERVING.
+	if strings.HasPrefix(info.FullMethod, "/grpc.health.v1.Health/") {
+		return handler(srv, ss)
+	}
+
+	d.mu.Lock()
+	if d.draining {
+		d.mu.Unlock()
+		return status.Error(codes.Unavailable, "server is draining, reconnect to another instance")
+	}
+	d.active++
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		d.active--
+		if d.draining && d.active == 0 {
+			close(d.idle)
+		}
+		d.mu.Unlock()
+	}()
+	return handler(srv, ss)
+}
+
+// goingAwayReply is the in-band notice sent on open streams when draining starts.
+func goingAwayReply() *pb.HelloReply {
+	return &pb.HelloReply{Message: "server going away, please reconnect", GoingAway: true}
+}
+
+// start enters drain mode and returns the number of open streams; it is a
+// no-op when already draining.
+func (d *drainer) start() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return d.active
+	}
+	d.draining = true
+	d.health.Shutdown()
+	close(d.goingAway)
+	if d.active == 0 {
+		close(d.idle)
+	}
+	return d.active
+}
+
+// drain enters drain mode and waits until every stream has finished or the
+// grace period is over.
+func (d *drainer) drain(grace time.Duration) {
+	active := d.start()
+	log.Info("draining", "active_streams", active, "grace_period", grace)
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-d.idle:
+		log.Info("all streams finished")
+	case <-timer.C:
+		d.mu.Lock()
+		log.Warn("drain grace period over, closing remaining streams", "active_streams", d.active)
+		d.mu.Unlock()
+	}
+}
+
+// adminServer implements the Admin service.
+type adminServer struct {
+	pb.UnimplementedAdminServer
+	drainer *drainer
+	repo    Repository
+	db      *dbMonitor
+	// archiveDir holds the retention archives EraseUser redacts.
+	archiveDir string
+}
+
+// Drain - Starts drain mode and asks main to shut down once it is over
+func (a *adminServer) Drain(ctx context.Context, in *pb.DrainRequest) (*pb.DrainReply, error) {
+	if err := requireScope(ctx, adminScope); err != nil {
+		return nil, err
+	}
+	grace := settings.Current().Server.DrainGracePeriod
+	if in.GracePeriod != nil {
+		if err := in.GracePeriod.CheckValid(); err != nil || in.GracePeriod.AsDuration() < 0 {
+			return nil, status.Error(codes.InvalidArgument, "grace_period must be a non-negative duration")
+		}
+		grace = in.GracePeriod.AsDuration()
+	}
+
+	select {
+	case a.drainer.requested <- grace:
+	default:
+		// A drain is already under way.
+	}
+	active := a.drainer.start()
+	log.WarnContext(ctx, "drain requested", "by", principalFrom(ctx).KeyName, "grace_period", grace, "active_streams", active)
+	return &pb.DrainReply{ActiveStreams: int32(active), GracePeriod: durationpb.New(grace)}, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// prismaSchemaPath is where check-prisma looks by default.
+const prismaSchemaPath = "prisma/schema.prisma"
+
+// prismaScalars maps the Go types used by the models to Prisma scalars.
+var prismaScalars = map[reflect.Type]string{
+	reflect.TypeOf(""):          "String",
+	reflect.TypeOf(time.Time{}): "DateTime",
+	reflect.TypeOf(int64(0)):    "BigInt",
+	reflect.TypeOf(int32(0)):    "Int",
+	reflect.TypeOf(0):           "Int",
+	reflect.TypeOf(false):       "Boolean",
+	reflect.TypeOf(0.0):         "Float",
+}
+
+var (
+	prismaMap    = regexp.MustCompile(`@map\("([^"]+)"\)`)
+	prismaNative = regexp.MustCompile(`@db\.(\w+)`)
+)
+
+// prismaModel is a model of schema.prisma, reduced to what check-prisma
+// compares.
+type prismaModel struct {
+	name    string
+	table   string
+	columns map[string]prismaField
+}
+
+type prismaField struct {
+	name     string
+	scalar   string
+	optional bool
+	native   string // @db.X attribute, "" if none
+}
+
+// parsePrisma reads the models of a Prisma schema. Relation fields are
+// left out since they have no column.
+func parsePrisma(path string) (map[string]*prismaModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	type field struct {
+		prismaField
+		column string
+	}
+	type rawModel struct {
+		name, table string
+		fields      []field
+	}
+	var models []*rawModel
+	var current *rawModel
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		line = strings.TrimSpace(line)
+		words := strings.Fields(line)
+		switch {
+		case len(words) == 0:
+		case current == nil:
+			if len(words) == 3 && words[0] == "model" && words[2] == "{" {
+				current = &rawModel{name: words[1], table: words[1]}
+				models = append(models, current)
+			}
+		case words[0] == "}":
+			current = nil
+		case strings.HasPrefix(words[0], "@@"):
+			if m := prismaMap.FindStringSubmatch(line); m != nil && strings.HasPrefix(line, "@@map") {
+				current.table = m[1]
+			}
+		case len(words) >= 2:
+			f := field{prismaField: prismaField{name: words[0]}, column: words[0]}
+			typ := words[1]
+			if strings.HasSuffix(typ, "[]") {
+				continue // list side of a relation
+			}
+			f.scalar, f.optional = strings.CutSuffix(typ, "?")
+			if m := prismaMap.FindStringSubmatch(line); m != nil {
+				f.column = m[1]
+			}
+			if m := prismaNative.FindStringSubmatch(line); m != nil {
+				f.native = m[1]
+			}
+			current.fields = append(current.fields, f)
+		}
+	}
+
+	out := make(map[string]*prismaModel)
+	for _, m := range models {
+		pm := &prismaModel{name: m.name, table: m.table, columns: make(map[string]prismaField)}
+		for _, f := range m.fields {
+			if slices.ContainsFunc(models, func(other *rawModel) bool { return other.name == f.scalar }) {
+				continue // singular side of a relation
+			}
+			pm.columns[f.column] = f.prismaField
+		}
+		out[pm.table] = pm
+	}
+	return out, scanner.Err()
+}
+
+// prismaDrift lists every difference between the GORM models and a Prisma
+// schema: missing tables or columns, scalar types, nullability, and
+// DateTime columns without a time zone (the migrations use timestamptz).
+func prismaDrift(path string) ([]string, error) {
+	prisma, err := parsePrisma(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []string
+	seen := make(map[string]bool)
+	for _, model := range schemaModels {
+		s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+		if err != nil {
+			return nil, err
+		}
+		seen[s.Table] = true
+		pm, ok := prisma[s.Table]
+		if !ok {
+			drift = append(drift, fmt.Sprintf("table %s (%s) has no Prisma model", s.Table, s.Name))
+			continue
+		}
+
+		columns := make(map[string]bool)
+		for _, f := range s.Fields {
+			if f.DBName == "" {
+				continue // relation
+			}
+			columns[f.DBName] = true
+			where := fmt.Sprintf("%s.%s", s.Table, f.DBName)
+			pf, ok := pm.columns[f.DBName]
+			if !ok {
+				drift = append(drift, fmt.Sprintf("%s: column of %s.%s is missing from Prisma model %s (add @map(%q)?)", where, s.Name, f.Name, pm.name, f.DBName))
+				continue
+			}
+			goType, nullable := f.FieldType, false
+			if goType.Kind() == reflect.Pointer {
+				goType, nullable = goType.Elem(), true
+			}
+			if want := prismaScalars[goType]; want != pf.scalar {
+				drift = append(drift, fmt.Sprintf("%s: Go type %s wants Prisma %s, schema has %s", where, f.FieldType, want, pf.scalar))
+			}
+			if nullable != pf.optional {
+				drift = append(drift, fmt.Sprintf("%s: nullable in Go is %t, optional in Prisma is %t", where, nullable, pf.optional))
+			}
+			if pf.scalar == "DateTime" && pf.native != "Timestamptz" && pf.native != "Date" {
+				drift = append(drift, fmt.Sprintf("%s: Prisma DateTime needs @db.Timestamptz (or @db.Date) to match the migrations", where))
+			}
+		}
+		for column, pf := range pm.columns {
+			if !columns[column] {
+				drift = append(drift, fmt.Sprintf("%s.%s: Prisma field %s.%s has no GORM field", s.Table, column, pm.name, pf.name))
+			}
+		}
+	}
+	for table, pm := range prisma {
+		if !seen[table] {
+			drift = append(drift, fmt.Sprintf("table %s: Prisma model %s has no GORM model", table, pm.name))
+		}
+	}
+	slices.Sort(drift)
+	return drift, nil
+}
+
+// runPrismaCheck - Reports drift between prisma/schema.prisma (or path) and
+// the GORM models; it fails when there is any, so it can gate CI
+func runPrismaCheck(args []string) error {
+	path := prismaSchemaPath
+	if len(args) > 0 {
+		path = args[0]
+	}
+	drift, err := prismaDrift(path)
+	if err != nil {
+		return fmt.Errorf("check-prisma: %w", err)
+	}
+	if len(drift) > 0 {
+		for _, d := range drift {
+			fmt.Println("✗", d)
+		}
+		return fmt.Errorf("check-prisma: %d difference(s) between %s and the GORM models", len(drift), path)
+	}
+	fmt.Printf("✓ %s matches the GORM models (%d tables)\n", path, len(schemaModels))
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"grpc-example/config"
+	"grpc-example/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// withCorrelationIDs copies the request and trace IDs sent by the gateway
+// (or any other client) from incoming metadata into the context so every
+// log line written while serving the call carries them.
+func withCorrelationIDs(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestID := firstMetadata(md, logging.RequestIDHeader)
+	if requestID == "" {
+		requestID = logging.NewRequestID()
+	}
+	ctx = logging.WithRequestID(ctx, requestID)
+	if traceID := logging.TraceIDFromTraceParent(firstMetadata(md, logging.TraceParentKey)); traceID != "" {
+		ctx = logging.WithTraceID(ctx, traceID)
+	}
+	return ctx
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// loggingUnaryInterceptor - Attaches correlation IDs and logs every unary call
+func loggingUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx = withCorrelationIDs(ctx)
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logRPC(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+// loggingStreamInterceptor - Attaches correlation IDs and logs every stream
+func loggingStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := withCorrelationIDs(ss.Context())
+	start := time.Now()
+	err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	logRPC(ctx, info.FullMethod, start, err)
+	return err
+}
+
+func logRPC(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	args := []any{"method", method, "code", code.String(), "duration", time.Since(start)}
+	if err != nil {
+		log.WarnContext(ctx, "rpc failed", append(args, "error", err)...)
+		return
+	}
+	log.InfoContext(ctx, "rpc completed", args...)
+}
+
+// killSwitchUnaryInterceptor - Rejects methods listed in server.disabled_methods
+func killSwitchUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := checkKillSwitch(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// killSwitchStreamInterceptor - Rejects streams listed in server.disabled_methods
+func killSwitchStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := checkKillSwitch(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// checkKillSwitch - Unimplemented rather than Unavailable: a switched-off
+// method stays off, so clients and retry policies must not retry it
+func checkKillSwitch(ctx context.Context, method string) error {
+	if !config.MethodDisabled(settings.Current().Server.DisabledMethods, method) {
+		return nil
+	}
+	log.WarnContext(ctx, "call blocked by kill switch", "method", method)
+	return status.Errorf(codes.Unimplemented, "%s has been disabled", method)
+}
+
+// contextStream overrides the context of a grpc.ServerStream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
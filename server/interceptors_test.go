@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"grpc-example/config"
+	"grpc-example/logging"
+)
+
+func TestKillSwitchRejectsWithUnimplemented(t *testing.T) {
+	cfg := config.Defaults("dev")
+	cfg.Server.DisabledMethods = []string{"/helloworld.Greeter/SayHello"}
+	settings = config.NewReloader(cfg, nil, logging.For("config"))
+
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+	_, err := killSwitchUnaryInterceptor(context.Background(), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/helloworld.Greeter/SayHello"}, handler)
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("disabled method failed with %v, want Unimplemented", err)
+	}
+	reply, err := killSwitchUnaryInterceptor(context.Background(), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/helloworld.Greeter/SayHelloServerStream"}, handler)
+	if err != nil || reply != "ok" {
+		t.Fatalf("enabled method = %v, %v; want it handled", reply, err)
+	}
+}
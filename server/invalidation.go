@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// userInvalidation names the users a write touched. Every replica evicts
+// them from its userCache; All clears the whole cache.
+type userInvalidation struct {
+	Origin string   `json:"origin"` // replica that made the write
+	Names  []string `json:"names,omitempty"`
+	IDs    []string `json:"ids,omitempty"`
+	All    bool     `json:"all,omitempty"`
+}
+
+// invalidationBus carries user cache invalidations between replicas.
+type invalidationBus interface {
+	// Publish announces inv. tx is the connection (or transaction) that
+	// made the write, so a bus backed by the database can deliver it only
+	// once the write commits.
+	Publish(ctx context.Context, tx gorm.ConnPool, inv userInvalidation) error
+	// Listen calls fn with every invalidation published by any replica,
+	// including this one, until ctx is cancelled. Whenever some may have
+	// been missed it calls fn with All set.
+	Listen(ctx context.Context, fn func(userInvalidation))
+}
+
+// userCacheChannel is the NOTIFY channel of the postgres bus.
+const userCacheChannel = "user_cache"
+
+// maxNotifyPayload stays below Postgres' 8000 byte limit on NOTIFY payloads;
+// larger invalidations are sent as All.
+const maxNotifyPayload = 7900
+
+// localBus delivers invalidations to the listeners of this process. It is
+// what SQLite uses, and lets tests run several repositories as replicas.
+type localBus struct {
+	mu        sync.Mutex
+	listeners map[*func(userInvalidation)]struct{}
+}
+
+// processBus is the localBus shared by every repository of the process.
+var processBus = &localBus{}
+
+func (b *localBus) Publish(_ context.Context, _ gorm.ConnPool, inv userInvalidation) error {
+	b.mu.Lock()
+	listeners := make([]func(userInvalidation), 0, len(b.listeners))
+	for fn := range b.listeners {
+		listeners = append(listeners, *fn)
+	}
+	b.mu.Unlock()
+	for _, fn := range listeners {
+		fn(inv)
+	}
+	return nil
+}
+
+func (b *localBus) Listen(ctx context.Context, fn func(userInvalidation)) {
+	b.mu.Lock()
+	if b.listeners == nil {
+		b.listeners = make(map[*func(userInvalidation)]struct{})
+	}
+	b.listeners[&fn] = struct{}{}
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	delete(b.listeners, &fn)
+	b.mu.Unlock()
+}
+
+// pgBus sends invalidations with NOTIFY and receives them on a dedicated
+// connection that LISTENs, reconnecting with backoff when it drops.
+type pgBus struct {
+	url string
+}
+
+func (b *pgBus) Publish(ctx context.Context, tx gorm.ConnPool, inv userInvalidation) error {
+	payload, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		payload, _ = json.Marshal(userInvalidation{Origin: inv.Origin, All: true})
+	}
+	// NOTIFY is transactional: inside a transaction it is sent on commit
+	// and dropped on rollback
+	_, err = tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", userCacheChannel, string(payload))
+	return err
+}
+
+// pgListenPing is how long the listener waits for a notification before
+// checking that its connection is still alive.
+const pgListenPing = 30 * time.Second
+
+func (b *pgBus) Listen(ctx context.Context, fn func(userInvalidation)) {
+	const maxBackoff = 30 * time.Second
+	backoff := time.Second
+	connected := false
+	for {
+		err := b.listen(ctx, func() {
+			if connected {
+				// Notifications sent while disconnected are lost
+				fn(userInvalidation{All: true})
+				dbLog.Info("user cache listener reconnected, cache cleared")
+			}
+			connected = true
+			backoff = time.Second
+		}, fn)
+		if ctx.Err() != nil {
+			return
+		}
+		dbLog.Warn("user cache listener disconnected", "error", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// listen runs one LISTEN session, calling onConnect once it is listening.
+// It returns when the connection fails or ctx is cancelled.
+func (b *pgBus) listen(ctx context.Context, onConnect func(), fn func(userInvalidation)) error {
+	conn, err := pgx.Connect(ctx, b.url)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{userCacheChannel}.Sanitize()); err != nil {
+		return err
+	}
+	onConnect()
+
+	for {
+		wait, cancel := context.WithTimeout(ctx, pgListenPing)
+		n, err := conn.WaitForNotification(wait)
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, context.DeadlineExceeded):
+			// Quiet for a while; make sure the connection did not die silently
+			if err := conn.Ping(ctx); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			return err
+		}
+		var inv userInvalidation
+		if err := json.Unmarshal([]byte(n.Payload), &inv); err != nil {
+			dbLog.Warn("ignoring malformed user cache invalidation", "payload", n.Payload, "error", err)
+			continue
+		}
+		fn(inv)
+	}
+}
+
+// newInvalidationBus - Picks the bus for database.user_cache.invalidation
+func newInvalidationBus(mode, dialect, dbURL, listenURL string) (invalidationBus, error) {
+	if mode == "auto" {
+		mode = "local"
+		if dialect == "postgres" {
+			mode = "postgres"
+		}
+	}
+	switch mode {
+	case "local":
+		return processBus, nil
+	case "postgres":
+		if dialect != "postgres" {
+			return nil, fmt.Errorf("user cache invalidation over postgres needs a Postgres database, not %s", dialect)
+		}
+		if listenURL == "" {
+			listenURL = dbURL
+		}
+		return &pgBus{url: listenURL}, nil
+	}
+	return nil, fmt.Errorf("unknown user cache invalidation %q", mode)
+}
+
+// applyInvalidation evicts what a write, here or on another replica, touched.
+func (c *userCache) applyInvalidation(inv userInvalidation) {
+	if inv.All {
+		c.Clear()
+		return
+	}
+	c.invalidate(inv.Names, inv.IDs)
+}
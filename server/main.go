@@ -2,159 +2,195 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"io"
-	"log"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
-	"github.com/joho/godotenv"
-	pb "grpc-example/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/status"
-	"gorm.io/gorm"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"grpc-example/config"
+	"grpc-example/logging"
+	pb "grpc-example/proto"
 )
 
+var log = logging.For("server")
+
+// settings holds the live configuration; reloadable values must be read
+// through settings.Current() on every use
+var settings *config.Reloader
+
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 2 * time.Second
+
+// greetingInsertTimeout bounds the background insert of greetings created
+// by a client stream.
+const greetingInsertTimeout = 30 * time.Second
+
 type server struct {
 	pb.UnimplementedGreeterServer
-	db *gorm.DB
+	repo     Repository
+	limiter  *callLimiter
+	drainer  *drainer
+	db       *dbMonitor
+	webhooks *dispatcher
 }
 
-// 1. UNARY RPC - ⛔ DISABLED: This endpoint has been disabled
+// 1. UNARY RPC - ⛔ Disabled by default via the server.disabled_methods kill switch
 func (s *server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
-	log.Printf("[Unary] ⛔ Access blocked - Service disabled for: %s", in.Name)
-	
-	// Return gRPC error status
-	return nil, status.Errorf(codes.Unimplemented, "Unary API endpoint has been disabled")
+	log.InfoContext(ctx, "received request", "rpc", "unary", "name", in.Name)
+	return &pb.HelloReply{Message: fmt.Sprintf("Hello %s", in.Name)}, nil
 }
 
 // 2. SERVER STREAMING RPC - OPTIMIZED: One request, multiple responses from server
 func (s *server) SayHelloServerStream(in *pb.HelloRequest, stream pb.Greeter_SayHelloServerStreamServer) error {
 	startTime := time.Now()
-	log.Printf("[Server Streaming] 📥 Received request from: %s", in.Name)
-	
+
 	// ⚡ OPTIMIZATION: Check context for cancellation
 	ctx := stream.Context()
-	
+	log.InfoContext(ctx, "received request", "rpc", "server_stream", "name", in.Name)
+
 	// Send multiple responses to the client
+	goingAway := s.drainer.goingAway
 	for i := 1; i <= 5; i++ {
 		// Check if context is cancelled
 		select {
 		case <-ctx.Done():
-			log.Printf("[Server Streaming] ⚠️  Context cancelled")
+			log.WarnContext(ctx, "context cancelled", "rpc", "server_stream")
 			return ctx.Err()
+		case <-goingAway:
+			// Tell the client to reconnect, then finish what is left
+			goingAway = nil
+			if err := stream.Send(goingAwayReply()); err != nil {
+				return err
+			}
 		default:
 		}
-		
+
 		msg := fmt.Sprintf("Hello %s - Message %d of 5", in.Name, i)
 		response := &pb.HelloReply{Message: msg}
-		
+
 		if err := stream.Send(response); err != nil {
-			log.Printf("[Server Streaming] ❌ Send error: %v", err)
+			log.ErrorContext(ctx, "send failed", "rpc", "server_stream", "error", err)
 			return err
 		}
-		
+
 		time.Sleep(1 * time.Second) // Simulate real-time data
 	}
-	
+
 	duration := time.Since(startTime)
-	log.Printf("[Server Streaming] ⚡ Completed in %v", duration)
+	log.InfoContext(ctx, "stream completed", "rpc", "server_stream", "duration", duration)
 	return nil
 }
 
 // 3. CLIENT STREAMING RPC - OPTIMIZED: Batch operations for multiple users
 func (s *server) SayHelloClientStream(stream pb.Greeter_SayHelloClientStreamServer) error {
 	startTime := time.Now()
-	log.Printf("[Client Streaming] 📥 Waiting for client messages...")
-	
+	ctx := stream.Context()
+	log.DebugContext(ctx, "waiting for client messages", "rpc", "client_stream")
+
 	var names []string
-	
+
 	// Receive multiple messages from client
 	for {
 		req, err := stream.Recv()
 		if err == io.EOF {
 			// Client finished sending
-			log.Printf("[Client Streaming] ✅ Received %d names", len(names))
-			
-			// ⚡ OPTIMIZATION: Process all users concurrently with goroutines
-			var wg sync.WaitGroup
-			userChan := make(chan *User, len(names))
-			
-			for _, name := range names {
-				wg.Add(1)
-				go func(n string) {
-					defer wg.Done()
-					user, err := GetOrCreateUser(s.db, n)
-					if err == nil {
-						userChan <- user
+			log.InfoContext(ctx, "received names", "rpc", "client_stream", "count", len(names))
+
+			// Every name becomes a greeting, charged to the caller's daily quota
+			if err := s.limiter.consume(ctx, greetingsQuota, int64(len(names))); err != nil {
+				if status.Code(err) == codes.Internal {
+					// The quota lives in the database too
+					if err := s.db.unavailable(ctx); err != nil {
+						return err
 					}
-				}(name)
+				}
+				return err
 			}
-			
-			// Wait for all users to be processed
-			go func() {
-				wg.Wait()
-				close(userChan)
-			}()
-			
-			// Collect user IDs
-			var users []*User
-			for user := range userChan {
-				users = append(users, user)
+
+			// ⚡ OPTIMIZATION: Resolve every name with one set-based upsert
+			// instead of a round trip per name
+			users, err := s.repo.GetOrCreateUsers(ctx, names)
+			if err != nil {
+				// A missing user would silently drop its greeting, so fail the call
+				log.ErrorContext(ctx, "user lookup failed", "rpc", "client_stream", "count", len(names), "error", err)
+				if ctx.Err() != nil {
+					return status.FromContextError(ctx.Err()).Err()
+				}
+				if err := s.db.unavailable(ctx); err != nil {
+					return err
+				}
+				return status.Error(codes.Internal, "user lookup failed")
 			}
-			
-			// ⚡ OPTIMIZATION: Batch insert greetings asynchronously
+
+			// ⚡ OPTIMIZATION: Insert the greetings asynchronously, in one
+			// statement (COPY for very large batches on Postgres). The insert
+			// outlives the RPC, so it gets its own deadline instead of the call's.
+			// The timestamp is fixed now so the reply can report it.
+			recordedAt := time.Now().UTC()
+			batchID := uuid.NewString()
 			go func() {
-				greetings := make([]Greeting, len(users))
-				for i, user := range users {
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), greetingInsertTimeout)
+				defer cancel()
+				greetings := make([]Greeting, len(names))
+				for i, name := range names {
+					user := users[name]
 					greetings[i] = Greeting{
-						Message: fmt.Sprintf("Hello %s", user.Name),
-						UserID:  &user.ID,
+						Message:   fmt.Sprintf("Hello %s", user.Name),
+						UserID:    &user.ID,
+						CreatedAt: recordedAt,
+						BatchID:   &batchID,
 					}
 				}
 				if len(greetings) > 0 {
-					s.db.CreateInBatches(greetings, 100) // Batch insert 100 at a time
+					if err := s.repo.CreateGreetings(ctx, greetings, s.webhooks.notify()); err != nil {
+						log.ErrorContext(ctx, "greeting batch insert failed", "rpc", "client_stream", "count", len(greetings), "error", err)
+					}
 				}
 			}()
-			
+
 			// Build response
 			allNames := strings.Join(names, ", ")
 			totalTime := time.Since(startTime)
-			
-			log.Printf("[Client Streaming] ⚡ Processed %d users in %v", len(names), totalTime)
-			
+
+			log.InfoContext(ctx, "processed users", "rpc", "client_stream", "count", len(names), "duration", totalTime)
+
 			return stream.SendAndClose(&pb.HelloReply{
-				Message: fmt.Sprintf("Hello to all: %s! (Total: %d people, %v)", allNames, len(names), totalTime),
+				Message:   fmt.Sprintf("Hello to all: %s! (Total: %d people, %v)", allNames, len(names), totalTime),
+				CreatedAt: timestamppb.New(recordedAt),
 			})
 		}
 		if err != nil {
 			return err
 		}
-		
-		log.Printf("[Client Streaming] 📨 Received: %s", req.Name)
+
+		log.DebugContext(ctx, "received name", "rpc", "client_stream", "name", req.Name)
 		names = append(names, req.Name)
 	}
 }
 
 // 4. BIDIRECTIONAL STREAMING RPC - OPTIMIZED: Both client and server send multiple messages
 func (s *server) SayHelloBidirectional(stream pb.Greeter_SayHelloBidirectionalServer) error {
-	log.Printf("[Bidirectional] 📥 Starting bidirectional stream...")
 	ctx := stream.Context()
-	
+	log.InfoContext(ctx, "starting stream", "rpc", "bidi")
+
 	// ⚡ OPTIMIZATION: Use goroutine for concurrent send/receive
 	recvChan := make(chan *pb.HelloRequest, 10)
 	errChan := make(chan error, 1)
-	
+
 	// Receive goroutine
 	go func() {
 		for {
@@ -170,33 +206,42 @@ func (s *server) SayHelloBidirectional(stream pb.Greeter_SayHelloBidirectionalSe
 			recvChan <- req
 		}
 	}()
-	
+
 	// Process messages
+	goingAway := s.drainer.goingAway
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("[Bidirectional] ⚠️  Context cancelled")
+			log.WarnContext(ctx, "context cancelled", "rpc", "bidi")
 			return ctx.Err()
-			
+
+		case <-goingAway:
+			// Keep serving until the client hangs up or the grace period ends
+			goingAway = nil
+			log.InfoContext(ctx, "asking client to reconnect", "rpc", "bidi")
+			if err := stream.Send(goingAwayReply()); err != nil {
+				return err
+			}
+
 		case err := <-errChan:
 			if err != nil {
-				log.Printf("[Bidirectional] ❌ Receive error: %v", err)
+				log.ErrorContext(ctx, "receive failed", "rpc", "bidi", "error", err)
 				return err
 			}
-			
+
 		case req, ok := <-recvChan:
 			if !ok {
-				log.Printf("[Bidirectional] ✅ Client closed the stream")
+				log.InfoContext(ctx, "client closed the stream", "rpc", "bidi")
 				return nil
 			}
-			
+
 			// Send immediate response
 			response := &pb.HelloReply{
 				Message: fmt.Sprintf("Echo: Hello %s! (received at %s)", req.Name, time.Now().Format("15:04:05")),
 			}
-			
+
 			if err := stream.Send(response); err != nil {
-				log.Printf("[Bidirectional] ❌ Send error: %v", err)
+				log.ErrorContext(ctx, "send failed", "rpc", "bidi", "error", err)
 				return err
 			}
 		}
@@ -204,115 +249,266 @@ func (s *server) SayHelloBidirectional(stream pb.Greeter_SayHelloBidirectionalSe
 }
 
 func main() {
-	// Load .env file from project root (parent directory)
-	envPath := filepath.Join("..", ".env")
-	if _, err := os.Stat(envPath); err == nil {
-		if err := godotenv.Load(envPath); err != nil {
-			log.Printf("Warning: Could not load .env file: %v", err)
-		} else {
-			log.Println("✅ Loaded .env file")
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := logging.Setup(cfg.LoggingOptions()); err != nil {
+		logging.Fatal(log, "invalid logging configuration", "error", err)
+	}
+	cfg.Report(log)
+
+	// Maintenance commands: server migrate ..., server check-prisma
+	if len(cfg.Args) > 0 {
+		if err := runCommand(cfg, cfg.Args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
-	} else {
-		// Try current directory
-		if err := godotenv.Load(); err != nil {
-			log.Printf("Warning: Could not load .env file: %v", err)
+		return
+	}
+
+	// ⚡ Live reload of origins, kill switches and log levels (SIGHUP or file change)
+	settings = config.NewReloader(cfg, os.Args[1:], logging.For("config"))
+	settings.OnReload(func(_, cur *config.Config) {
+		if err := logging.SetLevels(cur.Log.Level, cur.Log.Levels); err != nil {
+			log.Error("could not apply log levels", "error", err)
 		}
+	})
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	go settings.Run(reloadCtx, configPollInterval)
+
+	// Open the repository selected by database.url (Postgres or in-memory),
+	// waiting up to database.startup_timeout for the database to come up
+	repo, err := openRepositoryRetrying(cfg.Database)
+	if err != nil {
+		logging.Fatal(log, "failed to initialize database", "error", err)
+	}
+	defer repo.Close()
+
+	// Background purge of expired greetings (database.retention)
+	if rc := cfg.Database.Retention; rc.Enabled() {
+		rt := newRetention(repo, rc)
+		rt.publish("retention")
+		go rt.run(reloadCtx)
+	}
+
+	// Greeting counts per minute, hour and day for Admin.GetGreetingStats
+	// (database.rollups)
+	if cfg.Database.Rollups.Enabled {
+		rj := newRollupJob(repo, cfg.Database.Rollups)
+		rj.publish("rollups")
+		go rj.run(reloadCtx)
+	}
+
+	// Hash-chained audit log of Greeter and Admin calls (server.audit)
+	audit, err := newAuditor(repo, cfg)
+	if err != nil {
+		logging.Fatal(log, "failed to configure the audit log", "error", err)
+	}
+	if audit != nil {
+		audit.publish("audit")
 	}
-	
-	// Initialize database connection
-	if err := InitDB(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+
+	// Signed webhooks for greeting events, through the outbox (server.webhooks)
+	webhooks, err := newDispatcher(repo, cfg.Server.Webhooks)
+	if err != nil {
+		logging.Fatal(log, "failed to configure webhooks", "error", err)
+	}
+	if webhooks != nil {
+		webhooks.publish("webhooks")
+		go webhooks.run(reloadCtx)
+	}
+
+	// expvar counters (user cache, ...) on a private listener
+	if cfg.Server.DebugAddr != "" {
+		go serveDebug(cfg.Server.DebugAddr)
 	}
-	defer CloseDB()
-	
+
 	// Note: We use HTTP server for gRPC-Web, which internally uses the gRPC server
 	// No need for separate listener - grpcweb handles it
-	
+
+	// ⚡ Per-caller rate limits and daily quotas (server.rate_limit), also
+	// covering native gRPC clients that bypass the gateway
+	limiter := newCallLimiter(repo)
+	go limiter.sweep(reloadCtx, 10*time.Minute)
+
+	// ⚡ Shed new calls early while the DB pool is saturated (server.load_shedding)
+	pool, _ := repo.(pooled)
+	admission := newAdmissionController(pool)
+	go admission.monitor(reloadCtx)
+
+	// Drain mode (SIGTERM or Admin.Drain) reports NOT_SERVING through the
+	// standard health service and tells open streams to reconnect
+	healthServer := health.NewServer()
+	drainer := newDrainer(healthServer)
+
+	// Degraded mode: while the database is unreachable, health reports
+	// NOT_SERVING and only the calls that need it are refused
+	dbMon := newDBMonitor(repo, healthServer, cfg.Database.HealthInterval)
+	go dbMon.run(reloadCtx)
+
 	// ⚡ OPTIMIZED gRPC Server with keepalive and performance settings
+	ka := cfg.Server.Keepalive
 	srv := grpc.NewServer(
 		// ⚡ Keepalive enforcement - prevents dead connections
 		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
-			MinTime:             5 * time.Second, // Minimum time between pings
-			PermitWithoutStream: true,            // Allow pings without active streams
+			MinTime:             ka.MinTime,             // Minimum time between pings
+			PermitWithoutStream: ka.PermitWithoutStream, // Allow pings without active streams
 		}),
-		
+
 		// ⚡ Keepalive parameters - keeps connections alive
 		grpc.KeepaliveParams(keepalive.ServerParameters{
-			MaxConnectionIdle:     15 * time.Minute, // Close idle connections after 15min
-			MaxConnectionAge:      30 * time.Minute, // Close connections after 30min
-			MaxConnectionAgeGrace: 5 * time.Second,  // Grace period for closing
-			Time:                  5 * time.Second,  // Send keepalive ping every 5s
-			Timeout:               1 * time.Second, // Wait 1s for ping ack
+			MaxConnectionIdle:     ka.MaxConnectionIdle,     // Close idle connections
+			MaxConnectionAge:      ka.MaxConnectionAge,      // Recycle long-lived connections
+			MaxConnectionAgeGrace: ka.MaxConnectionAgeGrace, // Grace period for closing
+			Time:                  ka.Time,                  // Keepalive ping interval
+			Timeout:               ka.Timeout,               // Wait for ping ack
 		}),
-		
+
 		// ⚡ Message size limits
-		grpc.MaxRecvMsgSize(4*1024*1024),  // 4MB max receive
-		grpc.MaxSendMsgSize(4*1024*1024),  // 4MB max send
-		grpc.MaxConcurrentStreams(1000),   // Max concurrent streams
+		grpc.MaxRecvMsgSize(cfg.Server.MaxRecvMsgSize),
+		grpc.MaxSendMsgSize(cfg.Server.MaxSendMsgSize),
+		grpc.MaxConcurrentStreams(cfg.Server.MaxConcurrentStreams),
+
+		// Correlation IDs and structured per-RPC logging, the audit log,
+		// method kill switches (server.disabled_methods), drain mode,
+		// degraded mode, load shedding, API key auth, request validation
+		// (proto/validate.proto) and rate limits
+		grpc.ChainUnaryInterceptor(
+			loggingUnaryInterceptor,
+			audit.unaryInterceptor,
+			deadlineUnaryInterceptor,
+			killSwitchUnaryInterceptor,
+			dbMon.unaryInterceptor,
+			admission.unaryInterceptor,
+			authUnaryInterceptor,
+			validationUnaryInterceptor,
+			limiter.unaryInterceptor,
+		),
+		grpc.ChainStreamInterceptor(
+			loggingStreamInterceptor,
+			audit.streamInterceptor,
+			deadlineStreamInterceptor,
+			killSwitchStreamInterceptor,
+			drainer.streamInterceptor,
+			dbMon.streamInterceptor,
+			admission.streamInterceptor,
+			authStreamInterceptor,
+			validationStreamInterceptor,
+			limiter.streamInterceptor,
+		),
 	)
-	
-	pb.RegisterGreeterServer(srv, &server{db: DB})
-	
+
+	pb.RegisterGreeterServer(srv, &server{repo: repo, limiter: limiter, drainer: drainer, db: dbMon, webhooks: webhooks})
+	pb.RegisterAdminServer(srv, &adminServer{
+		drainer: drainer, repo: repo, db: dbMon, archiveDir: cfg.Database.Retention.ArchiveDir,
+	})
+	healthpb.RegisterHealthServer(srv, healthServer)
+	healthServer.SetServingStatus(pb.Greeter_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
 	// ⚡ Wrap gRPC server with gRPC-Web support for browser clients
 	wrappedServer := grpcweb.WrapServer(srv,
 		grpcweb.WithOriginFunc(func(origin string) bool {
-			// Allow requests from Next.js frontend
-			return origin == "http://localhost:3000" || 
-			       origin == "http://localhost:3001" ||
-			       origin == "" // Allow same-origin requests
+			// Allow same-origin requests and the configured frontends
+			return origin == "" || config.OriginAllowed(settings.Current().Server.AllowedOrigins, origin)
 		}),
 		grpcweb.WithWebsockets(true), // Enable WebSocket support for bidirectional streaming
 		grpcweb.WithWebsocketOriginFunc(func(req *http.Request) bool {
 			return true // Allow WebSocket connections
 		}),
 	)
-	
-	// Create HTTP server that serves gRPC-Web (for browsers)
-	// Regular gRPC clients can still connect directly to the gRPC server
+
+	// Create HTTP server that serves gRPC-Web (for browsers) and, over
+	// cleartext HTTP/2 (h2c), native gRPC clients such as the gateway and
+	// the CLI on the same port; HTTP/1.1 alone cannot carry native gRPC
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
 	httpServer := &http.Server{
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Serve gRPC-Web requests
-			wrappedServer.ServeHTTP(w, r)
-		}),
-		Addr:         ":8080",
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		// ⚡ Read/write timeouts stay strict for unary calls; streams and
+		// WebSocket sessions are bounded by their deadline policy instead
+		Handler:      streamAwareTimeouts(wrappedServer, streamingMethods(srv)),
+		Addr:         cfg.Server.ListenAddr,
+		Protocols:    protocols,
+		HTTP2:        &http.HTTP2Config{MaxConcurrentStreams: int(cfg.Server.MaxConcurrentStreams)},
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
-	
-	// Start gRPC server in a separate goroutine (for native clients)
-	// Note: This won't work on the same port, so we'll use HTTP server for both
-	// The grpcweb wrapper handles both gRPC-Web and can proxy to gRPC
-	
-	fmt.Println("⚡ gRPC + gRPC-Web server listening on :8080")
-	fmt.Println("✅ Database connected and ready")
-	fmt.Println("⚡ Optimizations: Keepalive, Connection Pooling, Max Streams: 1000")
-	fmt.Println("🌐 gRPC-Web enabled for browser clients (no gateway needed!)")
-	
+
+	log.Info("gRPC + gRPC-Web server listening",
+		"addr", httpServer.Addr,
+		"max_streams", cfg.Server.MaxConcurrentStreams,
+		"grpc_web", true,
+	)
+
 	// ⚡ Graceful shutdown
 	go func() {
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("failed to serve: %v", err)
+			logging.Fatal(log, "failed to serve", "error", err)
 		}
 	}()
-	
-	// Wait for interrupt signal
+
+	// Wait for interrupt signal or an Admin.Drain call
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
-	
-	log.Println("🛑 Shutting down server gracefully...")
-	
-	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	var grace time.Duration
+	select {
+	case sig := <-quit:
+		grace = settings.Current().Server.DrainGracePeriod
+		log.Info("shutting down server gracefully", "signal", sig.String())
+	case grace = <-drainer.requested:
+		log.Info("shutting down server gracefully", "reason", "admin drain")
+	}
+
+	// Give open streams the grace period to reconnect elsewhere; new unary
+	// calls are still served meanwhile
+	drainer.drain(grace)
+
+	// Then close whatever is left. GracefulStop would wait for those
+	// streams forever (and cannot drain gRPC-Web transports), so stop hard.
+	srv.Stop()
+	audit.close(cfg.Server.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
-	
+
 	if err := httpServer.Shutdown(ctx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
+		log.Error("HTTP server shutdown failed", "error", err)
+	}
+
+	log.Info("server exited gracefully")
+}
+
+// runCommand runs a maintenance command instead of serving.
+func runCommand(cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrateCommand(cfg.Database, args[1:])
+	case "check-prisma":
+		return runPrismaCheck(args[1:])
+	case "purge":
+		return runPurgeCommand(cfg.Database)
+	case "audit-verify":
+		return runAuditVerifyCommand(cfg)
+	case "outbox":
+		return runOutboxCommand(cfg.Database, args[1:])
+	case "redact-archives":
+		return runRedactArchivesCommand(cfg.Database.Retention, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q (available: migrate up|down|status|create, check-prisma [schema], purge, audit-verify, outbox dead|replay, redact-archives <user id>)", args[0])
+	}
+}
+
+// serveDebug - Serves /debug/vars on addr, which should not be reachable
+// from outside the host
+func serveDebug(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	log.Info("debug endpoint listening", "addr", addr, "path", "/debug/vars")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Error("debug endpoint failed", "addr", addr, "error", err)
 	}
-	
-	// Also stop gRPC server gracefully
-	srv.GracefulStop()
-	
-	log.Println("✅ Server exited gracefully")
 }
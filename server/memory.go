@@ -0,0 +1,539 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryRepository keeps everything in maps guarded by one mutex.
+type memoryRepository struct {
+	mu        sync.Mutex
+	users     map[string]*User // by name
+	greetings []Greeting
+	quotas    map[quotaKey]int64
+	erasures  []UserErasure
+	audit     []AuditEvent
+	outbox    []OutboxMessage
+	rollups   []GreetingRollup
+	batches   []BatchRollup
+	through   *time.Time // rollup watermark
+}
+
+type quotaKey struct {
+	subject, bucket string
+	day             time.Time
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		users:  make(map[string]*User),
+		quotas: make(map[quotaKey]int64),
+	}
+}
+
+func (m *memoryRepository) GetOrCreateUser(ctx context.Context, name string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[name]
+	if !ok {
+		now := time.Now().UTC()
+		user = &User{ID: uuid.NewString(), Name: name, CreatedAt: now, UpdatedAt: now}
+		m.users[name] = user
+	}
+	// Copy so callers cannot modify the stored user
+	u := *user
+	return &u, nil
+}
+
+func (m *memoryRepository) GetOrCreateUsers(ctx context.Context, names []string) (map[string]*User, error) {
+	users := make(map[string]*User, len(names))
+	for _, name := range names {
+		if _, ok := users[name]; ok {
+			continue
+		}
+		user, err := m.GetOrCreateUser(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		users[name] = user
+	}
+	return users, nil
+}
+
+func (m *memoryRepository) FindUser(ctx context.Context, name string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[name]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+func (m *memoryRepository) CreateGreetings(ctx context.Context, greetings []Greeting, notify []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	for i := range greetings {
+		if greetings[i].ID == "" {
+			greetings[i].ID = uuid.NewString()
+		}
+		if greetings[i].CreatedAt.IsZero() {
+			greetings[i].CreatedAt = now
+		}
+		g := greetings[i]
+		g.User = nil
+		m.greetings = append(m.greetings, g)
+	}
+	outbox, err := greetingEvents(greetings, notify)
+	if err != nil {
+		return err
+	}
+	m.outbox = append(m.outbox, outbox...)
+	return nil
+}
+
+func (m *memoryRepository) ExpiredGreetings(ctx context.Context, cutoff time.Time, limit int) ([]Greeting, error) {
+	return m.oldestGreetings(ctx, limit, func(g Greeting) bool { return g.CreatedAt.Before(cutoff) })
+}
+
+func (m *memoryRepository) GreetingCutoffs(ctx context.Context, keep int) ([]GreetingCutoff, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Newest first, so the greeting after the first keep of a user is its cutoff
+	sorted := slices.Clone(m.greetings)
+	slices.SortFunc(sorted, func(a, b Greeting) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	seen := make(map[string]int)
+	var cutoffs []GreetingCutoff
+	for _, g := range sorted {
+		var user string
+		if g.UserID != nil {
+			user = *g.UserID
+		}
+		if seen[user]++; seen[user] == keep+1 {
+			cutoffs = append(cutoffs, GreetingCutoff{ID: g.ID, UserID: g.UserID, CreatedAt: g.CreatedAt})
+		}
+	}
+	return cutoffs, nil
+}
+
+func (m *memoryRepository) GreetingsUpTo(ctx context.Context, cut GreetingCutoff, limit int) ([]Greeting, error) {
+	return m.oldestGreetings(ctx, limit, func(g Greeting) bool {
+		if (g.UserID == nil) != (cut.UserID == nil) || (g.UserID != nil && *g.UserID != *cut.UserID) {
+			return false
+		}
+		return cmp.Or(g.CreatedAt.Compare(cut.CreatedAt), cmp.Compare(g.ID, cut.ID)) <= 0
+	})
+}
+
+// oldestGreetings returns up to limit of the oldest greetings matching match.
+func (m *memoryRepository) oldestGreetings(ctx context.Context, limit int, match func(Greeting) bool) ([]Greeting, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found []Greeting
+	for _, g := range m.greetings {
+		if match(g) {
+			found = append(found, g)
+		}
+	}
+	slices.SortFunc(found, func(a, b Greeting) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return found[:min(limit, len(found))], nil
+}
+
+func (m *memoryRepository) DeleteGreetings(ctx context.Context, ids []string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doomed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		doomed[id] = true
+	}
+	before := len(m.greetings)
+	m.greetings = slices.DeleteFunc(m.greetings, func(g Greeting) bool { return doomed[g.ID] })
+	return int64(before - len(m.greetings)), nil
+}
+
+func (m *memoryRepository) UserGreetings(ctx context.Context, userID string, batch int, fn func([]Greeting) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	var greetings []Greeting
+	for _, g := range m.greetings {
+		if g.UserID != nil && *g.UserID == userID {
+			greetings = append(greetings, g)
+		}
+	}
+	m.mu.Unlock()
+	slices.SortFunc(greetings, func(a, b Greeting) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	for page := range slices.Chunk(greetings, batch) {
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) EraseUser(ctx context.Context, name, erasedBy, reason string) (*UserErasure, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[name]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	// Redact first, so that nothing changes if a payload cannot be read
+	redacted := make(map[int]string)
+	for i, msg := range m.outbox {
+		if msg.EventType == greetingsCreated && strings.Contains(msg.Payload, eventUserMarker(user.ID)) {
+			payload, err := redactGreetingEvent(msg.Payload, user.ID)
+			if err != nil {
+				return nil, fmt.Errorf("outbox message %s: %w", msg.ID, err)
+			}
+			redacted[i] = payload
+		}
+	}
+	outbox := m.outbox[:0]
+	for i, msg := range m.outbox {
+		if payload, ok := redacted[i]; ok {
+			if payload == "" {
+				continue
+			}
+			msg.Payload = payload
+		}
+		outbox = append(outbox, msg)
+	}
+	m.outbox = outbox
+
+	before := len(m.greetings)
+	m.greetings = slices.DeleteFunc(m.greetings, func(g Greeting) bool { return g.UserID != nil && *g.UserID == user.ID })
+	delete(m.users, name)
+	erasure := newUserErasure(user, int64(before-len(m.greetings)), erasedBy, reason)
+	m.erasures = append(m.erasures, *erasure)
+	return erasure, nil
+}
+
+func (m *memoryRepository) AppendAuditEvents(ctx context.Context, key []byte, events []AuditEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var head AuditEvent
+	if len(m.audit) > 0 {
+		head = m.audit[len(m.audit)-1]
+	}
+	chainAuditEvents(key, &head, events)
+	m.audit = append(m.audit, events...)
+	return nil
+}
+
+func (m *memoryRepository) AuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []AuditEvent
+	for _, e := range m.audit {
+		if len(events) == filter.Limit {
+			break
+		}
+		if filter.matches(&e) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *memoryRepository) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	var due []int
+	for i, msg := range m.outbox {
+		if msg.Status == outboxPending && !msg.NextAttemptAt.After(now) {
+			due = append(due, i)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b int) int {
+		return cmp.Or(m.outbox[a].NextAttemptAt.Compare(m.outbox[b].NextAttemptAt), m.outbox[a].CreatedAt.Compare(m.outbox[b].CreatedAt))
+	})
+	var claimed []OutboxMessage
+	for _, i := range due[:min(limit, len(due))] {
+		claimed = append(claimed, m.outbox[i])
+		m.outbox[i].NextAttemptAt = now.Add(lease)
+	}
+	return claimed, nil
+}
+
+func (m *memoryRepository) SaveOutbox(ctx context.Context, msg *OutboxMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.outbox {
+		if m.outbox[i].ID == msg.ID {
+			m.outbox[i] = *msg
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) OutboxMessages(ctx context.Context, status, endpoint string, limit int) ([]OutboxMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var msgs []OutboxMessage
+	for _, msg := range m.outbox {
+		if len(msgs) == limit {
+			break
+		}
+		if msg.Status == status && (endpoint == "" || msg.Endpoint == endpoint) {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+func (m *memoryRepository) ReplayOutbox(ctx context.Context, endpoint string, ids []string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	var n int64
+	for i := range m.outbox {
+		msg := &m.outbox[i]
+		if msg.Status != outboxDead || (endpoint != "" && msg.Endpoint != endpoint) ||
+			(len(ids) > 0 && !slices.Contains(ids, msg.ID)) {
+			continue
+		}
+		msg.Status, msg.Attempts, msg.NextAttemptAt = outboxPending, 0, now
+		n++
+	}
+	return n, nil
+}
+
+func (m *memoryRepository) DeleteDeliveredOutbox(ctx context.Context, cutoff time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.outbox)
+	m.outbox = slices.DeleteFunc(m.outbox, func(msg OutboxMessage) bool {
+		return msg.Status == outboxDelivered && msg.DeliveredAt.Before(cutoff)
+	})
+	return int64(before - len(m.outbox)), nil
+}
+
+func (m *memoryRepository) GreetingsBetween(ctx context.Context, from, to time.Time, batch int, fn func([]Greeting) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	var greetings []Greeting
+	for _, g := range m.greetings {
+		if !g.CreatedAt.Before(from) && g.CreatedAt.Before(to) {
+			greetings = append(greetings, g)
+		}
+	}
+	m.mu.Unlock()
+	slices.SortFunc(greetings, func(a, b Greeting) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	for page := range slices.Chunk(greetings, batch) {
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) ApplyRollups(ctx context.Context, from, to time.Time, minutes []GreetingRollup, batches []BatchRollup) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	within := func(bucket, start, end time.Time) bool {
+		return !bucket.Before(start) && bucket.Before(end)
+	}
+	m.rollups = slices.DeleteFunc(m.rollups, func(r GreetingRollup) bool {
+		return r.Unit == rollupMinute && within(r.Bucket, from, to)
+	})
+	m.batches = slices.DeleteFunc(m.batches, func(b BatchRollup) bool {
+		return b.Unit == rollupMinute && within(b.Bucket, from, to)
+	})
+	m.rollups = append(m.rollups, minutes...)
+	m.batches = append(m.batches, batches...)
+	for _, u := range rollupUnits[1:] {
+		for bucket := range u.buckets(from, to) {
+			end := bucket.Add(u.size)
+			m.rollups = slices.DeleteFunc(m.rollups, func(r GreetingRollup) bool { return r.Unit == u.name && r.Bucket.Equal(bucket) })
+			m.batches = slices.DeleteFunc(m.batches, func(b BatchRollup) bool { return b.Unit == u.name && b.Bucket.Equal(bucket) })
+			users := make(map[string]int64)
+			classes := make(map[int]BatchRollup)
+			for _, r := range m.rollups {
+				if r.Unit == u.finer && within(r.Bucket, bucket, end) {
+					users[r.UserID] += r.Greetings
+				}
+			}
+			for _, b := range m.batches {
+				if b.Unit == u.finer && within(b.Bucket, bucket, end) {
+					c := classes[b.SizeClass]
+					c.Batches += b.Batches
+					c.Greetings += b.Greetings
+					c.MaxSize = max(c.MaxSize, b.MaxSize)
+					classes[b.SizeClass] = c
+				}
+			}
+			for userID, n := range users {
+				m.rollups = append(m.rollups, GreetingRollup{Unit: u.name, Bucket: bucket, UserID: userID, Greetings: n})
+			}
+			for class, c := range classes {
+				c.Unit, c.Bucket, c.SizeClass = u.name, bucket, class
+				m.batches = append(m.batches, c)
+			}
+		}
+	}
+	m.through = &to
+	return nil
+}
+
+func (m *memoryRepository) RollupWatermark(ctx context.Context) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.through != nil {
+		return *m.through, nil
+	}
+	oldest := time.Now().UTC()
+	for _, g := range m.greetings {
+		if g.CreatedAt.Before(oldest) {
+			oldest = g.CreatedAt
+		}
+	}
+	return oldest, nil
+}
+
+func (m *memoryRepository) GreetingStats(ctx context.Context, query StatsQuery) (*GreetingStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := &GreetingStats{}
+	if m.through != nil {
+		stats.Through = *m.through
+	}
+	selected := func(unit string, bucket time.Time) bool {
+		return unit == query.Unit && !bucket.Before(query.From) && bucket.Before(query.To)
+	}
+	buckets := make(map[time.Time]int64)
+	users := make(map[string]int64)
+	for _, r := range m.rollups {
+		if selected(r.Unit, r.Bucket) && (query.UserID == "" || r.UserID == query.UserID) {
+			buckets[r.Bucket] += r.Greetings
+			users[r.UserID] += r.Greetings
+		}
+	}
+	for bucket, n := range buckets {
+		stats.Buckets = append(stats.Buckets, BucketCount{Bucket: bucket, Greetings: n})
+	}
+	slices.SortFunc(stats.Buckets, func(a, b BucketCount) int { return a.Bucket.Compare(b.Bucket) })
+
+	names := make(map[string]string, len(m.users))
+	for _, u := range m.users {
+		names[u.ID] = u.Name
+	}
+	for userID, n := range users {
+		stats.TopUsers = append(stats.TopUsers, UserCount{UserID: userID, Name: names[userID], Greetings: n})
+	}
+	slices.SortFunc(stats.TopUsers, func(a, b UserCount) int {
+		return cmp.Or(cmp.Compare(b.Greetings, a.Greetings), cmp.Compare(a.UserID, b.UserID))
+	})
+	stats.TopUsers = stats.TopUsers[:min(query.TopUsers, len(stats.TopUsers))]
+
+	classes := make(map[int]BatchRollup)
+	for _, b := range m.batches {
+		if selected(b.Unit, b.Bucket) {
+			c := classes[b.SizeClass]
+			c.SizeClass = b.SizeClass
+			c.Batches += b.Batches
+			c.Greetings += b.Greetings
+			c.MaxSize = max(c.MaxSize, b.MaxSize)
+			classes[b.SizeClass] = c
+		}
+	}
+	for _, c := range classes {
+		stats.Batches = append(stats.Batches, c)
+	}
+	slices.SortFunc(stats.Batches, func(a, b BatchRollup) int { return cmp.Compare(a.SizeClass, b.SizeClass) })
+	return stats, nil
+}
+
+func (m *memoryRepository) ConsumeQuota(ctx context.Context, subject, bucket string, day time.Time, n, limit int64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := quotaKey{subject, bucket, day}
+	if m.quotas[key]+n > limit {
+		return false, nil
+	}
+	m.quotas[key] += n
+	return true, nil
+}
+
+func (m *memoryRepository) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (m *memoryRepository) Close() error {
+	return nil
+}
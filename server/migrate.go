@@ -1,49 +1,453 @@
-// +build ignore
-
 package main
 
 import (
+	"cmp"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
 	"fmt"
-	"log"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	"grpc-example/config"
+	"grpc-example/logging"
 )
 
-// Run migrations standalone
-func main() {
-	// Load DATABASE_URL from environment
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL environment variable is not set. Please create .env file first.")
+var migrateLog = logging.For("migrate")
+
+// migrationFiles holds the schema history, one directory per dialect with
+// NNNN_name.up.sql and NNNN_name.down.sql pairs.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationFile matches a migration file name.
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// migrationLockID is the Postgres advisory lock held while migrating, so
+// concurrent runners (several server replicas starting at once) apply each
+// migration exactly once.
+const migrationLockID int64 = 0x67727063_6d696772 // "grpcmigr"
+
+// schemaMigrationsDDL creates the table recording applied migrations.
+var schemaMigrationsDDL = map[string]string{
+	"postgres": `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    bigint PRIMARY KEY,
+		name       text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`,
+	"sqlite": `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    integer PRIMARY KEY,
+		name       text NOT NULL,
+		applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+}
+
+type migration struct {
+	version  int64
+	name     string
+	up, down string
+}
+
+// appliedMigration is a row of schema_migrations.
+type appliedMigration struct {
+	version   int64
+	name      string
+	appliedAt time.Time
+}
+
+// loadMigrations reads the embedded migrations of a dialect, in order.
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := "migrations/" + dialect
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %q", dialect)
+	}
+	byVersion := make(map[int64]*migration)
+	for _, e := range entries {
+		match := migrationFile.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%s/%s: not a NNNN_name.up.sql or NNNN_name.down.sql file", dir, e.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := fs.ReadFile(migrationFiles, dir+"/"+e.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: match[2]}
+			byVersion[version] = m
+		} else if m.name != match[2] {
+			return nil, fmt.Errorf("%s: version %d is used by both %s and %s", dir, version, m.name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	out := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("%s: migration %04d_%s needs both an up and a down file", dir, m.version, m.name)
+		}
+		out = append(out, *m)
+	}
+	slices.SortFunc(out, func(a, b migration) int { return cmp.Compare(a.version, b.version) })
+	return out, nil
+}
+
+// migrator applies and reverts the embedded migrations of one dialect.
+type migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []migration
+}
+
+func newMigrator(db *sql.DB, dialect string) (*migrator, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// latest is the version the embedded migrations lead to.
+func (m *migrator) latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].version
+}
+
+// locked runs fn on a connection holding the migration lock, after making
+// sure schema_migrations exists. SQLite needs no lock: it has a single
+// writer and every migration re-checks its version inside its transaction.
+// SQLite foreign keys are off meanwhile, so migrations can rebuild tables
+// (the only way to change a column's type) without cascading deletes;
+// apply checks the keys before committing instead.
+func (m *migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch m.dialect {
+	case "postgres":
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+			return fmt.Errorf("could not take the migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLockID)
+	case "sqlite":
+		var foreignKeys bool
+		if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+			return err
+		}
+		if foreignKeys {
+			if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+				return err
+			}
+			defer conn.ExecContext(context.WithoutCancel(ctx), "PRAGMA foreign_keys = ON")
+		}
+	}
+	if _, err := conn.ExecContext(ctx, schemaMigrationsDDL[m.dialect]); err != nil {
+		return fmt.Errorf("could not create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// applied lists the recorded migrations, oldest first.
+func (m *migrator) applied(ctx context.Context, conn *sql.Conn) ([]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []appliedMigration
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.version, &a.name, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// unknown returns the applied versions this build has no migration for,
+// which means the database was migrated by a newer build.
+func (m *migrator) unknown(applied []appliedMigration) []int64 {
+	var out []int64
+	for _, a := range applied {
+		if !slices.ContainsFunc(m.migrations, func(mg migration) bool { return mg.version == a.version }) {
+			out = append(out, a.version)
+		}
+	}
+	return out
+}
+
+// pending returns the embedded migrations that have not been applied.
+func (m *migrator) pending(applied []appliedMigration) []migration {
+	var out []migration
+	for _, mg := range m.migrations {
+		if !slices.ContainsFunc(applied, func(a appliedMigration) bool { return a.version == mg.version }) {
+			out = append(out, mg)
+		}
 	}
+	return out
+}
+
+// up applies up to n pending migrations (all of them if n <= 0) and
+// returns how many it applied.
+func (m *migrator) up(ctx context.Context, n int) (int, error) {
+	done := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if unknown := m.unknown(applied); len(unknown) > 0 {
+			return fmt.Errorf("database has migrations %v this build does not know, refusing to migrate", unknown)
+		}
+		for _, mg := range m.pending(applied) {
+			if n > 0 && done == n {
+				break
+			}
+			if err := m.apply(ctx, conn, mg, true); err != nil {
+				return err
+			}
+			done++
+		}
+		return nil
+	})
+	return done, err
+}
+
+// down reverts the last n applied migrations (at least one).
+func (m *migrator) down(ctx context.Context, n int) (int, error) {
+	n = max(n, 1)
+	done := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(applied) - 1; i >= 0 && done < n; i-- {
+			idx := slices.IndexFunc(m.migrations, func(mg migration) bool { return mg.version == applied[i].version })
+			if idx < 0 {
+				return fmt.Errorf("migration %d was applied by a newer build, its down file is not available", applied[i].version)
+			}
+			if err := m.apply(ctx, conn, m.migrations[idx], false); err != nil {
+				return err
+			}
+			done++
+		}
+		return nil
+	})
+	return done, err
+}
+
+// apply runs one migration in a transaction together with its
+// schema_migrations bookkeeping.
+func (m *migrator) apply(ctx context.Context, conn *sql.Conn, mg migration, up bool) error {
+	direction, body := "up", mg.up
+	if !up {
+		direction, body = "down", mg.down
+	}
+	start := time.Now()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", mg.version).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == up {
+		// Another runner got here first
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return fmt.Errorf("migration %04d_%s (%s) failed: %w", mg.version, mg.name, direction, err)
+	}
+	if m.dialect == "sqlite" {
+		rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+		if err != nil {
+			return err
+		}
+		broken := rows.Next()
+		rows.Close()
+		if broken {
+			return fmt.Errorf("migration %04d_%s (%s) left rows with broken foreign keys", mg.version, mg.name, direction)
+		}
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", mg.version, mg.name)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", mg.version)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	migrateLog.Info("migration "+direction, "version", mg.version, "name", mg.name, "duration", time.Since(start))
+	return nil
+}
+
+// check returns an error unless the database is at exactly the version
+// this build expects.
+func (m *migrator) check(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if unknown := m.unknown(applied); len(unknown) > 0 {
+			return fmt.Errorf("database schema has migrations %v this build does not know; deploy a newer build or run \"migrate down\" with one", unknown)
+		}
+		if pending := m.pending(applied); len(pending) > 0 {
+			return fmt.Errorf("database schema is missing %d migration(s) up to version %d; run \"go run ./server migrate up\" (or set database.auto_migrate)", len(pending), m.latest())
+		}
+		return nil
+	})
+}
 
-	fmt.Println("📊 Connecting to database...")
-	
-	// Connect to database
-	db, err := gorm.Open(postgres.Open(dbURL), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+// status prints every migration and whether it has been applied.
+func (m *migrator) status(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, mg := range m.migrations {
+			state := "pending"
+			if i := slices.IndexFunc(applied, func(a appliedMigration) bool { return a.version == mg.version }); i >= 0 {
+				state = applied[i].appliedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", mg.version, mg.name, state)
+		}
+		for _, a := range applied {
+			if slices.Contains(m.unknown(applied), a.version) {
+				fmt.Fprintf(w, "%04d\t%s\t%s (unknown to this build)\n", a.version, a.name, a.appliedAt.Local().Format(time.DateTime))
+			}
+		}
+		return w.Flush()
 	})
+}
+
+// createMigration writes empty up and down files for the next version in
+// every dialect directory of the source tree.
+func createMigration(name string) error {
+	if !regexp.MustCompile(`^[a-z0-9_]+$`).MatchString(name) {
+		return fmt.Errorf("migration name must be snake_case, got %q", name)
+	}
+	root := filepath.Join("server", "migrations")
+	if _, err := os.Stat(root); err != nil {
+		root = "migrations" // run from server/
+	}
+	dialects, err := os.ReadDir(root)
 	if err != nil {
-		log.Fatalf("❌ Failed to connect to database: %v", err)
+		return fmt.Errorf("migrations directory not found, run from the repository root: %w", err)
 	}
 
-	fmt.Println("✅ Connected to database")
-	fmt.Println("🔄 Running migrations...")
-	
-	// Run migrations
-	if err := db.AutoMigrate(&User{}, &Greeting{}); err != nil {
-		log.Fatalf("❌ Migration failed: %v", err)
+	var next int64 = 1
+	for _, d := range dialects {
+		files, _ := os.ReadDir(filepath.Join(root, d.Name()))
+		for _, f := range files {
+			if match := migrationFile.FindStringSubmatch(f.Name()); match != nil {
+				v, _ := strconv.ParseInt(match[1], 10, 64)
+				next = max(next, v+1)
+			}
+		}
 	}
 
-	fmt.Println("✅ Migrations completed successfully!")
-	fmt.Println("")
-	fmt.Println("Created/Updated tables:")
-	fmt.Println("  ✓ users")
-	fmt.Println("  ✓ greetings")
-	fmt.Println("")
-	fmt.Println("🎉 Database is ready!")
+	for _, d := range dialects {
+		if !d.IsDir() {
+			continue
+		}
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(root, d.Name(), fmt.Sprintf("%04d_%s.%s.sql", next, name, direction))
+			header := fmt.Sprintf("-- %04d_%s (%s, %s)\n", next, name, d.Name(), direction)
+			if err := os.WriteFile(path, []byte(header), 0o644); err != nil {
+				return err
+			}
+			fmt.Println("created", path)
+		}
+	}
+	return nil
 }
 
+// runMigrateCommand - Handles "migrate up [n]", "migrate down [n]",
+// "migrate status" and "migrate create <name>"
+func runMigrateCommand(cfg config.DatabaseConfig, args []string) error {
+	const usage = "usage: migrate up [n] | down [n] | status | create <name>"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New("usage: migrate create <name>")
+		}
+		return createMigration(args[1])
+	}
+
+	n := 0
+	if len(args) > 1 {
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+			return fmt.Errorf("migrate %s: step count must be a positive number, got %q", args[0], args[1])
+		}
+	}
+	if strings.HasPrefix(cfg.URL, memoryURL) {
+		return fmt.Errorf("%s has no schema to migrate", memoryURL)
+	}
+	db, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	sqlDB, _ := db.DB()
+	defer sqlDB.Close()
+	m, err := newMigrator(sqlDB, db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		done, err := m.up(ctx, n)
+		if err != nil {
+			return err
+		}
+		migrateLog.Info("migrations applied", "applied", done)
+	case "down":
+		done, err := m.down(ctx, n)
+		if err != nil {
+			return err
+		}
+		migrateLog.Info("migrations reverted", "reverted", done)
+	case "status":
+		return m.status(ctx)
+	default:
+		return errors.New(usage)
+	}
+	return nil
+}
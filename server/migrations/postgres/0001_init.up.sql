@@ -0,0 +1,28 @@
+-- Tables as GORM's AutoMigrate created them, so databases set up before
+-- versioned migrations are adopted as they are.
+CREATE TABLE IF NOT EXISTS users (
+    id         uuid PRIMARY KEY,
+    name       text NOT NULL,
+    email      text,
+    created_at bigint,
+    updated_at bigint
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users (name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS greetings (
+    id         uuid PRIMARY KEY,
+    message    text NOT NULL,
+    user_id    uuid CONSTRAINT fk_users_greetings REFERENCES users (id) ON DELETE CASCADE,
+    created_at bigint
+);
+CREATE INDEX IF NOT EXISTS idx_greetings_user_id ON greetings (user_id);
+CREATE INDEX IF NOT EXISTS idx_greetings_created_at ON greetings (created_at);
+
+CREATE TABLE IF NOT EXISTS quota_usage (
+    subject text NOT NULL,
+    bucket  text NOT NULL,
+    day     date NOT NULL,
+    used    bigint NOT NULL,
+    PRIMARY KEY (subject, bucket, day)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_greetings_user_created;
+DROP INDEX IF EXISTS idx_users_name_lookup;
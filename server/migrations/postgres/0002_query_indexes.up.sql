@@ -0,0 +1,7 @@
+-- Name lookups and each user's greetings, newest first
+CREATE INDEX IF NOT EXISTS idx_users_name_lookup ON users (name) WHERE name IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_greetings_user_created ON greetings (user_id, created_at DESC);
+
+-- Refresh planner statistics for the new indexes
+ANALYZE users;
+ANALYZE greetings;
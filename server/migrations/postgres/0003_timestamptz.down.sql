@@ -0,0 +1,13 @@
+ALTER TABLE greetings
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE greetings
+    ALTER COLUMN created_at TYPE bigint USING extract(epoch FROM created_at)::bigint;
+
+ALTER TABLE users
+    ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at DROP NOT NULL,
+    ALTER COLUMN updated_at DROP NOT NULL;
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE bigint USING extract(epoch FROM created_at)::bigint,
+    ALTER COLUMN updated_at TYPE bigint USING extract(epoch FROM updated_at)::bigint;
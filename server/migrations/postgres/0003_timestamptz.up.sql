@@ -0,0 +1,15 @@
+-- Epoch seconds become timestamptz, the type prisma/schema.prisma declares.
+-- Values are preserved; rows that never had a timestamp get the current time.
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE timestamptz USING coalesce(to_timestamp(created_at), now()),
+    ALTER COLUMN updated_at TYPE timestamptz USING coalesce(to_timestamp(updated_at), now());
+ALTER TABLE users
+    ALTER COLUMN created_at SET DEFAULT now(),
+    ALTER COLUMN created_at SET NOT NULL,
+    ALTER COLUMN updated_at SET NOT NULL;
+
+ALTER TABLE greetings
+    ALTER COLUMN created_at TYPE timestamptz USING coalesce(to_timestamp(created_at), now());
+ALTER TABLE greetings
+    ALTER COLUMN created_at SET DEFAULT now(),
+    ALTER COLUMN created_at SET NOT NULL;
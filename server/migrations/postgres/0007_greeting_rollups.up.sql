@@ -0,0 +1,29 @@
+-- Greeting counts per minute, hour and day and user, for
+-- Admin.GetGreetingStats. Maintained by the server's rollup job: minutes from
+-- greetings, hours from minutes, days from hours. Greetings without a user
+-- count under the nil UUID.
+CREATE TABLE greeting_rollups (
+    unit      text NOT NULL,
+    bucket    timestamptz NOT NULL,
+    user_id   uuid NOT NULL,
+    greetings bigint NOT NULL,
+    PRIMARY KEY (unit, bucket, user_id)
+);
+
+-- Client-stream batches per bucket, by size class: class c holds the
+-- batches of 2^c to 2^(c+1)-1 greetings.
+CREATE TABLE greeting_batch_rollups (
+    unit       text NOT NULL,
+    bucket     timestamptz NOT NULL,
+    size_class integer NOT NULL,
+    batches    bigint NOT NULL,
+    greetings  bigint NOT NULL,
+    max_size   bigint NOT NULL,
+    PRIMARY KEY (unit, bucket, size_class)
+);
+
+-- How far the rollups have aggregated greetings.
+CREATE TABLE rollup_watermarks (
+    name    text PRIMARY KEY,
+    through timestamptz NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE greetings DROP COLUMN batch_id;
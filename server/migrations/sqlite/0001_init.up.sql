@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS users (
+    id         text PRIMARY KEY,
+    name       text NOT NULL,
+    email      text,
+    created_at integer,
+    updated_at integer
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users (name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS greetings (
+    id         text PRIMARY KEY,
+    message    text NOT NULL,
+    user_id    text REFERENCES users (id) ON DELETE CASCADE,
+    created_at integer
+);
+CREATE INDEX IF NOT EXISTS idx_greetings_user_id ON greetings (user_id);
+CREATE INDEX IF NOT EXISTS idx_greetings_created_at ON greetings (created_at);
+
+CREATE TABLE IF NOT EXISTS quota_usage (
+    subject text NOT NULL,
+    bucket  text NOT NULL,
+    day     date NOT NULL,
+    used    integer NOT NULL,
+    PRIMARY KEY (subject, bucket, day)
+);
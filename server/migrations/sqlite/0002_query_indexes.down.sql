@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_greetings_user_created;
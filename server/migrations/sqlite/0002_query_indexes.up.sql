@@ -0,0 +1,4 @@
+-- Each user's greetings, newest first (users.name already has a unique index)
+CREATE INDEX IF NOT EXISTS idx_greetings_user_created ON greetings (user_id, created_at DESC);
+
+ANALYZE;
@@ -0,0 +1,29 @@
+CREATE TABLE users_old (
+    id         text PRIMARY KEY,
+    name       text NOT NULL,
+    email      text,
+    created_at integer,
+    updated_at integer
+);
+INSERT INTO users_old (id, name, email, created_at, updated_at)
+SELECT id, name, email, CAST(strftime('%s', created_at) AS integer), CAST(strftime('%s', updated_at) AS integer)
+FROM users;
+DROP TABLE users;
+ALTER TABLE users_old RENAME TO users;
+CREATE UNIQUE INDEX idx_users_name ON users (name);
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+
+CREATE TABLE greetings_old (
+    id         text PRIMARY KEY,
+    message    text NOT NULL,
+    user_id    text REFERENCES users (id) ON DELETE CASCADE,
+    created_at integer
+);
+INSERT INTO greetings_old (id, message, user_id, created_at)
+SELECT id, message, user_id, CAST(strftime('%s', created_at) AS integer)
+FROM greetings;
+DROP TABLE greetings;
+ALTER TABLE greetings_old RENAME TO greetings;
+CREATE INDEX idx_greetings_user_id ON greetings (user_id);
+CREATE INDEX idx_greetings_created_at ON greetings (created_at);
+CREATE INDEX idx_greetings_user_created ON greetings (user_id, created_at DESC);
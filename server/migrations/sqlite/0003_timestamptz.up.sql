@@ -0,0 +1,35 @@
+-- Epoch seconds become timestamps. SQLite cannot change a column's type, so
+-- both tables are rebuilt (the migrator turns foreign keys off meanwhile).
+-- Values keep the "2006-01-02 15:04:05+00:00" form the driver writes.
+CREATE TABLE users_new (
+    id         text PRIMARY KEY,
+    name       text NOT NULL,
+    email      text,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NOT NULL
+);
+INSERT INTO users_new (id, name, email, created_at, updated_at)
+SELECT id, name, email,
+       coalesce(strftime('%Y-%m-%d %H:%M:%S+00:00', created_at, 'unixepoch'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+       coalesce(strftime('%Y-%m-%d %H:%M:%S+00:00', updated_at, 'unixepoch'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'))
+FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+CREATE UNIQUE INDEX idx_users_name ON users (name);
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+
+CREATE TABLE greetings_new (
+    id         text PRIMARY KEY,
+    message    text NOT NULL,
+    user_id    text REFERENCES users (id) ON DELETE CASCADE,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO greetings_new (id, message, user_id, created_at)
+SELECT id, message, user_id,
+       coalesce(strftime('%Y-%m-%d %H:%M:%S+00:00', created_at, 'unixepoch'), strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'))
+FROM greetings;
+DROP TABLE greetings;
+ALTER TABLE greetings_new RENAME TO greetings;
+CREATE INDEX idx_greetings_user_id ON greetings (user_id);
+CREATE INDEX idx_greetings_created_at ON greetings (created_at);
+CREATE INDEX idx_greetings_user_created ON greetings (user_id, created_at DESC);
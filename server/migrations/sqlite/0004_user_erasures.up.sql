@@ -0,0 +1,12 @@
+-- Tombstones of users erased by Admin.EraseUser. The name itself is gone;
+-- its SHA-256 lets a later request be checked against the erasure.
+CREATE TABLE user_erasures (
+    id                text PRIMARY KEY,
+    user_id           text NOT NULL,
+    name_sha256       text NOT NULL,
+    greetings_deleted bigint NOT NULL,
+    erased_by         text NOT NULL,
+    reason            text NOT NULL,
+    erased_at         timestamp NOT NULL
+);
+CREATE INDEX idx_user_erasures_name_sha256 ON user_erasures (name_sha256);
@@ -0,0 +1,17 @@
+-- Audit log of RPC calls. Each row carries the SHA-256 of its contents and
+-- of the previous row's hash, so deleting or editing rows breaks the chain.
+CREATE TABLE audit_events (
+    seq         bigint PRIMARY KEY,
+    at          timestamp NOT NULL,
+    method      text NOT NULL,
+    caller      text NOT NULL,
+    peer        text NOT NULL,
+    code        text NOT NULL,
+    duration_ms bigint NOT NULL,
+    request_id  text NOT NULL,
+    detail      text NOT NULL,
+    prev_hash   text NOT NULL,
+    hash        text NOT NULL
+);
+CREATE INDEX idx_audit_events_at ON audit_events (at);
+CREATE INDEX idx_audit_events_caller ON audit_events (caller);
@@ -0,0 +1,17 @@
+-- Transactional outbox: events are written with the rows they describe and
+-- delivered to webhook endpoints by the server's dispatcher. One row per
+-- event and endpoint, so each endpoint retries on its own.
+CREATE TABLE outbox (
+    id              text PRIMARY KEY,
+    event_id        text NOT NULL,
+    endpoint        text NOT NULL,
+    event_type      text NOT NULL,
+    payload         text NOT NULL,
+    status          text NOT NULL,
+    attempts        integer NOT NULL,
+    next_attempt_at timestamp NOT NULL,
+    last_error      text NOT NULL,
+    created_at      timestamp NOT NULL,
+    delivered_at    timestamp
+);
+CREATE INDEX idx_outbox_status_next_attempt ON outbox (status, next_attempt_at);
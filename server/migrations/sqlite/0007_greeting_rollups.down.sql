@@ -0,0 +1,3 @@
+DROP TABLE rollup_watermarks;
+DROP TABLE greeting_batch_rollups;
+DROP TABLE greeting_rollups;
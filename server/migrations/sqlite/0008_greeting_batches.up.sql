@@ -0,0 +1,4 @@
+-- The client-stream batch a greeting was stored with, for the batch sizes of
+-- Admin.GetGreetingStats. Greetings stored before this migration have none
+-- and are not counted as batches.
+ALTER TABLE greetings ADD COLUMN batch_id text;
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"grpc-example/config"
+	"grpc-example/logging"
+
+	"github.com/google/uuid"
+)
+
+var webhookLog = logging.For("webhooks")
+
+// Statuses of outbox messages. Dead messages have used up their attempts
+// and wait for "outbox replay".
+const (
+	outboxPending   = "pending"
+	outboxDelivered = "delivered"
+	outboxDead      = "dead"
+)
+
+// greetingsCreated is the type of the events queued by CreateGreetings.
+const greetingsCreated = "greetings.created"
+
+// outboxEventGreetings is the most greetings one event carries; larger
+// batches are split so request bodies stay small.
+const outboxEventGreetings = 1000
+
+// outboxMinLease is the shortest time a pass holds the messages it claimed,
+// see dispatcher.lease.
+const outboxMinLease = time.Minute
+
+// outboxCleanupInterval is how often delivered messages past
+// server.webhooks.keep_delivered are deleted.
+const outboxCleanupInterval = time.Hour
+
+// Headers of webhook requests. The signature is "sha256=" and the hex
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed with the
+// endpoint's secret; receivers should also reject stale timestamps.
+const (
+	webhookIDHeader        = "X-Webhook-Id" // the event ID, to deduplicate redeliveries
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookTimestampHeader = "X-Webhook-Timestamp" // Unix seconds
+	webhookSignatureHeader = "X-Webhook-Signature"
+	webhookUserAgent       = "grpc-example-webhooks/1"
+)
+
+// greetingsCreatedEvent is the body POSTed for greetingsCreated.
+type greetingsCreatedEvent struct {
+	ID        string          `json:"id"` // the same for every endpoint
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Greetings []eventGreeting `json:"greetings"`
+}
+
+type eventGreeting struct {
+	ID        string    `json:"id"`
+	Message   string    `json:"message"`
+	UserID    *string   `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// greetingEvents builds the outbox messages announcing greetings, which
+// must have their IDs: one greetings.created event per outboxEventGreetings
+// greetings, queued once for each endpoint in notify.
+func greetingEvents(greetings []Greeting, notify []string) ([]OutboxMessage, error) {
+	if len(notify) == 0 {
+		return nil, nil
+	}
+	now := time.Now().UTC()
+	var msgs []OutboxMessage
+	for chunk := range slices.Chunk(greetings, outboxEventGreetings) {
+		event := greetingsCreatedEvent{ID: uuid.NewString(), Type: greetingsCreated, CreatedAt: now}
+		for _, g := range chunk {
+			event.Greetings = append(event.Greetings, eventGreeting{ID: g.ID, Message: g.Message, UserID: g.UserID, CreatedAt: g.CreatedAt})
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		for _, endpoint := range notify {
+			msgs = append(msgs, OutboxMessage{
+				ID:            uuid.NewString(),
+				EventID:       event.ID,
+				Endpoint:      endpoint,
+				EventType:     greetingsCreated,
+				Payload:       string(payload),
+				Status:        outboxPending,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+			})
+		}
+	}
+	return msgs, nil
+}
+
+// eventUserMarker is how userID appears in the payload of an event with
+// greetings of theirs, to find such events with LIKE.
+func eventUserMarker(userID string) string {
+	return `"userId":"` + userID + `"`
+}
+
+// redactGreetingEvent removes the greetings of userID from payload. It
+// returns "" when none are left, in which case the message should go.
+func redactGreetingEvent(payload, userID string) (string, error) {
+	var event greetingsCreatedEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return "", err
+	}
+	event.Greetings = slices.DeleteFunc(event.Greetings, func(g eventGreeting) bool {
+		return g.UserID != nil && *g.UserID == userID
+	})
+	if len(event.Greetings) == 0 {
+		return "", nil
+	}
+	redacted, err := json.Marshal(event)
+	return string(redacted), err
+}
+
+// signWebhook returns the X-Webhook-Signature of body sent at timestamp.
+func signWebhook(secret []byte, timestamp, body string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "." + body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// errUnknownEndpoint dead-letters the messages of endpoints that were
+// removed from the configuration; they can be replayed once it is back.
+var errUnknownEndpoint = errors.New("endpoint is not configured")
+
+// webhookEndpoint is a configured endpoint with its secret loaded.
+type webhookEndpoint struct {
+	url    string
+	secret []byte
+}
+
+// dispatcher implements server.webhooks: it POSTs due outbox messages to
+// their endpoints. Delivery is at least once, in no particular order.
+type dispatcher struct {
+	repo      Repository
+	cfg       config.WebhooksConfig
+	names     []string
+	endpoints map[string]webhookEndpoint
+	client    *http.Client
+
+	delivered, retries, deadLettered, failures atomic.Int64
+
+	mu        sync.Mutex
+	lastError string
+}
+
+// dispatcherStats is published as the "webhooks" expvar.
+type dispatcherStats struct {
+	Endpoints    []string `json:"endpoints"`
+	Delivered    int64    `json:"delivered"`
+	Retries      int64    `json:"retries"` // failed attempts that will be retried
+	DeadLettered int64    `json:"dead_lettered"`
+	Failures     int64    `json:"failures"` // passes over the outbox that failed
+	LastError    string   `json:"last_error,omitempty"`
+}
+
+// newDispatcher returns nil when no endpoints are configured. It fails
+// when the secret of an endpoint is missing from the environment.
+func newDispatcher(repo Repository, cfg config.WebhooksConfig) (*dispatcher, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, nil
+	}
+	d := &dispatcher{
+		repo:      repo,
+		cfg:       cfg,
+		endpoints: make(map[string]webhookEndpoint, len(cfg.Endpoints)),
+		client:    &http.Client{Timeout: cfg.Timeout},
+	}
+	for _, e := range cfg.Endpoints {
+		secret := os.Getenv(e.SecretEnv)
+		if secret == "" {
+			return nil, fmt.Errorf("webhook %s: environment variable %s is not set", e.Name, e.SecretEnv)
+		}
+		d.names = append(d.names, e.Name)
+		d.endpoints[e.Name] = webhookEndpoint{url: e.URL, secret: []byte(secret)}
+	}
+	return d, nil
+}
+
+// notify returns the endpoints to queue events for, none without webhooks.
+func (d *dispatcher) notify() []string {
+	if d == nil {
+		return nil
+	}
+	return d.names
+}
+
+// run - Delivers what is due every poll interval, straight away while full
+// batches keep coming, until ctx is done
+func (d *dispatcher) run(ctx context.Context) {
+	webhookLog.Info("webhooks enabled", "endpoints", d.names, "max_attempts", d.cfg.MaxAttempts)
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+	var cleaned time.Time
+	for {
+		more, err := d.deliverDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.failures.Add(1)
+			d.setLastError(err)
+			webhookLog.Error("outbox pass failed", "error", err)
+		}
+		if d.cfg.KeepDelivered > 0 && time.Since(cleaned) > outboxCleanupInterval {
+			cleaned = time.Now()
+			d.cleanUp(ctx)
+		}
+		if more && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lease is how long a pass holds the messages it claims. Replicas share the
+// outbox by claiming disjoint batches; one that dies mid-pass leaves its
+// messages to the others once the lease runs out.
+func (d *dispatcher) lease() time.Duration {
+	return max(outboxMinLease, 3*d.cfg.Timeout)
+}
+
+// deliverDue claims one batch of due messages and attempts them, holding
+// no lock or transaction while requests are in flight. Once an attempt
+// fails, the other messages of that endpoint are released for the next
+// pass rather than each taking up to the timeout; so are those that could
+// not be attempted before the lease would run out.
+func (d *dispatcher) deliverDue(ctx context.Context) (bool, error) {
+	claimed := time.Now()
+	msgs, err := d.repo.ClaimOutbox(ctx, d.cfg.BatchSize, d.lease())
+	if err != nil {
+		return false, err
+	}
+	failing := make(map[string]bool)
+	released := 0
+	for i := range msgs {
+		msg := &msgs[i]
+		if failing[msg.Endpoint] || time.Since(claimed) > d.lease()-d.cfg.Timeout {
+			if err := d.repo.SaveOutbox(ctx, msg); err != nil {
+				return false, err
+			}
+			released++
+			continue
+		}
+		err := d.deliver(ctx, msg)
+		if ctx.Err() != nil {
+			// Shutting down: the attempt does not count, and the claim
+			// runs out by itself
+			return false, ctx.Err()
+		}
+		d.record(msg, err)
+		if msg.Status == outboxPending {
+			failing[msg.Endpoint] = true
+		}
+		// A failure here means a redelivery later, hence at least once
+		if err := d.repo.SaveOutbox(ctx, msg); err != nil {
+			return false, err
+		}
+	}
+	return len(msgs) == d.cfg.BatchSize && released == 0, nil
+}
+
+// deliver POSTs msg to its endpoint; anything but a 2xx is a failure.
+func (d *dispatcher) deliver(ctx context.Context, msg *OutboxMessage) error {
+	ep, ok := d.endpoints[msg.Endpoint]
+	if !ok {
+		return errUnknownEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.url, strings.NewReader(msg.Payload))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", webhookUserAgent)
+	req.Header.Set(webhookIDHeader, msg.EventID)
+	req.Header.Set(webhookEventHeader, msg.EventType)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signWebhook(ep.secret, timestamp, msg.Payload))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Read some of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// record counts an attempt at msg that failed with err (unless it is nil)
+// and schedules the next one or dead-letters msg.
+func (d *dispatcher) record(msg *OutboxMessage, err error) {
+	now := time.Now().UTC()
+	msg.Attempts++
+	if err == nil {
+		msg.Status, msg.DeliveredAt = outboxDelivered, &now
+		d.delivered.Add(1)
+		return
+	}
+	msg.LastError = err.Error()
+	d.setLastError(fmt.Errorf("%s: %w", msg.Endpoint, err))
+	if errors.Is(err, errUnknownEndpoint) || msg.Attempts >= d.cfg.MaxAttempts {
+		msg.Status = outboxDead
+		d.deadLettered.Add(1)
+		webhookLog.Warn("webhook message dead-lettered", "endpoint", msg.Endpoint, "event_id", msg.EventID,
+			"message_id", msg.ID, "attempts", msg.Attempts, "error", err)
+		return
+	}
+	msg.NextAttemptAt = now.Add(d.backoff(msg.Attempts))
+	d.retries.Add(1)
+	webhookLog.Info("webhook delivery failed, will retry", "endpoint", msg.Endpoint, "event_id", msg.EventID,
+		"attempts", msg.Attempts, "retry_at", msg.NextAttemptAt, "error", err)
+}
+
+// backoff is the wait after the nth failed attempt: initial_backoff doubled
+// n-1 times up to max_backoff, plus up to 10% so that messages failing
+// together spread out.
+func (d *dispatcher) backoff(n int) time.Duration {
+	b := d.cfg.InitialBackoff
+	for i := 1; i < n && b < d.cfg.MaxBackoff; i++ {
+		b *= 2
+	}
+	b = min(b, d.cfg.MaxBackoff)
+	return b + rand.N(b/10+1)
+}
+
+// cleanUp deletes the messages delivered more than keep_delivered ago.
+func (d *dispatcher) cleanUp(ctx context.Context) {
+	n, err := d.repo.DeleteDeliveredOutbox(ctx, time.Now().UTC().Add(-d.cfg.KeepDelivered))
+	switch {
+	case err != nil && ctx.Err() == nil:
+		webhookLog.Error("deleting delivered outbox messages failed", "error", err)
+	case n > 0:
+		webhookLog.Info("deleted delivered outbox messages", "count", n)
+	}
+}
+
+func (d *dispatcher) setLastError(err error) {
+	d.mu.Lock()
+	d.lastError = err.Error()
+	d.mu.Unlock()
+}
+
+// Stats returns the totals since startup.
+func (d *dispatcher) Stats() dispatcherStats {
+	d.mu.Lock()
+	lastError := d.lastError
+	d.mu.Unlock()
+	return dispatcherStats{
+		Endpoints:    d.names,
+		Delivered:    d.delivered.Load(),
+		Retries:      d.retries.Load(),
+		DeadLettered: d.deadLettered.Load(),
+		Failures:     d.failures.Load(),
+		LastError:    lastError,
+	}
+}
+
+// publish exposes Stats as an expvar (served on server.debug_addr).
+func (d *dispatcher) publish(name string) {
+	if expvar.Get(name) == nil {
+		expvar.Publish(name, expvar.Func(func() any { return d.Stats() }))
+	}
+}
+
+// runOutboxCommand - "outbox dead" lists dead-lettered messages, "outbox
+// replay" queues them again with fresh attempts
+func runOutboxCommand(cfg config.DatabaseConfig, args []string) error {
+	if len(args) == 0 || (args[0] != "dead" && args[0] != "replay") {
+		return errors.New("usage: outbox dead [-endpoint NAME] [-limit N] | outbox replay [-endpoint NAME] [-all] [ID...]")
+	}
+	fs := flag.NewFlagSet("outbox "+args[0], flag.ContinueOnError)
+	endpoint := fs.String("endpoint", "", "only the messages of this endpoint")
+	limit := fs.Int("limit", 100, "most messages to list")
+	all := fs.Bool("all", false, "replay every dead message (of -endpoint, if set)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	ids := fs.Args()
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return fmt.Errorf("outbox: %q is not a message ID", id)
+		}
+	}
+
+	repo, err := openRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	ctx := context.Background()
+
+	if args[0] == "dead" {
+		msgs, err := repo.OutboxMessages(ctx, outboxDead, *endpoint, *limit)
+		if err != nil {
+			return fmt.Errorf("outbox: %w", err)
+		}
+		if len(msgs) == 0 {
+			fmt.Println("no dead-lettered messages")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tENDPOINT\tEVENT\tCREATED\tATTEMPTS\tLAST ERROR")
+		for _, m := range msgs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", m.ID, m.Endpoint, m.EventType,
+				m.CreatedAt.Format(time.RFC3339), m.Attempts, m.LastError)
+		}
+		return w.Flush()
+	}
+
+	if len(ids) == 0 && !*all {
+		return errors.New("outbox replay: give message IDs, or -all")
+	}
+	n, err := repo.ReplayOutbox(ctx, *endpoint, ids)
+	if err != nil {
+		return fmt.Errorf("outbox replay: %w", err)
+	}
+	fmt.Printf("replayed %d message(s); the server delivers them on its next pass\n", n)
+	return nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"grpc-example/config"
+)
+
+const (
+	testWebhookSecretEnv = "TEST_WEBHOOK_SECRET"
+	testWebhookSecret    = "s3cret"
+)
+
+// testRepositories returns an in-memory and a SQLite repository, closed
+// when the test ends.
+func testRepositories(t testing.TB) map[string]Repository {
+	t.Helper()
+	cfg := config.Defaults("dev").Database
+	cfg.URL = sqliteScheme + filepath.Join(t.TempDir(), "test.db")
+	db, err := openRepository(cfg)
+	if err != nil {
+		t.Fatalf("opening %s: %v", cfg.URL, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return map[string]Repository{"memory": newMemoryRepository(), "sqlite": db}
+}
+
+// webhookReceiver is an endpoint that checks signatures the way receivers
+// are told to, then answers with status.
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	status        int
+	events        []greetingsCreatedEvent
+	badSignatures int
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	rcv := &webhookReceiver{status: status}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+		mac.Write([]byte(r.Header.Get(webhookTimestampHeader) + "." + string(body)))
+		want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		if !hmac.Equal([]byte(r.Header.Get(webhookSignatureHeader)), []byte(want)) {
+			rcv.badSignatures++
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event greetingsCreatedEvent
+		if err := json.Unmarshal(body, &event); err != nil || event.ID != r.Header.Get(webhookIDHeader) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rcv.events = append(rcv.events, event)
+		w.WriteHeader(rcv.status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *webhookReceiver) setStatus(status int) {
+	rcv.mu.Lock()
+	rcv.status = status
+	rcv.mu.Unlock()
+}
+
+// received returns the number of correctly signed requests and of the
+// others.
+func (rcv *webhookReceiver) received() (signed, bad int) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return len(rcv.events), rcv.badSignatures
+}
+
+func newTestDispatcher(t *testing.T, repo Repository, url string) *dispatcher {
+	t.Setenv(testWebhookSecretEnv, testWebhookSecret)
+	cfg := config.Defaults("dev").Server.Webhooks
+	cfg.Endpoints = []config.WebhookEndpoint{{Name: "test", URL: url, SecretEnv: testWebhookSecretEnv}}
+	cfg.MaxAttempts = 3
+	cfg.InitialBackoff = 5 * time.Second
+	d, err := newDispatcher(repo, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func createTestGreetings(t *testing.T, repo Repository, n int, notify ...string) []Greeting {
+	t.Helper()
+	greetings := make([]Greeting, n)
+	for i := range greetings {
+		greetings[i].Message = "Hello test"
+	}
+	if err := repo.CreateGreetings(context.Background(), greetings, notify); err != nil {
+		t.Fatalf("CreateGreetings: %v", err)
+	}
+	return greetings
+}
+
+func outboxWith(t *testing.T, repo Repository, status string) []OutboxMessage {
+	t.Helper()
+	msgs, err := repo.OutboxMessages(context.Background(), status, "", 100)
+	if err != nil {
+		t.Fatalf("OutboxMessages(%s): %v", status, err)
+	}
+	return msgs
+}
+
+func TestWebhookSignatureVerifies(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			rcv := newWebhookReceiver(t, http.StatusOK)
+			d := newTestDispatcher(t, repo, rcv.URL)
+			greetings := createTestGreetings(t, repo, 3, "test")
+
+			if _, err := d.deliverDue(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if signed, bad := rcv.received(); signed != 1 || bad != 0 {
+				t.Fatalf("receiver got %d signed and %d badly signed requests, want 1 and 0", signed, bad)
+			}
+			event := rcv.events[0]
+			if event.Type != greetingsCreated || len(event.Greetings) != len(greetings) || event.Greetings[0].ID != greetings[0].ID {
+				t.Fatalf("unexpected event %+v", event)
+			}
+			if msgs := outboxWith(t, repo, outboxDelivered); len(msgs) != 1 || msgs[0].Attempts != 1 || msgs[0].DeliveredAt == nil {
+				t.Fatalf("delivered messages = %+v, want one after one attempt", msgs)
+			}
+		})
+	}
+}
+
+func TestWebhookRetriesThenDeadLetters(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			rcv := newWebhookReceiver(t, http.StatusInternalServerError)
+			d := newTestDispatcher(t, repo, rcv.URL)
+			createTestGreetings(t, repo, 2, "test")
+
+			var lastWait time.Duration
+			for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+				before := time.Now().UTC()
+				if _, err := d.deliverDue(ctx); err != nil {
+					t.Fatal(err)
+				}
+				if signed, _ := rcv.received(); signed != attempt {
+					t.Fatalf("attempt %d: receiver got %d requests", attempt, signed)
+				}
+				if attempt == d.cfg.MaxAttempts {
+					break
+				}
+
+				pending := outboxWith(t, repo, outboxPending)
+				if len(pending) != 1 || pending[0].Attempts != attempt || !strings.Contains(pending[0].LastError, "500") {
+					t.Fatalf("attempt %d: pending messages = %+v", attempt, pending)
+				}
+				wait := pending[0].NextAttemptAt.Sub(before)
+				if wait <= lastWait {
+					t.Fatalf("attempt %d: next attempt in %v, want more than the %v before", attempt, wait, lastWait)
+				}
+				lastWait = wait
+
+				// Not due yet: a pass leaves it alone
+				if _, err := d.deliverDue(ctx); err != nil {
+					t.Fatal(err)
+				}
+				if signed, _ := rcv.received(); signed != attempt {
+					t.Fatalf("attempt %d: message was retried before its backoff", attempt)
+				}
+				pending[0].NextAttemptAt = time.Now().UTC()
+				if err := repo.SaveOutbox(ctx, &pending[0]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if pending := outboxWith(t, repo, outboxPending); len(pending) != 0 {
+				t.Fatalf("%d message(s) still pending after %d attempts", len(pending), d.cfg.MaxAttempts)
+			}
+			dead := outboxWith(t, repo, outboxDead)
+			if len(dead) != 1 || dead[0].Attempts != d.cfg.MaxAttempts {
+				t.Fatalf("dead messages = %+v, want one after %d attempts", dead, d.cfg.MaxAttempts)
+			}
+
+			n, err := repo.ReplayOutbox(ctx, "test", nil)
+			if err != nil || n != 1 {
+				t.Fatalf("ReplayOutbox = %d, %v; want 1", n, err)
+			}
+			pending := outboxWith(t, repo, outboxPending)
+			if len(pending) != 1 || pending[0].Attempts != 0 || pending[0].ID != dead[0].ID {
+				t.Fatalf("pending after replay = %+v, want the dead message with no attempts", pending)
+			}
+
+			rcv.setStatus(http.StatusNoContent)
+			if _, err := d.deliverDue(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if delivered := outboxWith(t, repo, outboxDelivered); len(delivered) != 1 {
+				t.Fatalf("replayed message was not delivered: %+v", outboxWith(t, repo, outboxPending))
+			}
+		})
+	}
+}
+
+func TestClaimOutboxLeases(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			createTestGreetings(t, repo, 1, "a", "b")
+
+			first, err := repo.ClaimOutbox(ctx, 1, time.Minute)
+			if err != nil || len(first) != 1 {
+				t.Fatalf("ClaimOutbox = %d messages, %v; want 1", len(first), err)
+			}
+			// Another replica gets the other message, then nothing
+			second, err := repo.ClaimOutbox(ctx, 10, time.Minute)
+			if err != nil || len(second) != 1 || second[0].ID == first[0].ID {
+				t.Fatalf("second ClaimOutbox = %+v, %v; want the other message", second, err)
+			}
+			if more, err := repo.ClaimOutbox(ctx, 10, time.Minute); err != nil || len(more) != 0 {
+				t.Fatalf("third ClaimOutbox = %d messages, %v; want none", len(more), err)
+			}
+
+			// Saving a claimed message unchanged releases it
+			if err := repo.SaveOutbox(ctx, &first[0]); err != nil {
+				t.Fatal(err)
+			}
+			again, err := repo.ClaimOutbox(ctx, 10, time.Minute)
+			if err != nil || len(again) != 1 || again[0].ID != first[0].ID {
+				t.Fatalf("ClaimOutbox after release = %+v, %v; want the released message", again, err)
+			}
+		})
+	}
+}
+
+func TestEraseUserRedactsOutbox(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			users, err := repo.GetOrCreateUsers(ctx, []string{"ann", "bob"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ann, bob := users["ann"].ID, users["bob"].ID
+			// One event with both users, one with ann only
+			mixed := []Greeting{{Message: "Hello ann", UserID: &ann}, {Message: "Hello bob", UserID: &bob}}
+			if err := repo.CreateGreetings(ctx, mixed, []string{"test"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.CreateGreetings(ctx, []Greeting{{Message: "Hello ann", UserID: &ann}}, []string{"test"}); err != nil {
+				t.Fatal(err)
+			}
+			// Dead-lettered messages must not be replayable either
+			for _, msg := range outboxWith(t, repo, outboxPending) {
+				if !strings.Contains(msg.Payload, bob) {
+					msg.Status = outboxDead
+					if err := repo.SaveOutbox(ctx, &msg); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if _, err := repo.EraseUser(ctx, "ann", "test", "test"); err != nil {
+				t.Fatal(err)
+			}
+			if dead := outboxWith(t, repo, outboxDead); len(dead) != 0 {
+				t.Fatalf("dead-lettered event of the erased user was kept: %+v", dead)
+			}
+			msgs := outboxWith(t, repo, outboxPending)
+			if len(msgs) != 1 {
+				t.Fatalf("outbox has %d messages after the erasure, want the mixed event only", len(msgs))
+			}
+			if strings.Contains(msgs[0].Payload, ann) || strings.Contains(msgs[0].Payload, "Hello ann") {
+				t.Fatalf("erased user is still in the outbox: %s", msgs[0].Payload)
+			}
+			var event greetingsCreatedEvent
+			if err := json.Unmarshal([]byte(msgs[0].Payload), &event); err != nil {
+				t.Fatal(err)
+			}
+			if len(event.Greetings) != 1 || *event.Greetings[0].UserID != bob {
+				t.Fatalf("redacted event = %+v, want bob's greeting only", event)
+			}
+		})
+	}
+}
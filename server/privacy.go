@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	pb "grpc-example/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// userExportFormat identifies the layout of ExportUserData documents; a
+// change that breaks readers needs a new version.
+const userExportFormat = "grpc-example/user-export/v1"
+
+// exportBatch is how many greetings are read per query while exporting.
+const exportBatch = 500
+
+// exportChunkSize is the size UserDataChunks are sent at, well below the
+// default 4 MiB message limit of gRPC clients.
+const exportChunkSize = 64 << 10
+
+// exportedUser and exportedGreeting are the records of an export.
+type exportedUser struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     *string   `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type exportedGreeting struct {
+	ID        string    `json:"id"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ExportUserData - Streams the user's profile and greetings as one JSON
+// document, written as the greetings are read so memory stays flat however
+// many there are
+func (a *adminServer) ExportUserData(in *pb.ExportUserDataRequest, stream pb.Admin_ExportUserDataServer) error {
+	ctx := stream.Context()
+	if err := requireScope(ctx, adminScope); err != nil {
+		return err
+	}
+	user, err := a.repo.FindUser(ctx, in.Name)
+	if errors.Is(err, ErrUserNotFound) {
+		return status.Error(codes.NotFound, "no such user")
+	}
+	if err != nil {
+		return a.dbError(ctx, "export failed", err)
+	}
+
+	var sendErr error
+	w := &chunkWriter{send: func(data []byte) error {
+		sendErr = stream.Send(&pb.UserDataChunk{Data: data})
+		return sendErr
+	}}
+	header, err := json.Marshal(map[string]any{
+		"format":      userExportFormat,
+		"exported_at": time.Now().UTC(),
+		"user": exportedUser{
+			ID: user.ID, Name: user.Name, Email: user.Email, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt,
+		},
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "export: %v", err)
+	}
+	// Open the object back up to append the greetings array
+	w.Write(header[:len(header)-1])
+	w.Write([]byte(`,"greetings":[`))
+
+	n := 0
+	err = a.repo.UserGreetings(ctx, user.ID, exportBatch, func(greetings []Greeting) error {
+		for _, g := range greetings {
+			line, err := json.Marshal(exportedGreeting{ID: g.ID, Message: g.Message, CreatedAt: g.CreatedAt})
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				w.Write([]byte(","))
+			}
+			w.Write(line)
+			n++
+		}
+		return w.flushFull()
+	})
+	if err == nil {
+		w.Write([]byte("]}\n"))
+		err = w.flush()
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		return a.dbError(ctx, "export failed", err)
+	}
+	log.InfoContext(ctx, "user data exported", "by", callerFrom(ctx), "user_id", user.ID, "greetings", n)
+	return nil
+}
+
+// EraseUser - Deletes the user and their greetings, records the tombstone,
+// then removes the greetings retention already moved to archive_dir
+func (a *adminServer) EraseUser(ctx context.Context, in *pb.EraseUserRequest) (*pb.EraseUserReply, error) {
+	if err := requireScope(ctx, adminScope); err != nil {
+		return nil, err
+	}
+	erasure, err := a.repo.EraseUser(ctx, in.Name, callerFrom(ctx), in.Reason)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, status.Error(codes.NotFound, "no such user")
+	}
+	if err != nil {
+		return nil, a.dbError(ctx, "erasure failed", err)
+	}
+	// The name is not logged: after this, only its hash may remain
+	log.WarnContext(ctx, "user erased", "by", erasure.ErasedBy, "user_id", erasure.UserID,
+		"tombstone_id", erasure.ID, "greetings_deleted", erasure.GreetingsDeleted)
+
+	// The user is gone from the database, so no later retention run can
+	// archive their greetings again
+	archived, err := redactArchives(a.archiveDir, erasure.UserID)
+	if err != nil {
+		log.ErrorContext(ctx, "archive redaction failed", "user_id", erasure.UserID, "redacted", archived, "error", err)
+		return nil, status.Errorf(codes.Internal,
+			"user %s erased, but redacting the retention archives failed; run redact-archives %s", erasure.UserID, erasure.UserID)
+	}
+	if archived > 0 {
+		log.WarnContext(ctx, "erased user redacted from archives", "user_id", erasure.UserID, "archived_greetings", archived)
+	}
+	return &pb.EraseUserReply{
+		TombstoneId:               erasure.ID,
+		UserId:                    erasure.UserID,
+		GreetingsDeleted:          erasure.GreetingsDeleted,
+		ErasedAt:                  timestamppb.New(erasure.ErasedAt),
+		ArchivedGreetingsRedacted: archived,
+	}, nil
+}
+
+// dbError logs a repository failure and turns it into Unavailable while the
+// database is down, Internal otherwise.
+func (a *adminServer) dbError(ctx context.Context, msg string, err error) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	log.ErrorContext(ctx, msg, "error", err)
+	if unavailable := a.db.unavailable(ctx); unavailable != nil {
+		return unavailable
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+// chunkWriter buffers a document and sends it in exportChunkSize pieces.
+type chunkWriter struct {
+	buf  bytes.Buffer
+	send func([]byte) error
+}
+
+func (w *chunkWriter) Write(p []byte) {
+	w.buf.Write(p)
+}
+
+// flushFull sends whole chunks, keeping the remainder buffered.
+func (w *chunkWriter) flushFull() error {
+	for w.buf.Len() >= exportChunkSize {
+		if err := w.send(w.buf.Next(exportChunkSize)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush sends everything buffered.
+func (w *chunkWriter) flush() error {
+	if err := w.flushFull(); err != nil || w.buf.Len() == 0 {
+		return err
+	}
+	return w.send(w.buf.Next(w.buf.Len()))
+}
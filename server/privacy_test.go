@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"grpc-example/config"
+	pb "grpc-example/proto"
+)
+
+// readArchive returns the greetings of an archive file.
+func readArchive(t *testing.T, path string) []archivedGreeting {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var greetings []archivedGreeting
+	lines := bufio.NewScanner(gz)
+	for lines.Scan() {
+		var g archivedGreeting
+		if err := json.Unmarshal(lines.Bytes(), &g); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		greetings = append(greetings, g)
+	}
+	if err := lines.Err(); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return greetings
+}
+
+func TestEraseUserRedactsArchives(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			users, err := repo.GetOrCreateUsers(ctx, []string{"ann", "bob"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ann, bob := users["ann"].ID, users["bob"].ID
+			old := time.Now().UTC().Add(-48 * time.Hour)
+			greetings := []Greeting{
+				{Message: "Hello ann", UserID: &ann, CreatedAt: old},
+				{Message: "Hello bob", UserID: &bob, CreatedAt: old},
+				{Message: "Hello ann", UserID: &ann, CreatedAt: old.Add(time.Minute)},
+				{Message: "Hello bob", UserID: &bob, CreatedAt: old.Add(time.Minute)},
+			}
+			if err := repo.CreateGreetings(ctx, greetings, nil); err != nil {
+				t.Fatal(err)
+			}
+			// Retention archives all four; an older archive holds bob only
+			cfg := config.Defaults("dev").Database.Retention
+			cfg.MaxAge = time.Hour
+			cfg.ArchiveDir = dir
+			run := newRetention(repo, cfg).purge(ctx)
+			if run.Error != "" || run.Archived != 4 {
+				t.Fatalf("retention run = %+v, want 4 greetings archived", run)
+			}
+			bobOnly, err := createGreetingArchive(dir, old)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := errors.Join(bobOnly.write([]Greeting{{ID: "g0", Message: "Hello bob", UserID: &bob, CreatedAt: old}}), bobOnly.Close()); err != nil {
+				t.Fatal(err)
+			}
+			untouched, err := os.ReadFile(bobOnly.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			admin := &adminServer{repo: repo, archiveDir: dir}
+			actx := context.WithValue(ctx, principalKey{}, &principal{KeyName: "test", Scopes: []string{adminScope}})
+			reply, err := admin.EraseUser(actx, &pb.EraseUserRequest{Name: "ann", Reason: "test"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reply.GreetingsDeleted != 0 || reply.ArchivedGreetingsRedacted != 2 {
+				t.Fatalf("reply = %+v, want no greetings in the database and 2 in the archives", reply)
+			}
+
+			paths, err := filepath.Glob(filepath.Join(dir, "*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(paths) != 2 {
+				t.Fatalf("archive directory holds %v, want the two archives only", paths)
+			}
+			var bobs int
+			for _, path := range paths {
+				for _, g := range readArchive(t, path) {
+					if g.UserID == nil || *g.UserID != bob {
+						t.Fatalf("%s still holds %+v", path, g)
+					}
+					bobs++
+				}
+			}
+			if bobs != 3 {
+				t.Fatalf("archives hold %d of bob's greetings, want 3", bobs)
+			}
+			if after, err := os.ReadFile(bobOnly.path); err != nil || !bytes.Equal(after, untouched) {
+				t.Fatalf("archive without the user was rewritten (%v)", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// greetingsQuota is the daily quota bucket charged once per greeting created.
+const greetingsQuota = "greetings"
+
+// callLimiter enforces server.rate_limit: a token bucket per caller and
+// method, plus daily quotas persisted in the quota_usage table. Unlike the
+// gateway's limiter it also covers native gRPC clients.
+type callLimiter struct {
+	repo Repository
+
+	mu       sync.Mutex
+	limiters map[string]*limiterEntry
+}
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newCallLimiter(repo Repository) *callLimiter {
+	return &callLimiter{repo: repo, limiters: make(map[string]*limiterEntry)}
+}
+
+// unaryInterceptor - Applies per-method budgets and daily quotas to unary calls
+func (cl *callLimiter) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := cl.admit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor - Applies per-method budgets and daily quotas to new streams
+func (cl *callLimiter) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := cl.admit(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// admit charges one call of method to the caller's budget and, if the
+// method has a daily quota, one unit of that quota.
+func (cl *callLimiter) admit(ctx context.Context, method string) error {
+	cfg := settings.Current()
+	rl := cfg.Server.RateLimit
+	if !rl.Enabled {
+		return nil
+	}
+	subject := callerSubject(ctx, cfg)
+
+	budget, ok := rl.Methods[method]
+	if !ok {
+		budget = rl.Default
+	}
+	limiter := cl.limiter(subject+" "+method, rate.Limit(budget.RPS), budget.Burst)
+	reservation := limiter.Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		log.WarnContext(ctx, "rate limit exceeded", "subject", subject, "method", method, "retry_after", delay)
+		return resourceExhausted(subject, fmt.Sprintf("rate limit of %v/s (burst %d) exceeded for %s", budget.RPS, budget.Burst, method), delay)
+	}
+
+	if _, ok := rl.DailyQuotas[method]; ok {
+		return cl.consume(ctx, method, 1)
+	}
+	return nil
+}
+
+// consume charges n units of a daily quota bucket to the current caller.
+// Buckets without a configured quota are free.
+func (cl *callLimiter) consume(ctx context.Context, bucket string, n int64) error {
+	cfg := settings.Current()
+	rl := cfg.Server.RateLimit
+	limit, ok := rl.DailyQuotas[bucket]
+	if !rl.Enabled || !ok || n <= 0 {
+		return nil
+	}
+	subject := callerSubject(ctx, cfg)
+
+	now := time.Now().UTC()
+	day := now.Truncate(24 * time.Hour)
+	untilReset := day.Add(24 * time.Hour).Sub(now)
+	exhausted := func() error {
+		log.WarnContext(ctx, "daily quota exhausted", "subject", subject, "bucket", bucket, "limit", limit, "requested", n)
+		return resourceExhausted(subject, fmt.Sprintf("daily %s quota of %d exhausted", bucket, limit), untilReset)
+	}
+	if n > limit {
+		return exhausted()
+	}
+
+	ok, err := cl.repo.ConsumeQuota(ctx, subject, bucket, day, n, limit)
+	if err != nil {
+		log.ErrorContext(ctx, "quota update failed", "subject", subject, "bucket", bucket, "error", err)
+		return status.Error(codes.Internal, "could not check quota")
+	}
+	if !ok {
+		return exhausted()
+	}
+	return nil
+}
+
+// limiter returns the token bucket for key, creating it or applying
+// reloaded parameters as needed.
+func (cl *callLimiter) limiter(key string, limit rate.Limit, burst int) *rate.Limiter {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	e, ok := cl.limiters[key]
+	if !ok {
+		e = &limiterEntry{limiter: rate.NewLimiter(limit, burst)}
+		cl.limiters[key] = e
+	} else if e.limiter.Limit() != limit || e.limiter.Burst() != burst {
+		e.limiter.SetLimit(limit)
+		e.limiter.SetBurst(burst)
+	}
+	e.lastSeen = time.Now()
+	return e.limiter
+}
+
+// sweep drops limiters of callers idle for longer than idle, so peer-keyed
+// buckets do not accumulate forever.
+func (cl *callLimiter) sweep(ctx context.Context, idle time.Duration) {
+	ticker := time.NewTicker(idle)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			cl.mu.Lock()
+			for key, e := range cl.limiters {
+				if now.Sub(e.lastSeen) > idle {
+					delete(cl.limiters, key)
+				}
+			}
+			cl.mu.Unlock()
+		}
+	}
+}
+
+// resourceExhausted builds a ResourceExhausted status carrying RetryInfo
+// and QuotaFailure details.
+func resourceExhausted(subject, description string, retryAfter time.Duration) error {
+	st := status.New(codes.ResourceExhausted, description)
+	detailed, err := st.WithDetails(
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{
+			{Subject: subject, Description: description},
+		}},
+	)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"grpc-example/config"
+
+	"gorm.io/gorm"
+)
+
+// replica is one read-only database. It is out of rotation until it has
+// connected and while its health check or a read on it fails.
+type replica struct {
+	name string // host:port, safe to log
+	cfg  config.DatabaseConfig
+
+	mu      sync.Mutex
+	db      *gorm.DB // nil until the first successful connect
+	healthy atomic.Bool
+	reads   atomic.Int64
+}
+
+// replicaSet spreads reads over the healthy replicas in turn.
+type replicaSet struct {
+	replicas       []*replica
+	next           atomic.Uint64
+	readYourWrites time.Duration
+	fallbacks      atomic.Int64 // reads that wanted a replica but got the primary
+
+	mu        sync.Mutex
+	lastWrite map[string]time.Time // by callerFrom
+}
+
+// replicaStats is published as the "db_replicas" expvar.
+type replicaStats struct {
+	Replicas []replicaStat `json:"replicas"`
+	// Fallbacks counts reads sent to the primary because no replica was
+	// healthy or the one picked failed.
+	Fallbacks int64 `json:"fallbacks"`
+}
+
+type replicaStat struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Reads   int64  `json:"reads"`
+}
+
+// newReplicaSet returns the replicas of database.replicas, or nil when
+// there are none. Nothing is connected until the health checks run.
+func newReplicaSet(cfg config.DatabaseConfig) *replicaSet {
+	if len(cfg.Replicas.URLs) == 0 {
+		return nil
+	}
+	rs := &replicaSet{readYourWrites: cfg.Replicas.ReadYourWrites, lastWrite: make(map[string]time.Time)}
+	for _, u := range cfg.Replicas.URLs {
+		rcfg := cfg
+		rcfg.URL = u
+		name := "replica"
+		if parsed, err := url.Parse(u); err == nil {
+			name = parsed.Host
+		}
+		rs.replicas = append(rs.replicas, &replica{name: name, cfg: rcfg})
+	}
+	return rs
+}
+
+// pick returns the replica for a read by the caller of ctx, or nil to read
+// from the primary: when there is no healthy replica, or the caller wrote
+// within the read-your-writes window.
+func (rs *replicaSet) pick(ctx context.Context) *replica {
+	if rs == nil {
+		return nil
+	}
+	if caller := callerFrom(ctx); caller != "" {
+		rs.mu.Lock()
+		wrote, ok := rs.lastWrite[caller]
+		rs.mu.Unlock()
+		if ok && time.Since(wrote) < rs.readYourWrites {
+			return nil
+		}
+	}
+	n := uint64(len(rs.replicas))
+	start := rs.next.Add(1)
+	for i := range n {
+		if r := rs.replicas[(start+i)%n]; r.healthy.Load() {
+			return r
+		}
+	}
+	rs.fallbacks.Add(1)
+	return nil
+}
+
+// wrote pins the reads of the caller of ctx to the primary for the
+// read-your-writes window.
+func (rs *replicaSet) wrote(ctx context.Context) {
+	if rs == nil || rs.readYourWrites <= 0 {
+		return
+	}
+	if caller := callerFrom(ctx); caller != "" {
+		rs.mu.Lock()
+		rs.lastWrite[caller] = time.Now()
+		rs.mu.Unlock()
+	}
+}
+
+// checkHealth - Checks every replica every interval until ctx is done, each
+// on its own so a slow one does not hold up the others; also forgets writes
+// older than the read-your-writes window
+func (rs *replicaSet) checkHealth(ctx context.Context, interval time.Duration) {
+	for _, r := range rs.replicas {
+		go func() {
+			for {
+				r.check(ctx, interval)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(interval):
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		rs.mu.Lock()
+		for caller, at := range rs.lastWrite {
+			if time.Since(at) >= rs.readYourWrites {
+				delete(rs.lastWrite, caller)
+			}
+		}
+		rs.mu.Unlock()
+	}
+}
+
+// check connects the replica if it is not yet, then pings it.
+func (r *replica) check(ctx context.Context, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	r.mu.Lock()
+	db := r.db
+	r.mu.Unlock()
+	var err error
+	if db == nil {
+		if db, err = connect(r.cfg); err == nil {
+			r.mu.Lock()
+			r.db = db
+			r.mu.Unlock()
+		}
+	}
+	if err == nil {
+		var sqlDB *sql.DB
+		if sqlDB, err = db.DB(); err == nil {
+			err = sqlDB.PingContext(ctx)
+		}
+	}
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		return // shutting down
+	}
+	r.setHealthy(err)
+}
+
+// setHealthy puts the replica in or out of rotation, logging changes.
+func (r *replica) setHealthy(err error) {
+	healthy := err == nil
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		dbLog.Info("read replica available", "replica", r.name)
+	} else {
+		dbLog.Warn("read replica unavailable, reading from the primary", "replica", r.name, "error", err)
+	}
+}
+
+// Stats returns the state of every replica.
+func (rs *replicaSet) Stats() replicaStats {
+	stats := replicaStats{Fallbacks: rs.fallbacks.Load()}
+	for _, r := range rs.replicas {
+		stats.Replicas = append(stats.Replicas, replicaStat{Name: r.name, Healthy: r.healthy.Load(), Reads: r.reads.Load()})
+	}
+	return stats
+}
+
+// publish exposes Stats as an expvar (served on server.debug_addr).
+func (rs *replicaSet) publish(name string) {
+	if expvar.Get(name) == nil {
+		expvar.Publish(name, expvar.Func(func() any { return rs.Stats() }))
+	}
+}
+
+// Close closes the replica pools.
+func (rs *replicaSet) Close() error {
+	if rs == nil {
+		return nil
+	}
+	var errs []error
+	for _, r := range rs.replicas {
+		r.mu.Lock()
+		if r.db != nil {
+			if sqlDB, err := r.db.DB(); err == nil {
+				errs = append(errs, sqlDB.Close())
+			}
+		}
+		r.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// read runs a query on a replica picked for the caller of ctx, or on the
+// primary. A replica that fails is taken out of rotation until its next
+// health check, and the query is retried on the primary. fromReplica tells
+// the caller not to cache the result, which may lag behind the primary.
+func (r *gormRepository) read(ctx context.Context, query func(db *gorm.DB) error) (fromReplica bool, err error) {
+	rep := r.replicas.pick(ctx)
+	if rep != nil {
+		rep.mu.Lock()
+		db := rep.db
+		rep.mu.Unlock()
+		rep.reads.Add(1)
+		err := query(db.WithContext(ctx))
+		if err == nil || errors.Is(err, gorm.ErrRecordNotFound) || ctx.Err() != nil {
+			return true, err
+		}
+		rep.setHealthy(err)
+		r.replicas.fallbacks.Add(1)
+	}
+	return false, query(r.db.WithContext(ctx))
+}
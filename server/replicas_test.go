@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetOrCreateUsersPinsOnlyAfterInserting(t *testing.T) {
+	a, _ := testReplicas(t)
+	a.replicas = &replicaSet{readYourWrites: time.Minute, lastWrite: make(map[string]time.Time)}
+	ctx := context.WithValue(context.Background(), callerKey{}, "caller")
+	pinned := func() bool {
+		a.replicas.mu.Lock()
+		defer a.replicas.mu.Unlock()
+		_, ok := a.replicas.lastWrite["caller"]
+		return ok
+	}
+
+	// Every user exists: the upsert runs but inserts nothing
+	if _, err := a.GetOrCreateUsers(context.Background(), []string{"ann", "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	a.users.Clear()
+	if _, err := a.GetOrCreateUsers(ctx, []string{"ann", "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if pinned() {
+		t.Fatal("an upsert of existing users pinned the caller to the primary")
+	}
+
+	if _, err := a.GetOrCreateUsers(ctx, []string{"ann", "zoe"}); err != nil {
+		t.Fatal(err)
+	}
+	if !pinned() {
+		t.Fatal("inserting a user did not pin the caller to the primary")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"grpc-example/config"
+)
+
+// Repository is the server's storage. The GORM implementation talks to
+// Postgres or SQLite; the in-memory one (database.url memory://) needs
+// nothing and forgets everything on exit, for offline development and tests.
+// Implementations are safe for concurrent use.
+type Repository interface {
+	// GetOrCreateUser returns the user called name, creating it first if
+	// there is none.
+	GetOrCreateUser(ctx context.Context, name string) (*User, error)
+	// GetOrCreateUsers is GetOrCreateUser for a batch: it returns the users
+	// called names, keyed by name, creating the ones that do not exist.
+	GetOrCreateUsers(ctx context.Context, names []string) (map[string]*User, error)
+	// FindUser returns the user called name, or ErrUserNotFound.
+	FindUser(ctx context.Context, name string) (*User, error)
+	// CreateGreetings stores greetings and fills in their IDs. In the same
+	// transaction it queues their greetings.created events (see
+	// greetingEvents) for the webhook endpoints named in notify.
+	CreateGreetings(ctx context.Context, greetings []Greeting, notify []string) error
+	// ExpiredGreetings returns up to limit of the oldest greetings created
+	// before cutoff.
+	ExpiredGreetings(ctx context.Context, cutoff time.Time, limit int) ([]Greeting, error)
+	// GreetingCutoffs returns, for each user with more than keep greetings
+	// (and for the greetings without a user, taken together), the newest
+	// greeting beyond the newest keep.
+	GreetingCutoffs(ctx context.Context, keep int) ([]GreetingCutoff, error)
+	// GreetingsUpTo returns up to limit of the oldest greetings of the user
+	// of cut, up to and including cut itself.
+	GreetingsUpTo(ctx context.Context, cut GreetingCutoff, limit int) ([]Greeting, error)
+	// DeleteGreetings deletes greetings by ID and returns how many it found.
+	DeleteGreetings(ctx context.Context, ids []string) (int64, error)
+	// UserGreetings calls fn with the greetings of userID, oldest first,
+	// up to batch at a time, until there are no more or fn fails.
+	UserGreetings(ctx context.Context, userID string, batch int, fn func([]Greeting) error) error
+	// EraseUser deletes the user called name and their greetings, removes
+	// the greetings from outbox events (see redactGreetingEvent), and
+	// records the erasure, all or nothing. It returns ErrUserNotFound for
+	// unknown names.
+	EraseUser(ctx context.Context, name, erasedBy, reason string) (*UserErasure, error)
+	// AppendAuditEvents chains events after the last stored one with key
+	// (see chainAuditEvents) and stores them, all or nothing. Concurrent
+	// appends, from this process or another, are serialized.
+	AppendAuditEvents(ctx context.Context, key []byte, events []AuditEvent) error
+	// AuditEvents returns the events matching filter in chain order.
+	AuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
+	// ClaimOutbox returns up to limit pending outbox messages whose next
+	// attempt is due, the longest waiting first, and holds them for lease by
+	// moving their next attempt to its end, so that other replicas skip
+	// them. The messages are returned as they were: saving one unchanged
+	// releases it.
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	// SaveOutbox stores the status, attempts, next attempt, last error and
+	// delivery time of msg.
+	SaveOutbox(ctx context.Context, msg *OutboxMessage) error
+	// OutboxMessages returns up to limit messages with status, of endpoint
+	// unless it is empty, oldest first.
+	OutboxMessages(ctx context.Context, status, endpoint string, limit int) ([]OutboxMessage, error)
+	// ReplayOutbox makes dead-lettered messages pending again with no
+	// attempts: those of endpoint unless it is empty, and of those the ones
+	// in ids unless it is empty. It returns how many it found.
+	ReplayOutbox(ctx context.Context, endpoint string, ids []string) (int64, error)
+	// DeleteDeliveredOutbox deletes the messages delivered before cutoff.
+	DeleteDeliveredOutbox(ctx context.Context, cutoff time.Time) (int64, error)
+	// GreetingsBetween calls fn with the greetings created in [from, to),
+	// oldest first, up to batch at a time, until there are no more or fn
+	// fails.
+	GreetingsBetween(ctx context.Context, from, to time.Time, batch int, fn func([]Greeting) error) error
+	// ApplyRollups replaces the minute rollups of buckets in [from, to)
+	// with minutes and batches, sums the hours and days overlapping the
+	// range again from them, and moves the watermark to to, all or nothing.
+	ApplyRollups(ctx context.Context, from, to time.Time, minutes []GreetingRollup, batches []BatchRollup) error
+	// RollupWatermark returns how far the rollups have aggregated greetings;
+	// before the first ApplyRollups, the creation time of the oldest
+	// greeting, or now if there is none.
+	RollupWatermark(ctx context.Context) (time.Time, error)
+	// GreetingStats sums the rollups selected by query.
+	GreetingStats(ctx context.Context, query StatsQuery) (*GreetingStats, error)
+	// ConsumeQuota adds n to the units of bucket used by subject on day,
+	// unless the total would exceed limit. It reports whether it did.
+	ConsumeQuota(ctx context.Context, subject, bucket string, day time.Time, n, limit int64) (bool, error)
+	// Ping checks that the storage can be reached.
+	Ping(ctx context.Context) error
+	// Close releases the connections held by the repository.
+	Close() error
+}
+
+// ErrUserNotFound is returned by FindUser for unknown names.
+var ErrUserNotFound = errors.New("user not found")
+
+// errConnect wraps failures to reach the database, which may go away by
+// themselves, unlike a bad URL or a schema at the wrong version.
+var errConnect = errors.New("failed to connect to database")
+
+// pooled is implemented by repositories backed by a database/sql pool,
+// whose statistics drive load shedding.
+type pooled interface {
+	Stats() sql.DBStats
+}
+
+// exclusive is implemented by repositories that several replicas share,
+// for jobs that only one of them should run at a time.
+type exclusive interface {
+	// exclusively runs fn while holding lock id, or reports ran false
+	// without running it when another replica holds the lock.
+	exclusively(ctx context.Context, id int64, fn func() error) (ran bool, err error)
+}
+
+// memoryURL selects the in-memory repository.
+const memoryURL = "memory://"
+
+// openRepository - Opens the repository selected by database.url: memory://
+// for the in-memory one, any other URL for GORM
+func openRepository(cfg config.DatabaseConfig) (Repository, error) {
+	switch {
+	case cfg.URL == "":
+		return nil, fmt.Errorf("database URL is not set (DATABASE_URL or database.url, %s for an in-memory store)", memoryURL)
+	case strings.HasPrefix(cfg.URL, memoryURL):
+		dbLog.Warn("using the in-memory repository, data is lost on exit")
+		return newMemoryRepository(), nil
+	default:
+		return openGormRepository(cfg)
+	}
+}
+
+// openRepositoryRetrying - openRepository, retried with exponential backoff
+// for up to database.startup_timeout while the database cannot be reached,
+// so the server can start before the database is up
+func openRepositoryRetrying(cfg config.DatabaseConfig) (Repository, error) {
+	const maxBackoff = 10 * time.Second
+	deadline := time.Now().Add(cfg.StartupTimeout)
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		repo, err := openRepository(cfg)
+		if err == nil || !errors.Is(err, errConnect) {
+			return repo, err
+		}
+		wait := min(backoff, time.Until(deadline))
+		if wait <= 0 {
+			return nil, fmt.Errorf("database still unreachable after %s (%d attempts): %w", cfg.StartupTimeout, attempt, err)
+		}
+		dbLog.Warn("database unreachable, retrying", "attempt", attempt, "retry_in", wait, "error", err)
+		time.Sleep(wait)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
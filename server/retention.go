@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"grpc-example/config"
+	"grpc-example/logging"
+)
+
+var retentionLog = logging.For("retention")
+
+// archiveMu serializes the writers of this process's archives: a retention
+// run holds it while it has an archive open, and redactArchives while it
+// rewrites them.
+var archiveMu sync.Mutex
+
+// retentionLockID keeps replicas sharing a database from purging at the
+// same time (and archiving the same rows twice).
+const retentionLockID int64 = 0x67727063_72657465
+
+// retention implements database.retention: it deletes expired greetings in
+// batches, archiving them first when archive_dir is set.
+type retention struct {
+	repo Repository
+	cfg  config.RetentionConfig
+
+	runs, purged, archived, failures atomic.Int64
+
+	mu   sync.Mutex
+	last *retentionRun
+}
+
+// retentionRun describes one pass of the job.
+type retentionRun struct {
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+	Purged   int64     `json:"purged"`
+	Archived int64     `json:"archived"`
+	Archive  string    `json:"archive,omitempty"` // file the rows went to
+	Skipped  bool      `json:"skipped,omitempty"` // another replica was purging
+	Error    string    `json:"error,omitempty"`
+}
+
+// retentionStats is published as the "retention" expvar.
+type retentionStats struct {
+	Runs     int64         `json:"runs"`
+	Purged   int64         `json:"purged"`
+	Archived int64         `json:"archived"`
+	Failures int64         `json:"failures"`
+	LastRun  *retentionRun `json:"last_run"`
+}
+
+// GreetingCutoff is the newest greeting of a user (nil for the greetings
+// without one) beyond the newest max_per_user: it and every older greeting
+// of the user are purged.
+type GreetingCutoff struct {
+	ID        string
+	UserID    *string
+	CreatedAt time.Time
+}
+
+// archivedGreeting is one line of an archive file.
+type archivedGreeting struct {
+	ID        string    `json:"id"`
+	Message   string    `json:"message"`
+	UserID    *string   `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newRetention(repo Repository, cfg config.RetentionConfig) *retention {
+	return &retention{repo: repo, cfg: cfg}
+}
+
+// run - Purges right away, then every interval until ctx is done
+func (rt *retention) run(ctx context.Context) {
+	retentionLog.Info("retention enabled", "max_age", rt.cfg.MaxAge, "max_per_user", rt.cfg.MaxPerUser,
+		"interval", rt.cfg.Interval, "archive_dir", rt.cfg.ArchiveDir)
+	ticker := time.NewTicker(rt.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		rt.purge(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge runs one pass, records it and returns it.
+func (rt *retention) purge(ctx context.Context) *retentionRun {
+	run := &retentionRun{Started: time.Now().UTC()}
+	err := rt.pass(ctx, run)
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		err = nil // shutting down; whatever was done is recorded
+	}
+	run.Duration = time.Since(run.Started).Round(time.Millisecond).String()
+
+	rt.runs.Add(1)
+	rt.purged.Add(run.Purged)
+	rt.archived.Add(run.Archived)
+	switch {
+	case err != nil:
+		run.Error = err.Error()
+		rt.failures.Add(1)
+		retentionLog.Error("purge failed", "purged", run.Purged, "archived", run.Archived, "error", err)
+	case run.Skipped:
+		retentionLog.Debug("purge skipped, another replica is purging")
+	case run.Purged > 0:
+		retentionLog.Info("purged greetings", "purged", run.Purged, "archived", run.Archived, "archive", run.Archive, "duration", run.Duration)
+	}
+	rt.mu.Lock()
+	rt.last = run
+	rt.mu.Unlock()
+	return run
+}
+
+// pass deletes expired greetings one batch at a time, pausing in between,
+// until a batch comes back short. Each batch is on disk before it is deleted.
+func (rt *retention) pass(ctx context.Context, run *retentionRun) error {
+	if ex, ok := rt.repo.(exclusive); ok {
+		ran, err := ex.exclusively(ctx, retentionLockID, func() error { return rt.batches(ctx, run) })
+		run.Skipped = !ran && err == nil
+		return err
+	}
+	return rt.batches(ctx, run)
+}
+
+// batches purges greetings past max_age, then those beyond the newest
+// max_per_user of each user, whose cutoffs are looked up once per run.
+func (rt *retention) batches(ctx context.Context, run *retentionRun) (err error) {
+	if rt.cfg.ArchiveDir != "" {
+		archiveMu.Lock()
+		defer archiveMu.Unlock()
+	}
+	var archive *greetingArchive
+	defer func() {
+		if archive != nil {
+			err = errors.Join(err, archive.Close())
+		}
+	}()
+
+	if rt.cfg.MaxAge > 0 {
+		cutoff := run.Started.Add(-rt.cfg.MaxAge)
+		err := rt.drain(ctx, run, &archive, func() ([]Greeting, error) {
+			return rt.repo.ExpiredGreetings(ctx, cutoff, rt.cfg.BatchSize)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if rt.cfg.MaxPerUser > 0 {
+		cutoffs, err := rt.repo.GreetingCutoffs(ctx, rt.cfg.MaxPerUser)
+		if err != nil {
+			return err
+		}
+		for _, cut := range cutoffs {
+			err := rt.drain(ctx, run, &archive, func() ([]Greeting, error) {
+				return rt.repo.GreetingsUpTo(ctx, cut, rt.cfg.BatchSize)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// drain archives and deletes the greetings next returns, pausing after each
+// full batch, until a batch comes back short. The archive is created on
+// first use.
+func (rt *retention) drain(ctx context.Context, run *retentionRun, archive **greetingArchive, next func() ([]Greeting, error)) error {
+	for {
+		batch, err := next()
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+
+		if rt.cfg.ArchiveDir != "" {
+			if *archive == nil {
+				if *archive, err = createGreetingArchive(rt.cfg.ArchiveDir, run.Started); err != nil {
+					return err
+				}
+				run.Archive = (*archive).path
+			}
+			if err := (*archive).write(batch); err != nil {
+				return err
+			}
+			run.Archived += int64(len(batch))
+		}
+
+		ids := make([]string, len(batch))
+		for i, g := range batch {
+			ids[i] = g.ID
+		}
+		n, err := rt.repo.DeleteGreetings(ctx, ids)
+		run.Purged += n
+		if err != nil {
+			return err
+		}
+
+		if len(batch) < rt.cfg.BatchSize {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rt.cfg.BatchPause):
+		}
+	}
+}
+
+// Stats returns the totals and the last run.
+func (rt *retention) Stats() retentionStats {
+	rt.mu.Lock()
+	last := rt.last
+	rt.mu.Unlock()
+	return retentionStats{
+		Runs:     rt.runs.Load(),
+		Purged:   rt.purged.Load(),
+		Archived: rt.archived.Load(),
+		Failures: rt.failures.Load(),
+		LastRun:  last,
+	}
+}
+
+// publish exposes Stats as an expvar (served on server.debug_addr).
+func (rt *retention) publish(name string) {
+	if expvar.Get(name) == nil {
+		expvar.Publish(name, expvar.Func(func() any { return rt.Stats() }))
+	}
+}
+
+// greetingArchive is a gzipped NDJSON file of purged greetings.
+type greetingArchive struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+// createGreetingArchive creates greetings-<time>.ndjson.gz in dir.
+func createGreetingArchive(dir string, started time.Time) (*greetingArchive, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("archive directory: %w", err)
+	}
+	path := filepath.Join(dir, "greetings-"+started.Format("20060102T150405Z")+".ndjson.gz")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	gz := gzip.NewWriter(file)
+	return &greetingArchive{path: path, file: file, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+// write appends greetings and makes sure they reached the disk.
+func (a *greetingArchive) write(greetings []Greeting) error {
+	for _, g := range greetings {
+		if err := a.enc.Encode(archivedGreeting{ID: g.ID, Message: g.Message, UserID: g.UserID, CreatedAt: g.CreatedAt}); err != nil {
+			return fmt.Errorf("archive %s: %w", a.path, err)
+		}
+	}
+	if err := a.gz.Flush(); err != nil {
+		return fmt.Errorf("archive %s: %w", a.path, err)
+	}
+	return a.file.Sync()
+}
+
+func (a *greetingArchive) Close() error {
+	return errors.Join(a.gz.Close(), a.file.Sync(), a.file.Close())
+}
+
+// archiveGlob matches the archive files createGreetingArchive creates.
+const archiveGlob = "greetings-*.ndjson.gz"
+
+// redactArchives removes the greetings of userID from every archive in dir
+// and returns how many it removed. Files without any are left as they were;
+// the others are rewritten next to themselves, synced and renamed over the
+// original, so a failure leaves each archive either whole or redacted.
+func redactArchives(dir, userID string) (int64, error) {
+	if dir == "" {
+		return 0, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, archiveGlob))
+	if err != nil {
+		return 0, err
+	}
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	var total int64
+	for _, path := range paths {
+		n, err := redactArchive(path, userID)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("redacting %s: %w", path, err)
+		}
+	}
+	return total, nil
+}
+
+func redactArchive(path, userID string) (removed int64, err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	gzIn, err := gzip.NewReader(in)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".redact-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	gzOut := gzip.NewWriter(tmp)
+
+	lines := bufio.NewReader(gzIn)
+	for {
+		line, err := lines.ReadBytes('\n')
+		if len(line) > 0 {
+			var g archivedGreeting
+			if jsonErr := json.Unmarshal(line, &g); jsonErr != nil {
+				return 0, jsonErr
+			}
+			if g.UserID != nil && *g.UserID == userID {
+				removed++
+			} else if _, err := gzOut.Write(line); err != nil {
+				return 0, err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if err := errors.Join(gzOut.Close(), tmp.Chmod(0o640), tmp.Sync(), tmp.Close()); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+	tmp = nil
+	return removed, nil
+}
+
+// runRedactArchivesCommand - "redact-archives <user id>": removes an erased
+// user's greetings from the archives in database.retention.archive_dir, for
+// hosts other than the one that served the erasure
+func runRedactArchivesCommand(cfg config.RetentionConfig, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: redact-archives <user id>")
+	}
+	if cfg.ArchiveDir == "" {
+		return errors.New("redact-archives: database.retention.archive_dir is not set")
+	}
+	n, err := redactArchives(cfg.ArchiveDir, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("removed %d greetings from the archives in %s\n", n, cfg.ArchiveDir)
+	return nil
+}
+
+// runPurgeCommand - "purge": one retention pass with database.retention,
+// e.g. from cron instead of the server's own job
+func runPurgeCommand(cfg config.DatabaseConfig) error {
+	if !cfg.Retention.Enabled() {
+		return errors.New("purge: set database.retention.max_age or max_per_user first")
+	}
+	repo, err := openRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+	run := newRetention(repo, cfg.Retention).purge(context.Background())
+	switch {
+	case run.Error != "":
+		return fmt.Errorf("purge: %s", run.Error)
+	case run.Skipped:
+		fmt.Println("another replica is purging, nothing done")
+	case run.Archive != "":
+		fmt.Printf("purged %d greetings in %s, archived %d to %s\n", run.Purged, run.Duration, run.Archived, run.Archive)
+	default:
+		fmt.Printf("purged %d greetings in %s\n", run.Purged, run.Duration)
+	}
+	return nil
+}
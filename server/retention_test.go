@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"grpc-example/config"
+)
+
+func TestRetentionPurgesByAgeAndPerUser(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			users, err := repo.GetOrCreateUsers(ctx, []string{"ann", "bob", "carol"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now().UTC().Truncate(time.Microsecond)
+			at := func(user string, ago time.Duration) Greeting {
+				g := Greeting{Message: "Hello " + user, CreatedAt: now.Add(-ago)}
+				if user != "" {
+					g.UserID = &users[user].ID
+				}
+				return g
+			}
+			greetings := []Greeting{
+				// ann keeps her newest two; two of the others share a timestamp
+				at("ann", 4*time.Minute), at("ann", 3*time.Minute), at("ann", 3*time.Minute),
+				at("ann", 2*time.Minute), at("ann", time.Minute),
+				at("bob", 2*time.Minute), at("bob", time.Minute),
+				// carol's only greeting is too old
+				at("carol", 100*24*time.Hour),
+				// greetings without a user count as one more user
+				at("", 3*time.Minute), at("", 2*time.Minute), at("", time.Minute),
+			}
+			if err := repo.CreateGreetings(ctx, greetings, nil); err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for _, i := range []int{3, 4, 5, 6, 9, 10} {
+				want = append(want, greetings[i].ID)
+			}
+
+			cfg := config.Defaults("dev").Database.Retention
+			cfg.MaxAge = 90 * 24 * time.Hour
+			cfg.MaxPerUser = 2
+			cfg.BatchSize = 2
+			cfg.BatchPause = 0
+			cfg.ArchiveDir = t.TempDir()
+			run := newRetention(repo, cfg).purge(ctx)
+			if run.Error != "" || run.Purged != 5 || run.Archived != 5 {
+				t.Fatalf("run = %+v, want 5 greetings purged and archived", run)
+			}
+
+			left, err := repo.ExpiredGreetings(ctx, now.Add(time.Hour), 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, g := range left {
+				got = append(got, g.ID)
+			}
+			slices.Sort(got)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Fatalf("kept %v, want %v", got, want)
+			}
+			if run := newRetention(repo, cfg).purge(ctx); run.Error != "" || run.Purged != 0 {
+				t.Fatalf("second run = %+v, want nothing purged", run)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"iter"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"grpc-example/config"
+	"grpc-example/logging"
+	pb "grpc-example/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var rollupLog = logging.For("rollups")
+
+// rollupLockID keeps replicas sharing a database from aggregating at the
+// same time.
+const rollupLockID int64 = 0x67727063_726f6c6c // "grpcroll"
+
+// greetingRollups names the watermark of the greeting rollups.
+const greetingRollups = "greetings"
+
+// rollupChunk is the span of greetings aggregated per transaction, so that
+// catching up on a long history is done in steps.
+const rollupChunk = time.Hour
+
+// rollupScanBatch is how many greetings are read per query while
+// aggregating, and rollupInsertBatch how many rollups are inserted per
+// statement.
+const (
+	rollupScanBatch   = 5000
+	rollupInsertBatch = 1000
+)
+
+// nilUserID stands for the user of greetings without one in the rollups.
+const nilUserID = "00000000-0000-0000-0000-000000000000"
+
+// maxStatsBuckets bounds the buckets of one GetGreetingStats call.
+const maxStatsBuckets = 1500
+
+// Top users returned by GetGreetingStats by default and at most.
+const (
+	defaultTopUsers = 10
+	maxTopUsers     = 100
+)
+
+const (
+	rollupMinute = "minute"
+	rollupHour   = "hour"
+	rollupDay    = "day"
+)
+
+// rollupUnit is a bucket size; the rollups of each unit are sums of those
+// of the finer one, down to minutes, which are counted from greetings.
+// Buckets start at whole UTC minutes, hours and days.
+type rollupUnit struct {
+	name, finer string
+	size        time.Duration
+}
+
+var rollupUnits = []rollupUnit{
+	{name: rollupMinute, size: time.Minute},
+	{name: rollupHour, finer: rollupMinute, size: time.Hour},
+	{name: rollupDay, finer: rollupHour, size: 24 * time.Hour},
+}
+
+// buckets yields the start of every bucket overlapping [from, to).
+func (u rollupUnit) buckets(from, to time.Time) iter.Seq[time.Time] {
+	return func(yield func(time.Time) bool) {
+		for b := from.Truncate(u.size); b.Before(to); b = b.Add(u.size) {
+			if !yield(b) {
+				return
+			}
+		}
+	}
+}
+
+// sizeClass is the histogram class of a batch of n greetings: class c
+// holds the batches of 2^c to 2^(c+1)-1.
+func sizeClass(n int64) int {
+	return bits.Len64(uint64(n)) - 1
+}
+
+// StatsQuery selects the rollups GreetingStats sums.
+type StatsQuery struct {
+	Unit     string
+	From, To time.Time // buckets starting in [From, To)
+	UserID   string    // "" for everyone
+	TopUsers int
+}
+
+// GreetingStats is the result of GreetingStats. Buckets without greetings
+// are left out; Batches has one entry per size class, Bucket unset.
+type GreetingStats struct {
+	Buckets  []BucketCount
+	TopUsers []UserCount
+	Batches  []BatchRollup
+	Through  time.Time // the watermark, zero before the first run
+}
+
+type BucketCount struct {
+	Bucket    time.Time
+	Greetings int64
+}
+
+type UserCount struct {
+	UserID    string
+	Name      string
+	Greetings int64
+}
+
+// rollupJob implements database.rollups: it keeps the rollups up to date
+// with the greetings table.
+type rollupJob struct {
+	repo Repository
+	cfg  config.RollupConfig
+
+	runs, failures atomic.Int64
+
+	mu        sync.Mutex
+	through   time.Time
+	lastError string
+}
+
+// rollupStats is published as the "rollups" expvar.
+type rollupStats struct {
+	Runs      int64     `json:"runs"`
+	Failures  int64     `json:"failures"`
+	Through   time.Time `json:"through"` // as far as this replica aggregated
+	LastError string    `json:"last_error,omitempty"`
+}
+
+func newRollupJob(repo Repository, cfg config.RollupConfig) *rollupJob {
+	return &rollupJob{repo: repo, cfg: cfg}
+}
+
+// run - Catches up right away, then every interval until ctx is done
+func (j *rollupJob) run(ctx context.Context) {
+	rollupLog.Info("greeting rollups enabled", "interval", j.cfg.Interval, "settle", j.cfg.Settle)
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		err := j.update(ctx)
+		j.runs.Add(1)
+		if err != nil && ctx.Err() == nil {
+			j.failures.Add(1)
+			j.mu.Lock()
+			j.lastError = err.Error()
+			j.mu.Unlock()
+			rollupLog.Error("rollup failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update aggregates the greetings since the watermark, unless another
+// replica is at it.
+func (j *rollupJob) update(ctx context.Context) error {
+	if ex, ok := j.repo.(exclusive); ok {
+		_, err := ex.exclusively(ctx, rollupLockID, func() error { return j.catchUp(ctx) })
+		return err
+	}
+	return j.catchUp(ctx)
+}
+
+// catchUp aggregates from the settle time before the watermark up to now,
+// a chunk at a time. The minutes are counted again from scratch, so
+// greetings stored late, within the settle time, are picked up.
+func (j *rollupJob) catchUp(ctx context.Context) error {
+	through, err := j.repo.RollupWatermark(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	from := through.UTC().Add(-j.cfg.Settle).Truncate(time.Minute)
+	if behind := now.Sub(from); behind > 2*rollupChunk {
+		rollupLog.Info("catching up on greeting rollups", "from", from, "behind", behind.Round(time.Minute))
+	}
+	for from.Before(now) {
+		to := from.Add(rollupChunk)
+		if to.After(now) {
+			to = now
+		}
+		if err := j.aggregate(ctx, from, to); err != nil {
+			return err
+		}
+		j.mu.Lock()
+		j.through = to
+		j.mu.Unlock()
+		from = to
+	}
+	return nil
+}
+
+// aggregate counts the greetings created in [from, to) per minute and user,
+// and the batches per minute and size class, and applies them. The
+// greetings of a client-stream batch share their batch_id; greetings
+// without one are not counted as batches.
+func (j *rollupJob) aggregate(ctx context.Context, from, to time.Time) error {
+	type userMinute struct {
+		bucket time.Time
+		userID string
+	}
+	counts := make(map[userMinute]int64)
+	type batch struct {
+		bucket time.Time
+		id     string
+	}
+	batchSizes := make(map[batch]int64)
+	err := j.repo.GreetingsBetween(ctx, from, to, rollupScanBatch, func(greetings []Greeting) error {
+		for _, g := range greetings {
+			at := g.CreatedAt.UTC()
+			userID := nilUserID
+			if g.UserID != nil {
+				userID = *g.UserID
+			}
+			counts[userMinute{at.Truncate(time.Minute), userID}]++
+			if g.BatchID != nil {
+				batchSizes[batch{at.Truncate(time.Minute), *g.BatchID}]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	minutes := make([]GreetingRollup, 0, len(counts))
+	for k, n := range counts {
+		minutes = append(minutes, GreetingRollup{Unit: rollupMinute, Bucket: k.bucket, UserID: k.userID, Greetings: n})
+	}
+	type classMinute struct {
+		bucket time.Time
+		class  int
+	}
+	classes := make(map[classMinute]*BatchRollup)
+	for b, size := range batchSizes {
+		k := classMinute{b.bucket, sizeClass(size)}
+		b := classes[k]
+		if b == nil {
+			b = &BatchRollup{Unit: rollupMinute, Bucket: k.bucket, SizeClass: k.class}
+			classes[k] = b
+		}
+		b.Batches++
+		b.Greetings += size
+		b.MaxSize = max(b.MaxSize, size)
+	}
+	batches := make([]BatchRollup, 0, len(classes))
+	for _, b := range classes {
+		batches = append(batches, *b)
+	}
+	return j.repo.ApplyRollups(ctx, from, to, minutes, batches)
+}
+
+// Stats returns the totals and how far the job got.
+func (j *rollupJob) Stats() rollupStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return rollupStats{
+		Runs:      j.runs.Load(),
+		Failures:  j.failures.Load(),
+		Through:   j.through,
+		LastError: j.lastError,
+	}
+}
+
+// publish exposes Stats as an expvar (served on server.debug_addr).
+func (j *rollupJob) publish(name string) {
+	if expvar.Get(name) == nil {
+		expvar.Publish(name, expvar.Func(func() any { return j.Stats() }))
+	}
+}
+
+// statsUnits maps the units of GreetingStatsRequest to rollup units.
+var statsUnits = map[pb.StatsUnit]rollupUnit{
+	pb.StatsUnit_STATS_UNIT_UNSPECIFIED: rollupUnits[1],
+	pb.StatsUnit_STATS_UNIT_MINUTE:      rollupUnits[0],
+	pb.StatsUnit_STATS_UNIT_HOUR:        rollupUnits[1],
+	pb.StatsUnit_STATS_UNIT_DAY:         rollupUnits[2],
+}
+
+// GetGreetingStats - Sums the rollups of the range widened to whole
+// buckets, filling in the empty ones
+func (a *adminServer) GetGreetingStats(ctx context.Context, in *pb.GreetingStatsRequest) (*pb.GreetingStatsReply, error) {
+	if err := requireScope(ctx, adminScope); err != nil {
+		return nil, err
+	}
+	unit, ok := statsUnits[in.Unit]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown unit %v", in.Unit)
+	}
+	until := time.Now().UTC()
+	if in.Until != nil {
+		until = in.Until.AsTime()
+	}
+	from := until.Add(-24 * time.Hour)
+	if in.From != nil {
+		from = in.From.AsTime()
+	}
+	if !from.Before(until) {
+		return nil, status.Error(codes.InvalidArgument, "from must be before until")
+	}
+	from = from.Truncate(unit.size)
+	if end := until.Truncate(unit.size); !end.Equal(until) {
+		until = end.Add(unit.size)
+	}
+	if n := until.Sub(from) / unit.size; n > maxStatsBuckets {
+		return nil, status.Errorf(codes.InvalidArgument, "the range spans %d %s buckets, at most %d are allowed; use a larger unit", n, unit.name, maxStatsBuckets)
+	}
+	top := int(in.TopUsers)
+	if top <= 0 {
+		top = defaultTopUsers
+	}
+	query := StatsQuery{Unit: unit.name, From: from, To: until, TopUsers: min(top, maxTopUsers)}
+	if in.User != "" {
+		user, err := a.repo.FindUser(ctx, in.User)
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "no such user")
+		}
+		if err != nil {
+			return nil, a.dbError(ctx, "stats failed", err)
+		}
+		query.UserID = user.ID
+	}
+
+	stats, err := a.repo.GreetingStats(ctx, query)
+	if err != nil {
+		return nil, a.dbError(ctx, "stats failed", err)
+	}
+	reply := &pb.GreetingStatsReply{
+		Unit:    in.Unit,
+		From:    timestamppb.New(from),
+		Until:   timestamppb.New(until),
+		Batches: &pb.BatchSizeStats{},
+	}
+	if in.Unit == pb.StatsUnit_STATS_UNIT_UNSPECIFIED {
+		reply.Unit = pb.StatsUnit_STATS_UNIT_HOUR
+	}
+	if !stats.Through.IsZero() {
+		reply.RolledUpThrough = timestamppb.New(stats.Through)
+	}
+	counts := make(map[time.Time]int64, len(stats.Buckets))
+	for _, b := range stats.Buckets {
+		counts[b.Bucket.UTC()] = b.Greetings
+		reply.Total += b.Greetings
+	}
+	for bucket := range unit.buckets(from, until) {
+		reply.Buckets = append(reply.Buckets, &pb.GreetingBucket{Start: timestamppb.New(bucket), Greetings: counts[bucket]})
+	}
+	for _, u := range stats.TopUsers {
+		name := u.Name
+		if u.UserID == nilUserID {
+			name = ""
+		}
+		reply.TopUsers = append(reply.TopUsers, &pb.UserGreetingCount{UserId: u.UserID, Name: name, Greetings: u.Greetings})
+	}
+	bs := reply.Batches
+	for _, b := range stats.Batches {
+		bs.Batches += b.Batches
+		bs.Greetings += b.Greetings
+		bs.MaxSize = max(bs.MaxSize, b.MaxSize)
+		bs.Histogram = append(bs.Histogram, &pb.BatchSizeRange{
+			MinSize: 1 << b.SizeClass,
+			MaxSize: 1<<(b.SizeClass+1) - 1,
+			Batches: b.Batches,
+		})
+	}
+	if bs.Batches > 0 {
+		bs.MeanSize = float64(bs.Greetings) / float64(bs.Batches)
+	}
+	return reply, nil
+}
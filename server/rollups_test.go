@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"grpc-example/config"
+)
+
+func TestRollupsCountBatchesByBatchID(t *testing.T) {
+	for name, repo := range testRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			// Two streams recorded in the same instant, and a greeting from
+			// before batches had IDs
+			at := time.Now().UTC().Truncate(time.Minute).Add(-time.Hour)
+			var greetings []Greeting
+			for _, size := range []int{3, 2} {
+				batchID := uuid.NewString()
+				for range size {
+					greetings = append(greetings, Greeting{Message: "Hello test", CreatedAt: at, BatchID: &batchID})
+				}
+			}
+			greetings = append(greetings, Greeting{Message: "Hello test", CreatedAt: at})
+			if err := repo.CreateGreetings(ctx, greetings, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			j := newRollupJob(repo, config.Defaults("dev").Database.Rollups)
+			if err := j.aggregate(ctx, at, at.Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			stats, err := repo.GreetingStats(ctx, StatsQuery{Unit: rollupMinute, From: at, To: at.Add(time.Minute)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stats.Buckets) != 1 || stats.Buckets[0].Greetings != 6 {
+				t.Fatalf("buckets = %+v, want 6 greetings", stats.Buckets)
+			}
+			var batches, batched, largest int64
+			for _, b := range stats.Batches {
+				batches += b.Batches
+				batched += b.Greetings
+				largest = max(largest, b.MaxSize)
+			}
+			if batches != 2 || batched != 5 || largest != 3 {
+				t.Fatalf("batches = %+v, want 2 batches of 5 greetings, the largest 3", stats.Batches)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// streamDeadlineSlack is added to a stream's gRPC deadline when it bounds
+// the connection, so the RPC ends with DEADLINE_EXCEEDED rather than a
+// severed connection.
+const streamDeadlineSlack = 5 * time.Second
+
+// streamingMethods returns the full names of every streaming method
+// registered on srv.
+func streamingMethods(srv *grpc.Server) map[string]bool {
+	methods := make(map[string]bool)
+	for service, info := range srv.GetServiceInfo() {
+		for _, m := range info.Methods {
+			if m.IsClientStream || m.IsServerStream {
+				methods["/"+service+"/"+m.Name] = true
+			}
+		}
+	}
+	return methods
+}
+
+// streamAwareTimeouts - Lifts the http.Server's read and write timeouts for
+// streaming methods and WebSocket upgrades, which would otherwise cut every
+// gRPC-Web stream after server.write_timeout. Such requests are bounded by
+// the method's server.deadlines max instead (no bound if it has none).
+// Unary calls keep the strict server-wide timeouts.
+func streamAwareTimeouts(next http.Handler, streaming map[string]bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		websocket := strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+		if !streaming[r.URL.Path] && !websocket {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var deadline time.Time // zero: no deadline
+		if limit := deadlinePolicy(settings.Current().Server.Deadlines, r.URL.Path).Max; limit > 0 {
+			deadline = time.Now().Add(limit + streamDeadlineSlack)
+		}
+		rc := http.NewResponseController(w)
+		for _, set := range []func(time.Time) error{rc.SetReadDeadline, rc.SetWriteDeadline} {
+			if err := set(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				log.WarnContext(r.Context(), "could not extend stream deadline", "path", r.URL.Path, "error", err)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
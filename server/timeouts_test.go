@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"grpc-example/config"
+	"grpc-example/logging"
+	pb "grpc-example/proto"
+)
+
+// tickingGreeter streams one reply per tick until total has passed.
+type tickingGreeter struct {
+	pb.UnimplementedGreeterServer
+	tick, total time.Duration
+}
+
+func (g tickingGreeter) SayHelloServerStream(in *pb.HelloRequest, stream pb.Greeter_SayHelloServerStreamServer) error {
+	for end := time.Now().Add(g.total); time.Now().Before(end); time.Sleep(g.tick) {
+		if err := stream.Send(&pb.HelloReply{Message: "Hello " + in.Name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestGRPCWebStreamOutlivesWriteTimeout runs a gRPC-Web server stream four
+// times as long as the http.Server's WriteTimeout (60s against the default
+// 15s; scaled down with -short). With streamAwareTimeouts the stream ends
+// with its trailers; without it the connection is cut at the timeout.
+func TestGRPCWebStreamOutlivesWriteTimeout(t *testing.T) {
+	writeTimeout, length := 15*time.Second, 60*time.Second
+	if testing.Short() {
+		writeTimeout, length = time.Second, 4*time.Second
+	}
+	settings = config.NewReloader(config.Defaults("dev"), nil, logging.For("config"))
+
+	srv := grpc.NewServer()
+	pb.RegisterGreeterServer(srv, tickingGreeter{tick: writeTimeout / 5, total: length})
+	t.Cleanup(srv.Stop)
+	wrapped := grpcweb.WrapServer(srv)
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		complete bool
+	}{
+		{"stream aware", streamAwareTimeouts(wrapped, streamingMethods(srv)), true},
+		{"strict timeouts", wrapped, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ts := httptest.NewUnstartedServer(tt.handler)
+			ts.Config.ReadTimeout = writeTimeout
+			ts.Config.WriteTimeout = writeTimeout
+			ts.Start()
+			defer ts.Close()
+
+			start := time.Now()
+			replies, trailer, err := readGRPCWebStream(ts.URL + "/helloworld.Greeter/SayHelloServerStream")
+			elapsed := time.Since(start)
+
+			if !tt.complete {
+				if err == nil && trailer != "" {
+					t.Fatalf("stream finished after %v with %d replies; want it cut at the %v write timeout", elapsed, replies, writeTimeout)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stream failed after %v and %d replies: %v", elapsed, replies, err)
+			}
+			if !strings.Contains(trailer, "grpc-status: 0") {
+				t.Fatalf("trailer = %q, want grpc-status 0", trailer)
+			}
+			if elapsed < length {
+				t.Fatalf("stream ended after %v, want at least %v", elapsed, length)
+			}
+			if want := int(length / (writeTimeout / 5)); replies < want-1 {
+				t.Fatalf("got %d replies, want about %d", replies, want)
+			}
+		})
+	}
+}
+
+// readGRPCWebStream calls a server-streaming method over gRPC-Web and reads
+// its response frames, returning the number of messages and the trailers.
+// It fails if the body ends before the trailer frame.
+func readGRPCWebStream(url string) (replies int, trailer string, err error) {
+	msg, err := proto.Marshal(&pb.HelloRequest{Name: "timeout test"})
+	if err != nil {
+		return 0, "", err
+	}
+	body := append([]byte{0}, binary.BigEndian.AppendUint32(nil, uint32(len(msg)))...)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(append(body, msg...)))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("X-Grpc-Web", "1")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("status %s", resp.Status)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return replies, "", fmt.Errorf("reading frame: %w", err)
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(header[1:]))
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return replies, "", fmt.Errorf("reading frame: %w", err)
+		}
+		if header[0]&0x80 != 0 {
+			return replies, strings.ToLower(string(frame)), nil
+		}
+		replies++
+	}
+}
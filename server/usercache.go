@@ -0,0 +1,209 @@
+package main
+
+import (
+	"container/list"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"grpc-example/config"
+)
+
+// userCache is a bounded LRU of users by name. Entries expire after a TTL
+// so changes made elsewhere show up eventually, and writes evict them
+// right away through invalidate. Names known not to exist are cached too
+// (negative entries), with their own, shorter TTL. Safe for concurrent use.
+type userCache struct {
+	capacity    int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu    sync.Mutex
+	order *list.List               // front is most recently used
+	names map[string]*list.Element // name -> *cacheEntry element
+	ids   map[string]*list.Element // user ID -> element, for invalidation by ID
+
+	hits, negativeHits, misses     atomic.Int64
+	evictions, expirations, purges atomic.Int64
+}
+
+type cacheEntry struct {
+	name    string
+	user    *User // nil for a negative entry
+	expires time.Time
+}
+
+// cacheStats is a snapshot of the cache counters, published as the
+// "user_cache" expvar.
+type cacheStats struct {
+	Size          int   `json:"size"`
+	Capacity      int   `json:"capacity"`
+	Hits          int64 `json:"hits"`
+	NegativeHits  int64 `json:"negative_hits"`
+	Misses        int64 `json:"misses"`
+	Evictions     int64 `json:"evictions"`     // dropped to stay within capacity
+	Expirations   int64 `json:"expirations"`   // dropped after their TTL
+	Invalidations int64 `json:"invalidations"` // dropped by invalidate or Clear
+}
+
+// newUserCache returns a cache sized by database.user_cache, or nil when
+// the cache is disabled (size 0). A nil *userCache is valid and caches
+// nothing.
+func newUserCache(cfg config.UserCacheConfig) *userCache {
+	if cfg.Size <= 0 {
+		return nil
+	}
+	return &userCache{
+		capacity:    cfg.Size,
+		ttl:         cfg.TTL,
+		negativeTTL: cfg.NegativeTTL,
+		order:       list.New(),
+		names:       make(map[string]*list.Element),
+		ids:         make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached user called name. found reports whether there
+// was a live entry at all; user is nil for a negative one.
+func (c *userCache) get(name string) (user *User, found bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.names[name]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		c.expirations.Add(1)
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	if e.user == nil {
+		c.negativeHits.Add(1)
+		return nil, true
+	}
+	c.hits.Add(1)
+	// Callers get their own copy, so they cannot change the cached one
+	u := *e.user
+	return &u, true
+}
+
+// add caches user under its name.
+func (c *userCache) add(user *User) {
+	if c == nil {
+		return
+	}
+	u := *user
+	u.Greetings = nil
+	c.put(&cacheEntry{name: user.Name, user: &u, expires: time.Now().Add(c.ttl)})
+}
+
+// addMissing records that no user is called name.
+func (c *userCache) addMissing(name string) {
+	if c == nil || c.negativeTTL <= 0 {
+		return
+	}
+	c.put(&cacheEntry{name: name, expires: time.Now().Add(c.negativeTTL)})
+}
+
+func (c *userCache) put(e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.names[e.name]; ok {
+		c.remove(el)
+	}
+	// One entry per user: after a rename, the one under the old name goes
+	if e.user != nil {
+		if el, ok := c.ids[e.user.ID]; ok {
+			c.remove(el)
+		}
+	}
+	el := c.order.PushFront(e)
+	c.names[e.name] = el
+	if e.user != nil {
+		c.ids[e.user.ID] = el
+	}
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// remove drops an entry; c.mu must be held.
+func (c *userCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*cacheEntry)
+	delete(c.names, e.name)
+	if e.user != nil && c.ids[e.user.ID] == el {
+		delete(c.ids, e.user.ID)
+	}
+}
+
+// invalidate evicts the given names and user IDs, e.g. after a write. An
+// ID evicts the user's entry whatever its name, so after a rename both the
+// new name and the ID must be given.
+func (c *userCache) invalidate(names, ids []string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range names {
+		if el, ok := c.names[name]; ok {
+			c.remove(el)
+			c.purges.Add(1)
+		}
+	}
+	for _, id := range ids {
+		if el, ok := c.ids[id]; ok {
+			c.remove(el)
+			c.purges.Add(1)
+		}
+	}
+}
+
+// Clear - Evicts every entry (after bulk changes, or between tests)
+func (c *userCache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purges.Add(int64(c.order.Len()))
+	c.order.Init()
+	clear(c.names)
+	clear(c.ids)
+}
+
+// Stats returns the current counters.
+func (c *userCache) Stats() cacheStats {
+	if c == nil {
+		return cacheStats{}
+	}
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+	return cacheStats{
+		Size:          size,
+		Capacity:      c.capacity,
+		Hits:          c.hits.Load(),
+		NegativeHits:  c.negativeHits.Load(),
+		Misses:        c.misses.Load(),
+		Evictions:     c.evictions.Load(),
+		Expirations:   c.expirations.Load(),
+		Invalidations: c.purges.Load(),
+	}
+}
+
+// publish exposes Stats as an expvar (served on server.debug_addr).
+func (c *userCache) publish(name string) {
+	if expvar.Get(name) == nil {
+		expvar.Publish(name, expvar.Func(func() any { return c.Stats() }))
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"grpc-example/config"
+)
+
+// testReplicas opens two repositories on one SQLite database; their caches
+// are kept coherent by the process-wide local bus, as replicas would be.
+func testReplicas(t *testing.T) (a, b *gormRepository) {
+	t.Helper()
+	cfg := config.Defaults("dev").Database
+	cfg.URL = sqliteScheme + filepath.Join(t.TempDir(), "replicas.db")
+	for _, r := range []**gormRepository{&a, &b} {
+		repo, err := openGormRepository(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { repo.Close() })
+		*r = repo
+	}
+	// The listeners register asynchronously: wait until both hear a probe
+	const probe = "replica probe"
+	eventually(t, "replicas are not listening for invalidations", func() bool {
+		a.users.add(&User{ID: probe, Name: probe})
+		b.users.add(&User{ID: probe, Name: probe})
+		processBus.Publish(context.Background(), nil, userInvalidation{Names: []string{probe}})
+		_, inA := a.users.get(probe)
+		_, inB := b.users.get(probe)
+		return !inA && !inB
+	})
+	return a, b
+}
+
+// eventually polls cond, since replicas hear of writes asynchronously.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal(what)
+		}
+	}
+}
+
+func TestGetOrCreateUsersInvalidatesOnlyInserted(t *testing.T) {
+	ctx := context.Background()
+	a, b := testReplicas(t)
+	if _, err := a.GetOrCreateUsers(ctx, []string{"ann"}); err != nil {
+		t.Fatal(err)
+	}
+	// b caches ann, and that zoe does not exist
+	eventually(t, "replica b never saw ann", func() bool {
+		user, err := b.FindUser(ctx, "ann")
+		return err == nil && user != nil
+	})
+	if _, err := b.FindUser(ctx, "zoe"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("FindUser(zoe) = %v, want ErrUserNotFound", err)
+	}
+
+	// a upserts both: ann already exists, zoe is new
+	a.users.invalidate([]string{"ann"}, nil)
+	if _, err := a.GetOrCreateUsers(ctx, []string{"ann", "zoe"}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "zoe's negative entry on replica b was not evicted", func() bool {
+		_, found := b.users.get("zoe")
+		return !found
+	})
+	if user, _ := b.users.get("ann"); user == nil {
+		t.Fatal("ann was evicted from replica b although the upsert did not change her")
+	}
+}
+
+func TestUserCacheKeepsOneEntryPerUser(t *testing.T) {
+	c := newUserCache(config.Defaults("dev").Database.UserCache)
+	c.add(&User{ID: "u1", Name: "ann"})
+	// Looked up again after a rename elsewhere
+	c.add(&User{ID: "u1", Name: "anna"})
+	if _, found := c.get("ann"); found {
+		t.Fatal("the entry under the old name outlived the rename")
+	}
+	c.invalidate(nil, []string{"u1"})
+	if _, found := c.get("anna"); found {
+		t.Fatal("invalidating by ID missed the entry under the new name")
+	}
+}
+
+func TestRenameEvictsOldName(t *testing.T) {
+	ctx := context.Background()
+	a, b := testReplicas(t)
+	if _, err := a.GetOrCreateUsers(ctx, []string{"ann"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*gormRepository{a, b} {
+		eventually(t, "ann was never cached", func() bool {
+			user, err := r.FindUser(ctx, "ann")
+			return err == nil && user != nil
+		})
+	}
+	gone := func(name string) {
+		t.Helper()
+		for replica, r := range map[string]*gormRepository{"a": a, "b": b} {
+			eventually(t, name+" is still cached on replica "+replica, func() bool {
+				_, err := r.FindUser(ctx, name)
+				return errors.Is(err, ErrUserNotFound)
+			})
+		}
+	}
+
+	// By a WHERE clause, so the callback only sees the new name
+	if err := a.db.Model(&User{}).Where("name = ?", "ann").Update("name", "anna").Error; err != nil {
+		t.Fatal(err)
+	}
+	gone("ann")
+
+	// Through the model, which has the ID
+	user, err := b.FindUser(ctx, "anna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.db.Model(user).Update("name", "annie").Error; err != nil {
+		t.Fatal(err)
+	}
+	gone("anna")
+	if renamed, err := b.FindUser(ctx, "annie"); err != nil || renamed.ID != user.ID {
+		t.Fatalf("FindUser(annie) = %v, %v; want %s", renamed, err, user.ID)
+	}
+}
+
+func TestConcurrentGetOrCreateUserConverges(t *testing.T) {
+	ctx := context.Background()
+	a, b := testReplicas(t)
+	// Hold each replica's insert until the other's is ready too, so that
+	// both have looked the name up and found nothing: one insert then fails
+	// on the unique name and has to re-read the winner's row
+	arrived := make(chan struct{}, 2)
+	for _, r := range []*gormRepository{a, b} {
+		err := r.db.Callback().Create().Before("gorm:create").Register("test:race", func(db *gorm.DB) {
+			if db.Statement.Table != (User{}).TableName() {
+				return
+			}
+			arrived <- struct{}{}
+			for deadline := time.Now().Add(time.Second); len(arrived) < 2 && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	const callers = 32
+	var (
+		wg    sync.WaitGroup
+		ids   = make([]string, callers)
+		errs  = make([]error, callers)
+		start = make(chan struct{})
+	)
+	for i := range callers {
+		// Half on each replica: each collapses its own callers into one
+		// lookup, and the two lookups race for the insert
+		repo := a
+		if i%2 == 1 {
+			repo = b
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			user, err := repo.GetOrCreateUser(ctx, "ann")
+			if err == nil {
+				ids[i] = user.ID
+			}
+			errs[i] = err
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("caller %d: %v", i, err)
+		}
+		if ids[i] != ids[0] {
+			t.Fatalf("caller %d got user %s, caller 0 got %s", i, ids[i], ids[0])
+		}
+	}
+	var rows int64
+	if err := a.db.Model(&User{}).Where("name = ?", "ann").Count(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 {
+		t.Fatalf("%d rows for ann, want 1", rows)
+	}
+}
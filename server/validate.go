@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	pb "grpc-example/proto"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// fieldValidator checks one annotated string field.
+type fieldValidator struct {
+	field   protoreflect.FieldDescriptor
+	rules   *pb.FieldRules
+	pattern *regexp.Regexp
+}
+
+// validators caches the compiled rules of each message type, keyed by its
+// full name. A nil slice means the message has no rules.
+var validators sync.Map // protoreflect.FullName -> []fieldValidator
+
+// validatorsFor compiles the (rules) annotations of md's fields.
+func validatorsFor(md protoreflect.MessageDescriptor) []fieldValidator {
+	if cached, ok := validators.Load(md.FullName()); ok {
+		return cached.([]fieldValidator)
+	}
+	var out []fieldValidator
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		rules, _ := proto.GetExtension(fd.Options(), pb.E_Rules).(*pb.FieldRules)
+		if rules == nil {
+			continue
+		}
+		v := fieldValidator{field: fd, rules: rules}
+		if rules.Pattern != "" {
+			// Annotations are part of the binary, so a bad pattern is a
+			// programming error.
+			v.pattern = regexp.MustCompile(rules.Pattern)
+		}
+		out = append(out, v)
+	}
+	validators.Store(md.FullName(), out)
+	return out
+}
+
+// validateMessage returns the rule violations of m and of the messages
+// nested in it.
+func validateMessage(m protoreflect.Message, prefix string) []*errdetails.BadRequest_FieldViolation {
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, v := range validatorsFor(m.Descriptor()) {
+		if v.field.Kind() != protoreflect.StringKind || v.field.IsList() {
+			continue
+		}
+		if description := v.check(m.Get(v.field).String()); description != "" {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       prefix + string(v.field.Name()),
+				Description: description,
+			})
+		}
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() {
+			violations = append(violations, validateMessage(value.Message(), prefix+string(fd.Name())+".")...)
+		}
+		return true
+	})
+	return violations
+}
+
+// check describes the first rule s breaks, or returns "" if it is valid.
+func (v fieldValidator) check(s string) string {
+	r := v.rules
+	if s == "" {
+		if r.Required {
+			return "is required"
+		}
+		return ""
+	}
+	length := uint32(utf8.RuneCountInString(s))
+	switch {
+	case r.MinLen > 0 && length < r.MinLen:
+		return fmt.Sprintf("must be at least %d characters, got %d", r.MinLen, length)
+	case r.MaxLen > 0 && length > r.MaxLen:
+		return fmt.Sprintf("must be at most %d characters, got %d", r.MaxLen, length)
+	}
+	if r.NoControlChars {
+		for i, c := range s {
+			if unicode.IsControl(c) {
+				return fmt.Sprintf("must not contain control characters, found %U at byte %d", c, i)
+			}
+		}
+	}
+	if v.pattern != nil && !v.pattern.MatchString(s) {
+		return fmt.Sprintf("must match the pattern %s", v.pattern)
+	}
+	return ""
+}
+
+// validate returns an InvalidArgument status with BadRequest details if
+// req breaks any of its (rules) annotations.
+func validate(req any) error {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+	violations := validateMessage(m.ProtoReflect(), "")
+	if len(violations) == 0 {
+		return nil
+	}
+	st := status.Newf(codes.InvalidArgument, "invalid %s: %s %s",
+		m.ProtoReflect().Descriptor().Name(), violations[0].Field, violations[0].Description)
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// validationUnaryInterceptor - Rejects requests that break their (rules) annotations
+func validationUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := validate(req); err != nil {
+		log.InfoContext(ctx, "invalid request", "method", info.FullMethod, "error", err)
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// validationStreamInterceptor - Validates every message received on a stream
+func validationStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &validatingStream{ServerStream: ss, method: info.FullMethod})
+}
+
+// validatingStream fails RecvMsg with InvalidArgument when the received
+// message breaks its rules, which ends the stream with that status.
+type validatingStream struct {
+	grpc.ServerStream
+	method string
+}
+
+func (s *validatingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if err := validate(m); err != nil {
+		log.InfoContext(s.Context(), "invalid stream message", "method", s.method, "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	pb "grpc-example/proto"
+)
+
+// testRulesMessage builds validatetest.Outer, whose fields carry one kind
+// of rule each, with a nested validatetest.Inner:
+//
+//	message Inner { string code = 1 [(rules) = {min_len: 2, max_len: 4, pattern: "^[A-Z]+$"}]; }
+//	message Outer {
+//	  string name = 1 [(rules) = {required: true, max_len: 5}];
+//	  string note = 2 [(rules) = {no_control_chars: true}];
+//	  Inner inner = 3;
+//	}
+func testRulesMessage(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	field := func(name string, number int32, rules *pb.FieldRules) *descriptorpb.FieldDescriptorProto {
+		opts := &descriptorpb.FieldOptions{}
+		proto.SetExtension(opts, pb.E_Rules, rules)
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			JsonName: proto.String(name),
+			Options:  opts,
+		}
+	}
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("validatetest.proto"),
+		Package: proto.String("validatetest"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name:  proto.String("Inner"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("code", 1, &pb.FieldRules{MinLen: 2, MaxLen: 4, Pattern: "^[A-Z]+$"})},
+			},
+			{
+				Name: proto.String("Outer"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, &pb.FieldRules{Required: true, MaxLen: 5}),
+					field("note", 2, &pb.FieldRules{NoControlChars: true}),
+					{
+						Name:     proto.String("inner"),
+						Number:   proto.Int32(3),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+						TypeName: proto.String(".validatetest.Inner"),
+						JsonName: proto.String("inner"),
+					},
+				},
+			},
+		},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Messages().ByName("Outer")
+}
+
+func TestValidateMessage(t *testing.T) {
+	outer := testRulesMessage(t)
+	tests := []struct {
+		name       string
+		nameField  string
+		note       string
+		innerCode  *string // nil leaves inner unset
+		violations map[string]string
+	}{
+		{"valid", "ann", "a note", ptr("AB"), nil},
+		{"valid without inner", "ann", "", nil, nil},
+		{"required", "", "", nil, map[string]string{"name": "is required"}},
+		{"max_len", "annabel", "", nil, map[string]string{"name": "must be at most 5 characters, got 7"}},
+		{"max_len counts characters", "ännä", "", nil, nil},
+		{"control chars", "ann", "line\nbreak", nil, map[string]string{"note": "must not contain control characters, found U+000A at byte 4"}},
+		{"nested min_len", "ann", "", ptr("A"), map[string]string{"inner.code": "must be at least 2 characters, got 1"}},
+		{"nested max_len", "ann", "", ptr("ABCDE"), map[string]string{"inner.code": "must be at most 4 characters, got 5"}},
+		{"nested pattern", "ann", "", ptr("ab"), map[string]string{"inner.code": "must match the pattern ^[A-Z]+$"}},
+		// An empty field that is not required skips its other rules
+		{"nested empty", "ann", "", ptr(""), nil},
+		{"several", "", "\x00", ptr("a"), map[string]string{
+			"name":       "is required",
+			"note":       "must not contain control characters, found U+0000 at byte 0",
+			"inner.code": "must be at least 2 characters, got 1",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := dynamicpb.NewMessage(outer)
+			m.Set(outer.Fields().ByName("name"), protoreflect.ValueOfString(tt.nameField))
+			m.Set(outer.Fields().ByName("note"), protoreflect.ValueOfString(tt.note))
+			if tt.innerCode != nil {
+				innerField := outer.Fields().ByName("inner")
+				inner := m.Mutable(innerField).Message()
+				inner.Set(inner.Descriptor().Fields().ByName("code"), protoreflect.ValueOfString(*tt.innerCode))
+			}
+
+			got := make(map[string]string)
+			for _, v := range validateMessage(m, "") {
+				got[v.Field] = v.Description
+			}
+			if len(got) != len(tt.violations) {
+				t.Fatalf("violations = %v, want %v", got, tt.violations)
+			}
+			for field, want := range tt.violations {
+				if got[field] != want {
+					t.Errorf("%s: %q, want %q", field, got[field], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateReturnsBadRequest(t *testing.T) {
+	tests := []struct {
+		name, value string
+		violation   string // "" when valid
+	}{
+		{"valid", "Ann Lee", ""},
+		{"required", "", "is required"},
+		{"max_len", strings.Repeat("a", 101), "must be at most 100 characters, got 101"},
+		{"control chars", "ann\tlee", "must not contain control characters"},
+		{"pattern", " ann", "must match the pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(&pb.HelloRequest{Name: tt.value})
+			if tt.violation == "" {
+				if err != nil {
+					t.Fatalf("validate = %v, want nil", err)
+				}
+				return
+			}
+			st := status.Convert(err)
+			if st.Code() != codes.InvalidArgument || !strings.HasPrefix(st.Message(), "invalid HelloRequest: name ") {
+				t.Fatalf("validate = %v, want InvalidArgument about the name", err)
+			}
+			var badRequest *errdetails.BadRequest
+			for _, d := range st.Details() {
+				if br, ok := d.(*errdetails.BadRequest); ok {
+					badRequest = br
+				}
+			}
+			if badRequest == nil || len(badRequest.FieldViolations) != 1 {
+				t.Fatalf("details = %v, want one BadRequest field violation", st.Details())
+			}
+			v := badRequest.FieldViolations[0]
+			if v.Field != "name" || !strings.HasPrefix(v.Description, tt.violation) {
+				t.Fatalf("violation = %s %q, want name %q", v.Field, v.Description, tt.violation)
+			}
+		})
+	}
+	if err := validate("not a message"); err != nil {
+		t.Fatalf("validate(non-proto) = %v, want nil", err)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -2,5 +2,5 @@
 
 cd "$(dirname "$0")/server"
 echo "🚀 Starting gRPC Server..."
-go run main.go database.go
+go run .
 